@@ -4,7 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/pion/ion-sfu/cmd/signal/allrpc/server"
 	log "github.com/pion/ion-sfu/pkg/logger"
 	"github.com/pion/ion-sfu/pkg/sfu"
@@ -83,6 +87,45 @@ func load() bool {
 	return true
 }
 
+// watchConfig applies the changes of the config file to the running SFU
+func watchConfig(reload func(sfu.Config) error) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		var c Config
+		if err := viper.Unmarshal(&c); err != nil {
+			logger.Error(err, "config file reload failed", "file", file)
+			return
+		}
+		if err := reload(c.Config); err != nil {
+			logger.Error(err, "config file partially reloaded", "file", file)
+			return
+		}
+		logger.Info("Config file reloaded", "file", file)
+	})
+	viper.WatchConfig()
+}
+
+// drainOnSignal drains the SFU on SIGTERM or interrupt and exits once it is drained, by
+// the signal or by the admin API. A second signal exits without waiting.
+func drainOnSignal(drain func(time.Duration), drained <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		select {
+		case sig := <-sigs:
+			logger.Info("Draining SFU", "signal", sig.String())
+			go drain(0)
+		case <-drained:
+		}
+		select {
+		case <-drained:
+			logger.Info("SFU drained, exiting")
+		case sig := <-sigs:
+			logger.Info("Exiting before the end of the drain", "signal", sig.String())
+		}
+		os.Exit(0)
+	}()
+}
+
 func parse() bool {
 	flag.StringVar(&file, "c", "config.toml", "config file")
 	flag.StringVar(&cert, "cert", "", "cert file")
@@ -148,6 +191,9 @@ func main() {
 
 	node := server.New(conf.Config, logger)
 
+	watchConfig(node.Reload)
+	drainOnSignal(node.Drain, node.Drained())
+
 	if gaddr != "" {
 		go node.ServeGRPC(gaddr, cert, key)
 	}
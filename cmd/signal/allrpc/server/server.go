@@ -3,8 +3,11 @@ package server
 import (
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/pion/ion-sfu/pkg/admin"
+	cacheredis "github.com/pion/ion-sfu/pkg/cache"
 	"github.com/pion/ion-sfu/pkg/middlewares/datachannel"
 
 	"github.com/pion/ion-sfu/cmd/signal/grpc/server"
@@ -28,7 +31,15 @@ type Server struct {
 // New create a server which support grpc/jsonrpc
 func New(c sfu.Config, logger logr.Logger) *Server { // Register default middlewares
 	s := sfu.NewSFU(c)
+	if c.Events.RedisStream != "" {
+		s.AddEventSink(cacheredis.NewEventStream(c.Events.RedisStream, 0))
+	}
 	sfu.Logger = logger
+	s.OnDrain(jsonrpcServer.ClosePullPeers)
+	s.SetRelaySignal(jsonrpcServer.RelaySignal(s))
+	if c.Mesh.RedisPrefix != "" {
+		s.SetMeshNodes(cacheredis.NewMeshRegistry(c.Mesh.RedisPrefix).Nodes)
+	}
 	dc := s.NewDatachannel(sfu.APIChannelLabel)
 	dc.Use(datachannel.SubscriberAPI)
 	return &Server{
@@ -37,6 +48,21 @@ func New(c sfu.Config, logger logr.Logger) *Server { // Register default middlew
 	}
 }
 
+// Reload applies a reloaded config to the SFU, see sfu.SFU.Reload
+func (s *Server) Reload(c sfu.Config) error {
+	return s.sfu.Reload(c)
+}
+
+// Drain drains the SFU, see sfu.SFU.Drain
+func (s *Server) Drain(timeout time.Duration) {
+	s.sfu.Drain(timeout)
+}
+
+// Drained returns a channel closed when the SFU is drained
+func (s *Server) Drained() <-chan struct{} {
+	return s.sfu.Drained()
+}
+
 // ServeGRPC serve grpc
 func (s *Server) ServeGRPC(gaddr, cert, key string) error {
 	return server.WrapperedGRPCWebServe(s.sfu, gaddr, cert, key)
@@ -91,6 +117,7 @@ func (s *Server) ServeMetrics(maddr string) {
 	// start metrics server
 	m := http.NewServeMux()
 	m.Handle("/metrics", promhttp.Handler())
+	m.Handle("/admin/", http.StripPrefix("/admin", admin.Handler(s.sfu)))
 	srv := &http.Server{
 		Handler: m,
 	}
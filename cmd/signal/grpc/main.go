@@ -8,8 +8,14 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/pion/ion-sfu/cmd/signal/grpc/server"
+	"github.com/pion/ion-sfu/pkg/admin"
+	cacheredis "github.com/pion/ion-sfu/pkg/cache"
 	"github.com/pion/ion-sfu/pkg/middlewares/datachannel"
 
 	log "github.com/pion/ion-sfu/pkg/logger"
@@ -100,6 +106,45 @@ func load() bool {
 	return true
 }
 
+// watchConfig applies the changes of the config file to the running SFU
+func watchConfig(reload func(sfu.Config) error) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		var c Config
+		if err := viper.Unmarshal(&c); err != nil {
+			logger.Error(err, "config file reload failed", "file", file)
+			return
+		}
+		if err := reload(c.Config); err != nil {
+			logger.Error(err, "config file partially reloaded", "file", file)
+			return
+		}
+		logger.Info("Config file reloaded", "file", file)
+	})
+	viper.WatchConfig()
+}
+
+// drainOnSignal drains the SFU on SIGTERM or interrupt and exits once it is drained, by
+// the signal or by the admin API. A second signal exits without waiting.
+func drainOnSignal(drain func(time.Duration), drained <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		select {
+		case sig := <-sigs:
+			logger.Info("Draining SFU", "signal", sig.String())
+			go drain(0)
+		case <-drained:
+		}
+		select {
+		case <-drained:
+			logger.Info("SFU drained, exiting")
+		case sig := <-sigs:
+			logger.Info("Exiting before the end of the drain", "signal", sig.String())
+		}
+		os.Exit(0)
+	}()
+}
+
 func parse() bool {
 	flag.StringVar(&file, "c", "config.toml", "config file")
 	flag.StringVar(&addr, "a", ":50051", "address to use")
@@ -134,10 +179,11 @@ func getEnv(key string) string {
 	return ""
 }
 
-func startMetrics(addr string) {
+func startMetrics(addr string, s *sfu.SFU) {
 	// start metrics server
 	m := http.NewServeMux()
 	m.Handle("/metrics", promhttp.Handler())
+	m.Handle("/admin/", http.StripPrefix("/admin", admin.Handler(s)))
 	srv := &http.Server{
 		Handler: m,
 	}
@@ -177,15 +223,24 @@ func main() {
 			_ = http.ListenAndServe(paddr, http.DefaultServeMux)
 		}()
 	}
-	go startMetrics(metricsAddr)
-
 	// SFU instance needs to be created with logr implementation
 	sfu.Logger = logger
 
 	nsfu := sfu.NewSFU(conf.Config)
+	if conf.Events.RedisStream != "" {
+		nsfu.AddEventSink(cacheredis.NewEventStream(conf.Events.RedisStream, 0))
+	}
+	watchConfig(nsfu.Reload)
+	drainOnSignal(nsfu.Drain, nsfu.Drained())
+	nsfu.SetRelaySignal(server.RelaySignal(nsfu))
+	if conf.Mesh.RedisPrefix != "" {
+		nsfu.SetMeshNodes(cacheredis.NewMeshRegistry(conf.Mesh.RedisPrefix).Nodes)
+	}
 	dc := nsfu.NewDatachannel(sfu.APIChannelLabel)
 	dc.Use(datachannel.SubscriberAPI)
 
+	go startMetrics(metricsAddr, nsfu)
+
 	err := server.WrapperedGRPCWebServe(nsfu, addr, cert, key)
 	if err != nil {
 		logger.Error(err, "failed to serve SFU")
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// relaySignalTimeout is the max time waited for the answer of the target node
+const relaySignalTimeout = 30 * time.Second
+
+// MigrationService moves the sessions between the nodes, it is described with well known
+// types as the stats service:
+//
+//	service sfu.Migration {
+//	  rpc Relay(google.protobuf.Struct) returns (google.protobuf.Struct);
+//	  rpc Migrated(google.protobuf.Struct) returns (google.protobuf.Struct);
+//	}
+//
+// Relay is called by the source node of a migration, the request holds the "sid" and
+// "uid" of the relayed peer and its base64 "signal", the reply the signal of this node.
+// Migrated confirms that a peer joined the target node of a migration, the request holds
+// its "sid" and "uid". Both are node to node calls, they carry the node secret in their
+// "authorization" metadata as a bearer token.
+type MigrationService interface {
+	Relay(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+	Migrated(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+type MigrationServer struct {
+	SFU *sfu.SFU
+}
+
+func NewMigrationServer(sfu *sfu.SFU) *MigrationServer {
+	return &MigrationServer{SFU: sfu}
+}
+
+// bearerTokens returns the bearer tokens of the "authorization" metadata of the call
+func bearerTokens(ctx context.Context) []string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var tokens []string
+	for _, v := range md.Get("authorization") {
+		if strings.HasPrefix(v, "Bearer ") {
+			tokens = append(tokens, strings.TrimPrefix(v, "Bearer "))
+		}
+	}
+	return tokens
+}
+
+// authorize rejects the calls not carrying the node secret
+func (s *MigrationServer) authorize(ctx context.Context) error {
+	for _, token := range bearerTokens(ctx) {
+		if s.SFU.AuthorizeNode(token) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, sfu.ErrUnauthorizedNode.Error())
+}
+
+// Relay answers the relay signal of a peer of the source node
+func (s *MigrationServer) Relay(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	sid := req.GetFields()["sid"].GetStringValue()
+	uid := req.GetFields()["uid"].GetStringValue()
+	signal, err := base64.StdEncoding.DecodeString(req.GetFields()["signal"].GetStringValue())
+	if sid == "" || uid == "" || err != nil || len(signal) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "sid, uid and signal are required")
+	}
+	answer, err := s.SFU.AddRelayPeer(relay.PeerMeta{PeerID: uid, SessionID: sid}, signal)
+	if err == sfu.ErrDraining {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return structpb.NewStruct(map[string]interface{}{
+		"sid":    sid,
+		"uid":    uid,
+		"signal": base64.StdEncoding.EncodeToString(answer),
+	})
+}
+
+// Migrated confirms that a peer joined the target node of its session
+func (s *MigrationServer) Migrated(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	sid := req.GetFields()["sid"].GetStringValue()
+	uid := req.GetFields()["uid"].GetStringValue()
+	if sid == "" || uid == "" {
+		return nil, status.Error(codes.InvalidArgument, "sid and uid are required")
+	}
+	switch err := s.SFU.Migrated(sid, uid); err {
+	case nil:
+		return &structpb.Struct{}, nil
+	case sfu.ErrSessionNotFound:
+		return nil, status.Error(codes.NotFound, err.Error())
+	default:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+}
+
+// RelaySignal returns the sfu.RelaySignalFunc sending the relay signals to the migration
+// service of the target node, the gRPC address of the node. The calls carry the node
+// secret of the SFU shared by the nodes.
+func RelaySignal(s *sfu.SFU) sfu.RelaySignalFunc {
+	return func(target string, meta relay.PeerMeta, signal []byte) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), relaySignalTimeout)
+		defer cancel()
+
+		conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		req, err := structpb.NewStruct(map[string]interface{}{
+			"sid":    meta.SessionID,
+			"uid":    meta.PeerID,
+			"signal": base64.StdEncoding.EncodeToString(signal),
+		})
+		if err != nil {
+			return nil, err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.NodeSecret())
+		reply := new(structpb.Struct)
+		if err = conn.Invoke(ctx, "/sfu.Migration/Relay", req, reply); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(reply.GetFields()["signal"].GetStringValue())
+	}
+}
+
+// RegisterMigrationServer registers the migration service in the gRPC server
+func RegisterMigrationServer(s grpc.ServiceRegistrar, srv MigrationService) {
+	s.RegisterService(&migrationServiceDesc, srv)
+}
+
+func relayHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationService).Relay(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sfu.Migration/Relay",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationService).Relay(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func migratedHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationService).Migrated(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sfu.Migration/Migrated",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationService).Migrated(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var migrationServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sfu.Migration",
+	HandlerType: (*MigrationService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Relay",
+			Handler:    relayHandler,
+		},
+		{
+			MethodName: "Migrated",
+			Handler:    migratedHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sfu/migration.proto",
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+
+	log "github.com/pion/ion-log"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// notificationQueueSize is the number of notifications queued for a subscriber, the
+// notifications are dropped when a subscriber can't keep up
+const notificationQueueSize = 64
+
+// NotificationService streams the notifications of a peer, the api messages also sent
+// on the api datachannel. As the rtc replies have no payload for them the service is
+// described with well known types as the stats service:
+//
+//	service sfu.Notifications {
+//	  rpc Subscribe(google.protobuf.Struct) returns (stream google.protobuf.Struct);
+//	}
+//
+// The request holds the "sid" and "uid" of a peer joined with a Signal stream, each
+// reply holds the "method" and the "params" of a notification. The stream ends with
+// the Signal stream of the peer.
+type NotificationService interface {
+	Subscribe(req *structpb.Struct, stream Notifications_SubscribeServer) error
+}
+
+// Notifications_SubscribeServer is the server side of a Subscribe stream
+type Notifications_SubscribeServer interface {
+	Send(*structpb.Struct) error
+	grpc.ServerStream
+}
+
+// notificationKey returns the key of the subscribers of a peer
+func notificationKey(sid, uid string) string {
+	return sid + "/" + uid
+}
+
+// Subscribe streams the notifications of a peer
+func (s *SFUServer) Subscribe(req *structpb.Struct, stream Notifications_SubscribeServer) error {
+	sid := req.GetFields()["sid"].GetStringValue()
+	uid := req.GetFields()["uid"].GetStringValue()
+	if sid == "" || uid == "" {
+		return status.Error(codes.InvalidArgument, "sid and uid are required")
+	}
+	key := notificationKey(sid, uid)
+	ch := make(chan *structpb.Struct, notificationQueueSize)
+	s.notifyMu.Lock()
+	s.notifications[key] = append(s.notifications[key], ch)
+	s.notifyMu.Unlock()
+	defer s.unsubscribe(key, ch)
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// unsubscribe removes a subscriber of a peer
+func (s *SFUServer) unsubscribe(key string, ch chan *structpb.Struct) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	subs := s.notifications[key]
+	for i, sub := range subs {
+		if sub == ch {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(s.notifications, key)
+		return
+	}
+	s.notifications[key] = subs
+}
+
+// notify sends a notification to the subscribers of a peer, it never blocks
+func (s *SFUServer) notify(sid, uid, method string, params interface{}) {
+	data, err := json.Marshal(sfu.ChannelAPIMessage{Method: method, Params: params})
+	if err != nil {
+		log.Errorf("notification %v error: %v", method, err)
+		return
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		log.Errorf("notification %v error: %v", method, err)
+		return
+	}
+	msg, err := structpb.NewStruct(fields)
+	if err != nil {
+		log.Errorf("notification %v error: %v", method, err)
+		return
+	}
+
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	for _, ch := range s.notifications[notificationKey(sid, uid)] {
+		select {
+		case ch <- msg:
+		default:
+			log.Warnf("notification queue full, dropping %v of %v", method, uid)
+		}
+	}
+}
+
+// closeNotifications ends the streams of the subscribers of a peer
+func (s *SFUServer) closeNotifications(sid, uid string) {
+	key := notificationKey(sid, uid)
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	for _, ch := range s.notifications[key] {
+		close(ch)
+	}
+	delete(s.notifications, key)
+}
+
+// RegisterNotificationServer registers the notification service in the gRPC server
+func RegisterNotificationServer(s grpc.ServiceRegistrar, srv NotificationService) {
+	s.RegisterService(&notificationServiceDesc, srv)
+}
+
+type notificationsSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *notificationsSubscribeServer) Send(m *structpb.Struct) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(structpb.Struct)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(NotificationService).Subscribe(in, &notificationsSubscribeServer{stream})
+}
+
+var notificationServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sfu.Notifications",
+	HandlerType: (*NotificationService)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       subscribeHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sfu/notifications.proto",
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// subscribe opens a notification stream of the peer on the server
+func subscribe(t *testing.T, ctx context.Context, conn *grpc.ClientConn, sid, uid string) grpc.ClientStream {
+	stream, err := conn.NewStream(ctx, &notificationServiceDesc.Streams[0], "/sfu.Notifications/Subscribe")
+	assert.NoError(t, err)
+	req, err := structpb.NewStruct(map[string]interface{}{"sid": sid, "uid": uid})
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(req))
+	assert.NoError(t, stream.CloseSend())
+	return stream
+}
+
+func TestSFUServer_Subscribe(t *testing.T) {
+	var c sfu.Config
+	s := NewSFUServer(sfu.NewSFU(c))
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	RegisterNotificationServer(grpcServer, s)
+	go func() { _ = grpcServer.Serve(lis) }()
+	defer grpcServer.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	stream := subscribe(t, ctx, conn, "session", "peer")
+	other := subscribe(t, ctx, conn, "session", "other")
+	assert.Eventually(t, func() bool {
+		s.notifyMu.Lock()
+		defer s.notifyMu.Unlock()
+		return len(s.notifications) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// Must send the notifications of the peer only
+	s.notify("session", "peer", sfu.DominantSpeakerMethod, sfu.DominantSpeaker{StreamID: "stream", Confidence: 1})
+	msg := new(structpb.Struct)
+	assert.NoError(t, stream.RecvMsg(msg))
+	assert.Equal(t, map[string]interface{}{
+		"method": sfu.DominantSpeakerMethod,
+		"params": map[string]interface{}{"streamId": "stream", "confidence": float64(1)},
+	}, msg.AsMap())
+
+	// Must end the streams of the peer once it left
+	s.closeNotifications("session", "peer")
+	assert.Error(t, stream.RecvMsg(msg))
+	s.notifyMu.Lock()
+	assert.Len(t, s.notifications, 1)
+	s.notifyMu.Unlock()
+
+	// Must not block when a subscriber doesn't read its notifications
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*notificationQueueSize; i++ {
+			s.notify("session", "other", sfu.AudioLevelValuesMethod, []sfu.AudioLevel{{StreamID: "stream"}})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("notify blocked")
+	}
+	assert.NoError(t, other.RecvMsg(msg))
+	assert.Equal(t, sfu.AudioLevelValuesMethod, msg.AsMap()["method"])
+
+	// Must require the peer
+	invalid := subscribe(t, ctx, conn, "session", "")
+	assert.Equal(t, codes.InvalidArgument, status.Code(invalid.RecvMsg(msg)))
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,10 +11,13 @@ import (
 	"github.com/bep/debounce"
 	log "github.com/pion/ion-log"
 	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/pion/ion-sfu/pkg/tracing"
 	rtc "github.com/pion/ion/proto/rtc"
 	"github.com/pion/webrtc/v3"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type Code int32
@@ -37,12 +41,16 @@ type SFUServer struct {
 	sync.Mutex
 	SFU  *sfu.SFU
 	sigs map[string]rtc.RTC_SignalServer
+
+	notifyMu      sync.Mutex
+	notifications map[string][]chan *structpb.Struct
 }
 
 func NewSFUServer(sfu *sfu.SFU) *SFUServer {
 	return &SFUServer{
-		SFU:  sfu,
-		sigs: make(map[string]rtc.RTC_SignalServer),
+		SFU:           sfu,
+		sigs:          make(map[string]rtc.RTC_SignalServer),
+		notifications: make(map[string][]chan *structpb.Struct),
 	}
 }
 
@@ -68,11 +76,47 @@ func (s *SFUServer) BroadcastTrackEvent(uid string, tracks []*rtc.TrackInfo, sta
 	}
 }
 
-func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
+// joinConfig reads the join config of a peer, the flags are "true" or "false" and the
+// subscription policy and the labels are JSON encoded as over json-rpc, e.g.
+// "Policy": `{"AudioOnly":true}` and "Labels": `{"role":"speaker"}`.
+func joinConfig(config map[string]string) (sfu.JoinConfig, error) {
+	cfg := sfu.JoinConfig{
+		NoPublish:       config["NoPublish"] == "true",
+		NoSubscribe:     config["NoSubscribe"] == "true",
+		NoAutoSubscribe: config["NoAutoSubscribe"] == "true",
+		E2EE:            config["E2EE"] == "true",
+	}
+	if val, found := config["Policy"]; found {
+		if err := json.Unmarshal([]byte(val), &cfg.Policy); err != nil {
+			return cfg, fmt.Errorf("policy: %w", err)
+		}
+	}
+	if val, found := config["Labels"]; found {
+		if err := json.Unmarshal([]byte(val), &cfg.Labels); err != nil {
+			return cfg, fmt.Errorf("labels: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) (err error) {
 	peer := sfu.NewPeer(s.SFU)
 	var tracksMutex sync.RWMutex
 	var tracksInfo []*rtc.TrackInfo
 
+	// Each request of the stream is traced as a child of the traceparent of the stream
+	streamCtx := sig.Context()
+	if md, ok := metadata.FromIncomingContext(streamCtx); ok {
+		if tp := md.Get("traceparent"); len(tp) > 0 {
+			streamCtx = tracing.Extract(streamCtx, tp[0])
+		}
+	}
+	var span *tracing.Span
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	defer func() {
 		if peer.Session() != nil {
 			log.Infof("[S=>C] close: sid => %v, uid => %v", peer.Session().ID(), peer.ID())
@@ -81,6 +125,7 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 			s.Lock()
 			delete(s.sigs, peer.ID())
 			s.Unlock()
+			s.closeNotifications(peer.Session().ID(), uid)
 
 			tracksMutex.Lock()
 			defer tracksMutex.Unlock()
@@ -126,6 +171,11 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 			return err
 		}
 
+		span.End()
+		var ctx context.Context
+		ctx, span = tracing.Start(streamCtx, "SFUServer.Signal")
+		span.SetAttribute("request", fmt.Sprintf("%T", in.Payload))
+
 		switch payload := in.Payload.(type) {
 		case *rtc.Request_Join:
 			sid := payload.Join.Sid
@@ -170,28 +220,28 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 					log.Errorf("negotiation error: %v", err)
 				}
 			}
-			nopub := false
-			if val, found := payload.Join.Config["NoPublish"]; found {
-				nopub = val == "true"
+			// Ask the client to join the target node when its session migrates
+			peer.OnMigrate = func(target string) {
+				s.notify(sid, uid, sfu.MigrateMethod, sfu.Migration{SessionID: sid, Target: target})
 			}
-
-			nosub := false
-			if val, found := payload.Join.Config["NoSubscribe"]; found {
-				nosub = val == "true"
+			// Ask the client to migrate to another node when the SFU drains
+			peer.OnDrain = func() {
+				s.notify(sid, uid, sfu.DrainMethod, nil)
 			}
-
-			noautosub := false
-			if val, found := payload.Join.Config["NoAutoSubscribe"]; found {
-				noautosub = val == "true"
+			// Send the audio levels and the dominant speaker changes to the subscribers of
+			// the notifications of the peer
+			peer.OnAudioLevels = func(levels []sfu.AudioLevel) {
+				s.notify(sid, uid, sfu.AudioLevelValuesMethod, levels)
 			}
-
-			cfg := sfu.JoinConfig{
-				NoPublish:       nopub,
-				NoSubscribe:     nosub,
-				NoAutoSubscribe: noautosub,
+			peer.OnDominantSpeaker = func(speaker sfu.DominantSpeaker) {
+				s.notify(sid, uid, sfu.DominantSpeakerMethod, speaker)
+			}
+			var cfg sfu.JoinConfig
+			if cfg, err = joinConfig(payload.Join.Config); err != nil {
+				return status.Errorf(codes.InvalidArgument, "join config error: %v", err)
 			}
 
-			err = peer.Join(sid, uid, cfg)
+			err = peer.JoinContext(ctx, sid, uid, cfg)
 			if err != nil {
 				switch err {
 				case sfu.ErrTransportExists:
@@ -212,6 +262,40 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 						log.Errorf("grpc send error: %v", err)
 						return status.Errorf(codes.Internal, err.Error())
 					}
+				case sfu.ErrDraining:
+					err = sig.Send(&rtc.Reply{
+						Payload: &rtc.Reply_Join{
+							Join: &rtc.JoinReply{
+								Success: false,
+								Error: &rtc.Error{
+									Code:   int32(ServiceUnavailable),
+									Reason: fmt.Sprintf("join error: %v", err),
+								},
+							},
+						},
+					})
+					if err != nil {
+						log.Errorf("grpc send error: %v", err)
+						return status.Errorf(codes.Internal, err.Error())
+					}
+					return status.Errorf(codes.Unavailable, sfu.ErrDraining.Error())
+				case sfu.ErrSessionLimit, sfu.ErrPeerLimit:
+					err = sig.Send(&rtc.Reply{
+						Payload: &rtc.Reply_Join{
+							Join: &rtc.JoinReply{
+								Success: false,
+								Error: &rtc.Error{
+									Code:   int32(BusyHere),
+									Reason: fmt.Sprintf("join error: %v", err),
+								},
+							},
+						},
+					})
+					if err != nil {
+						log.Errorf("grpc send error: %v", err)
+						return status.Errorf(codes.Internal, err.Error())
+					}
+					return status.Errorf(codes.ResourceExhausted, "join error: admission limit reached")
 				default:
 					return status.Errorf(codes.Unknown, err.Error())
 				}
@@ -223,7 +307,7 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 			}
 
 			log.Debugf("[C=>S] join.description: offer %v", desc.SDP)
-			answer, err := peer.Answer(desc)
+			answer, err := peer.AnswerContext(ctx, desc)
 			if err != nil {
 				return status.Errorf(codes.Internal, fmt.Sprintf("answer error: %v", err))
 			}
@@ -364,7 +448,7 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 			case webrtc.SDPTypeOffer:
 				log.Debugf("[C=>S] description: offer %v", desc.SDP)
 
-				answer, err := peer.Answer(desc)
+				answer, err := peer.AnswerContext(ctx, desc)
 				if err != nil {
 					return status.Errorf(codes.Internal, fmt.Sprintf("answer error: %v", err))
 				}
@@ -518,5 +602,6 @@ func (s *SFUServer) Signal(sig rtc.RTC_SignalServer) error {
 				},
 			})
 		}
+		span.End()
 	}
 }
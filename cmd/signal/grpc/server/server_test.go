@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_joinConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]string
+		want    sfu.JoinConfig
+		wantErr bool
+	}{
+		{
+			name: "Must read the flags",
+			config: map[string]string{
+				"NoPublish": "true", "NoSubscribe": "false", "NoAutoSubscribe": "true", "E2EE": "true",
+			},
+			want: sfu.JoinConfig{NoPublish: true, NoAutoSubscribe: true, E2EE: true},
+		},
+		{
+			name: "Must read the policy and the labels",
+			config: map[string]string{
+				"Policy": `{"AudioOnly":true,"StreamIDs":["a"],"Labels":{"role":"speaker"}}`,
+				"Labels": `{"role":"listener"}`,
+			},
+			want: sfu.JoinConfig{
+				Policy: &sfu.SubscriptionPolicy{
+					AudioOnly: true,
+					StreamIDs: []string{"a"},
+					Labels:    map[string]string{"role": "speaker"},
+				},
+				Labels: map[string]string{"role": "listener"},
+			},
+		},
+		{
+			name:    "Must reject an invalid policy",
+			config:  map[string]string{"Policy": "audio"},
+			wantErr: true,
+		},
+		{
+			name:    "Must reject invalid labels",
+			config:  map[string]string{"Labels": `["role"]`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := joinConfig(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
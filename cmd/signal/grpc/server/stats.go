@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// StatsService serves the stats snapshots of the peers. As the rtc protos are
+// maintained in the ion repository the service is described with well known types:
+//
+//	service sfu.Stats {
+//	  rpc GetStats(google.protobuf.Struct) returns (google.protobuf.Struct);
+//	}
+//
+// The request holds the "sid" and "uid" of the peer, the reply is the JSON encoded
+// sfu.PeerStats of the peer. The calls carry the admin token or the node secret in
+// their "authorization" metadata as a bearer token.
+type StatsService interface {
+	GetStats(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+type StatsServer struct {
+	SFU *sfu.SFU
+}
+
+func NewStatsServer(sfu *sfu.SFU) *StatsServer {
+	return &StatsServer{SFU: sfu}
+}
+
+// authorize rejects the calls carrying neither the admin token nor the node secret
+func (s *StatsServer) authorize(ctx context.Context) error {
+	for _, token := range bearerTokens(ctx) {
+		if s.SFU.AuthorizeAdmin(token) || s.SFU.AuthorizeNode(token) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "admin token or node secret required")
+}
+
+// GetStats returns the stats snapshot of a peer
+func (s *StatsServer) GetStats(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	sid := req.GetFields()["sid"].GetStringValue()
+	uid := req.GetFields()["uid"].GetStringValue()
+	if sid == "" || uid == "" {
+		return nil, status.Error(codes.InvalidArgument, "sid and uid are required")
+	}
+	st, err := s.SFU.PeerStats(sid, uid)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	reply, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return reply, nil
+}
+
+// RegisterStatsServer registers the stats service in the gRPC server
+func RegisterStatsServer(s grpc.ServiceRegistrar, srv StatsService) {
+	s.RegisterService(&statsServiceDesc, srv)
+}
+
+func getStatsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StatsService).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sfu.Stats/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StatsService).GetStats(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var statsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sfu.Stats",
+	HandlerType: (*StatsService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    getStatsHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sfu/stats.proto",
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestStatsServer_GetStats(t *testing.T) {
+	var c sfu.Config
+	c.SFU.AdminToken = "token"
+	c.SFU.NodeSecret = "secret"
+	s := NewStatsServer(sfu.NewSFU(c))
+	req, err := structpb.NewStruct(map[string]interface{}{"sid": "session", "uid": "peer"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{name: "Must refuse the calls without token", want: codes.Unauthenticated},
+		{name: "Must refuse a wrong token", token: "other", want: codes.Unauthenticated},
+		{name: "Must authorize the admin token", token: "token", want: codes.NotFound},
+		{name: "Must authorize the node secret", token: "secret", want: codes.NotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+			_, err := s.GetStats(ctx, req)
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
@@ -203,8 +203,15 @@ func WrapperedGRPCWebServe(sfu *sfu.SFU, addr, cert, key string) error {
 		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
 	)
 
-	rtc.RegisterRTCServer(grpcServer, NewSFUServer(sfu))
-	grpc_health_v1.RegisterHealthServer(grpcServer, health.NewServer())
+	sfuServer := NewSFUServer(sfu)
+	rtc.RegisterRTCServer(grpcServer, sfuServer)
+	RegisterNotificationServer(grpcServer, sfuServer)
+	RegisterStatsServer(grpcServer, NewStatsServer(sfu))
+	RegisterMigrationServer(grpcServer, NewMigrationServer(sfu))
+	hs := health.NewServer()
+	// Report the node as not serving once it drains
+	sfu.OnDrain(hs.Shutdown)
+	grpc_health_v1.RegisterHealthServer(grpcServer, hs)
 	grpc_prometheus.Register(grpcServer)
 
 	log.Infof("wrappered grpc listening %v", addr)
@@ -8,10 +8,16 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/websocket"
 
 	"github.com/pion/ion-sfu/cmd/signal/json-rpc/server"
+	"github.com/pion/ion-sfu/pkg/admin"
+	cacheredis "github.com/pion/ion-sfu/pkg/cache"
 	log "github.com/pion/ion-sfu/pkg/logger"
 	"github.com/pion/ion-sfu/pkg/middlewares/datachannel"
 	schedulecheck "github.com/pion/ion-sfu/pkg/schedule"
@@ -115,6 +121,45 @@ func load() bool {
 	return true
 }
 
+// watchConfig applies the changes of the config file to the running SFU
+func watchConfig(reload func(sfu.Config) error) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		var c sfu.Config
+		if err := viper.Unmarshal(&c); err != nil {
+			logger.Error(err, "config file reload failed", "file", file)
+			return
+		}
+		if err := reload(c); err != nil {
+			logger.Error(err, "config file partially reloaded", "file", file)
+			return
+		}
+		logger.Info("Config file reloaded", "file", file)
+	})
+	viper.WatchConfig()
+}
+
+// drainOnSignal drains the SFU on SIGTERM or interrupt and exits once it is drained, by
+// the signal or by the admin API. A second signal exits without waiting.
+func drainOnSignal(drain func(time.Duration), drained <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		select {
+		case sig := <-sigs:
+			logger.Info("Draining SFU", "signal", sig.String())
+			go drain(0)
+		case <-drained:
+		}
+		select {
+		case <-drained:
+			logger.Info("SFU drained, exiting")
+		case sig := <-sigs:
+			logger.Info("Exiting before the end of the drain", "signal", sig.String())
+		}
+		os.Exit(0)
+	}()
+}
+
 func parse() bool {
 	flag.StringVar(&file, "c", "config.toml", "config file")
 	flag.StringVar(&cert, "cert", "", "cert file")
@@ -135,10 +180,11 @@ func parse() bool {
 	return true
 }
 
-func startMetrics(addr string) {
+func startMetrics(addr string, s *sfu.SFU) {
 	// start metrics server
 	m := http.NewServeMux()
 	m.Handle("/metrics", promhttp.Handler())
+	m.Handle("/admin/", http.StripPrefix("/admin", admin.Handler(s)))
 	srv := &http.Server{
 		Handler: m,
 	}
@@ -174,6 +220,16 @@ func main() {
 	// Pass logr instance
 	sfu.Logger = logger
 	s := sfu.NewSFU(conf)
+	if conf.Events.RedisStream != "" {
+		s.AddEventSink(cacheredis.NewEventStream(conf.Events.RedisStream, 0))
+	}
+	watchConfig(s.Reload)
+	drainOnSignal(s.Drain, s.Drained())
+	s.OnDrain(server.ClosePullPeers)
+	s.SetRelaySignal(server.RelaySignal(s))
+	if conf.Mesh.RedisPrefix != "" {
+		s.SetMeshNodes(cacheredis.NewMeshRegistry(conf.Mesh.RedisPrefix).Nodes)
+	}
 	dc := s.NewDatachannel(sfu.APIChannelLabel)
 	dc.Use(datachannel.SubscriberAPI)
 
@@ -202,7 +258,7 @@ func main() {
 		<-jc.DisconnectNotify()
 	}))
 
-	go startMetrics(metricsAddr)
+	go startMetrics(metricsAddr, s)
 
 	go schedulecheck.ScheduleCheckSession(s, logger)
 
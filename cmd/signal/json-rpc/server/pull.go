@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	_ "net/http/pprof"
@@ -13,6 +14,7 @@ import (
 	"github.com/gorilla/websocket"
 
 	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/pion/ion-sfu/pkg/tracing"
 	"github.com/pion/webrtc/v3"
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -40,10 +42,23 @@ type Request struct {
 	Params *json.RawMessage `json:"params,omitempty"`
 	ID     jsonrpc2.ID      `json:"id"`
 	Sid    string           `json:"sid"`
+	// Traceparent propagates the span of the request between the edge and the origin
+	Traceparent string `json:"traceparent,omitempty"`
 }
 
 var AddrConn string
 
+// pullOrigin returns the address of the origin SFU, the reloadable pull origin of the
+// provider when set and AddrConn otherwise
+func pullOrigin(provider sfu.SessionProvider) func() string {
+	return func() string {
+		if o, ok := provider.(interface{ PullOrigin() string }); ok && o.PullOrigin() != "" {
+			return o.PullOrigin()
+		}
+		return AddrConn
+	}
+}
+
 type Connect struct {
 	mu   sync.Mutex
 	Conn *websocket.Conn
@@ -69,26 +84,35 @@ func readMessage(c *Connect, peers map[string]*JSONSignal, logger logr.Logger, d
 		var response Request
 		json.Unmarshal(mess, &response)
 
+		ctx, span := tracing.Start(tracing.Extract(context.Background(), response.Traceparent), "pull."+response.Method)
+		span.SetAttribute("session_id", response.Sid)
+
+		pullMu.Lock()
+		peer := peers[response.Sid]
+		pullMu.Unlock()
+
 		if response.Method == "answer" {
 			fmt.Println("got answer")
-			if peers[response.Sid] != nil {
+			if peer != nil {
 				var negotiation Negotiation
 				err := json.Unmarshal(*response.Params, &negotiation)
 				if err != nil {
 					logger.Error(err, "Err unmarshal")
 				}
-				if err := peers[response.Sid].SetRemoteDescription(negotiation.Desc); err != nil {
+				if err := peer.SetRemoteDescription(negotiation.Desc); err != nil {
+					span.RecordError(err)
 					logger.Error(err, "Err set remote answer")
 				}
 			}
 
 		} else if response.Method == "offer" {
 			fmt.Println("got offer")
-			if peers[response.Sid] != nil {
+			if peer != nil {
 				var negotiation Negotiation
 				err := json.Unmarshal(*response.Params, &negotiation)
-				answer, err := peers[response.Sid].Answer(negotiation.Desc)
+				answer, err := peer.AnswerContext(ctx, negotiation.Desc)
 				if err != nil {
+					span.RecordError(err)
 					logger.Error(err, "Err create ans")
 				}
 
@@ -110,6 +134,7 @@ func readMessage(c *Connect, peers map[string]*JSONSignal, logger logr.Logger, d
 						Str:      "",
 						Num:      connectionID,
 					},
+					Traceparent: tracing.Inject(ctx),
 				}
 
 				errSend := c.sendMess(websocket.TextMessage, answerMessage)
@@ -124,24 +149,26 @@ func readMessage(c *Connect, peers map[string]*JSONSignal, logger logr.Logger, d
 			}
 
 		} else if response.Method == "trickle" {
-			if peers[response.Sid] != nil {
+			if peer != nil {
 				fmt.Println("got trickle")
 				var trickle Trickle
 				if err := json.Unmarshal(*response.Params, &trickle); err != nil {
 					logger.Error(err, "Err read trickle")
 				}
 
-				err := peers[response.Sid].Trickle(trickle.Candidate, trickle.Target)
+				err := peer.Trickle(trickle.Candidate, trickle.Target)
 				if err != nil {
+					span.RecordError(err)
 					logger.Error(err, "Err add candidate")
 				}
 			}
 		}
+		span.End()
 	}
 }
 
-func createConnWs(address string, logger logr.Logger) *Connect {
-	u := url.URL{Scheme: "ws", Host: AddrConn, Path: "/pull"}
+func createConnWs(origin func() string, logger logr.Logger) *Connect {
+	u := url.URL{Scheme: "ws", Host: origin(), Path: "/pull"}
 	logger.Info("connecting to", u.String())
 	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
@@ -150,8 +177,10 @@ func createConnWs(address string, logger logr.Logger) *Connect {
 	}
 	c.SetCloseHandler(func(code int, text string) error {
 		logger.Info("Create new connect ws...")
-		cn := createConnWs(address, logger)
+		cn := createConnWs(origin, logger)
+		pullMu.Lock()
 		Conn = cn
+		pullMu.Unlock()
 		return nil
 	})
 
@@ -162,6 +191,27 @@ func createConnWs(address string, logger logr.Logger) *Connect {
 	return conn
 }
 
+// ClosePullPeers closes the peers pulling sessions from the origin and the connection
+// to it, they would keep the sessions alive when the SFU drains.
+func ClosePullPeers() {
+	pullMu.Lock()
+	peers := make([]*JSONSignal, 0, len(PullPeers))
+	for sid, p := range PullPeers {
+		peers = append(peers, p)
+		delete(PullPeers, sid)
+	}
+	conn := Conn
+	Conn = nil
+	pullMu.Unlock()
+
+	for _, p := range peers {
+		p.Close()
+	}
+	if conn != nil {
+		conn.Conn.Close()
+	}
+}
+
 func createPeer(peerLocal *sfu.PeerLocal, c *Connect, id string, logger logr.Logger) *JSONSignal {
 	p := NewJSONSignal(peerLocal, logger)
 
@@ -203,11 +253,19 @@ func createPeer(peerLocal *sfu.PeerLocal, c *Connect, id string, logger logr.Log
 		NoPublish:       false,
 		NoSubscribe:     false,
 		NoAutoSubscribe: false,
+		NoRelay:         true,
 	})
 	return p
 }
 
-func sendOfferJoin(pc *webrtc.PeerConnection, ssid string, c *Connect, logger logr.Logger) error {
+func sendOfferJoin(ctx context.Context, pc *webrtc.PeerConnection, ssid string, c *Connect, logger logr.Logger) (err error) {
+	ctx, span := tracing.Start(ctx, "pull.sendOfferJoin")
+	span.SetAttribute("session_id", ssid)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	offer, err := pc.CreateOffer(nil)
 
 	errSetDps := pc.SetLocalDescription(offer)
@@ -241,10 +299,12 @@ func sendOfferJoin(pc *webrtc.PeerConnection, ssid string, c *Connect, logger lo
 			Str:      "",
 			Num:      connectionID,
 		},
+		Traceparent: tracing.Inject(ctx),
 	}
 
 	errSend := c.sendMess(websocket.TextMessage, offerMessage)
 	if errSend != nil {
+		span.RecordError(errSend)
 		logger.Error(errSend, "Err send mess")
 	}
 
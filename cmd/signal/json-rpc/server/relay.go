@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/ion-sfu/pkg/relay"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/sourcegraph/jsonrpc2"
+	websocketjsonrpc2 "github.com/sourcegraph/jsonrpc2/websocket"
+)
+
+// relaySignalTimeout is the max time waited for the answer of the target node
+const relaySignalTimeout = 30 * time.Second
+
+var errRelayUnsupported = errors.New("relay is not supported by the session provider")
+
+type noopHandler struct{}
+
+func (noopHandler) Handle(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) {}
+
+// RelaySignal returns the sfu.RelaySignalFunc sending the relay signals to the json-rpc
+// server of the target node, the websocket URL of the node, e.g. ws://10.0.0.2:7000/ws.
+// The signals carry the node secret of the SFU shared by the nodes.
+func RelaySignal(s *sfu.SFU) sfu.RelaySignalFunc {
+	return func(target string, meta relay.PeerMeta, signal []byte) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), relaySignalTimeout)
+		defer cancel()
+
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		conn := jsonrpc2.NewConn(ctx, websocketjsonrpc2.NewObjectStream(c), noopHandler{})
+		defer conn.Close()
+
+		var reply Relay
+		req := Relay{SID: meta.SessionID, UID: meta.PeerID, Signal: signal, Secret: s.NodeSecret()}
+		if err = conn.Call(ctx, "relay", req, &reply); err != nil {
+			return nil, err
+		}
+		return reply.Signal, nil
+	}
+}
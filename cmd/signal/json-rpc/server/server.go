@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
 
 	"github.com/go-logr/logr"
 	cacheredis "github.com/pion/ion-sfu/pkg/cache"
+	"github.com/pion/ion-sfu/pkg/relay"
 	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/pion/ion-sfu/pkg/tracing"
 	"github.com/pion/webrtc/v3"
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -31,6 +35,39 @@ type Trickle struct {
 	Candidate webrtc.ICECandidateInit `json:"candidate"`
 }
 
+// Pin lists the streams forwarded to the peer regardless of the last-N selection
+type Pin struct {
+	StreamIDs []string `json:"streamIds"`
+}
+
+// Relay message sent by another node to relay the tracks of a peer, the reply holds
+// the relay signal of this node
+type Relay struct {
+	SID    string `json:"sid"`
+	UID    string `json:"uid"`
+	Signal []byte `json:"signal"`
+	// Secret is the node secret of the calling node, omitted in the replies
+	Secret string `json:"secret,omitempty"`
+}
+
+// RequestMeta is the meta of the requests, the traceparent propagates the trace of the
+// client to the spans of the request.
+type RequestMeta struct {
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// traceparent returns the traceparent of the meta of the request, if any
+func traceparent(req *jsonrpc2.Request) string {
+	if req.Meta == nil {
+		return ""
+	}
+	var meta RequestMeta
+	if err := json.Unmarshal(*req.Meta, &meta); err != nil {
+		return ""
+	}
+	return meta.Traceparent
+}
+
 type JSONSignal struct {
 	*sfu.PeerLocal
 	logr.Logger
@@ -39,13 +76,22 @@ type JSONSignal struct {
 var Conn *Connect
 var PullPeers = make(map[string]*JSONSignal)
 
+// pullMu guards Conn and PullPeers, the join handlers, the pull reader and the drain use
+// them concurrently
+var pullMu sync.Mutex
+
 func NewJSONSignal(p *sfu.PeerLocal, l logr.Logger) *JSONSignal {
 	return &JSONSignal{p, l}
 }
 
 // Handle incoming RPC call events like join, answer, offer and trickle
 func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, traceparent(req)), "JSONSignal.Handle")
+	span.SetAttribute("method", req.Method)
+	defer span.End()
+
 	replyError := func(err error) {
+		span.RecordError(err)
 		_ = conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
 			Code:    500,
 			Message: fmt.Sprintf("%s", err),
@@ -86,33 +132,62 @@ func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 							p.Logger.Error(err, "error sending ice candidate")
 						}
 					}
+					p.OnAudioLevels = func(levels []sfu.AudioLevel) {
+						if err := conn.Notify(ctx, sfu.AudioLevelValuesMethod, levels); err != nil {
+							p.Logger.Error(err, "error sending audio levels")
+						}
+					}
+					p.OnDominantSpeaker = func(speaker sfu.DominantSpeaker) {
+						if err := conn.Notify(ctx, sfu.DominantSpeakerMethod, speaker); err != nil {
+							p.Logger.Error(err, "error sending dominant speaker")
+						}
+					}
 
+					p.OnMigrate = func(target string) {
+						if err := conn.Notify(ctx, sfu.MigrateMethod, sfu.Migration{SessionID: join.SID, Target: target}); err != nil {
+							p.Logger.Error(err, "error sending migrate")
+						}
+					}
+					p.OnDrain = func() {
+						if err := conn.Notify(ctx, sfu.DrainMethod, nil); err != nil {
+							p.Logger.Error(err, "error sending drain")
+						}
+					}
+
+					_, checkSpan := tracing.Start(ctx, "CheckSession")
 					accept, newConn, s := p.GetProvider().CheckSession(join.SID)
+					checkSpan.SetAttribute("session_id", join.SID)
+					checkSpan.SetAttribute("accept", strconv.FormatBool(accept))
+					checkSpan.SetAttribute("new_conn", strconv.FormatBool(newConn))
+					checkSpan.End()
 					if newConn == true {
+						pullMu.Lock()
 						if Conn == nil {
-							c := createConnWs("localhost:7070", p.Logger)
+							c := createConnWs(pullOrigin(p.GetProvider()), p.Logger)
 							Conn = c
 
 							done := make(chan struct{})
 							go readMessage(Conn, PullPeers, p.Logger, done)
 						}
+						pullConn := Conn
 
-						peerPull := createPeer(sfu.NewPeer(s), Conn, join.SID, p.Logger)
+						peerPull := createPeer(sfu.NewPeer(s), pullConn, join.SID, p.Logger)
 						//defer peerPull.Close()
 						PullPeers[join.SID] = peerPull
+						pullMu.Unlock()
 
 						pc := peerPull.Subscriber().GetPeerConnection()
-						go sendOfferJoin(pc, join.SID, Conn, peerPull.Logger)
+						go sendOfferJoin(ctx, pc, join.SID, pullConn, peerPull.Logger)
 
 					}
 					if accept == true {
-						err = p.Join(join.SID, join.UID, join.Config)
+						err = p.JoinContext(ctx, join.SID, join.UID, join.Config)
 						if err != nil {
 							replyError(err)
 							break
 						}
 
-						answer, err := p.Answer(join.Offer)
+						answer, err := p.AnswerContext(ctx, join.Offer)
 						if err != nil {
 							replyError(err)
 							break
@@ -120,6 +195,9 @@ func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 
 						_ = conn.Reply(ctx, req.ID, answer)
 					} else {
+						if s != nil && s.Draining() {
+							replyError(sfu.ErrDraining)
+						}
 						p.Close()
 					}
 					break
@@ -139,7 +217,7 @@ func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 			break
 		}
 
-		answer, err := p.Answer(negotiation.Desc)
+		answer, err := p.AnswerContext(ctx, negotiation.Desc)
 		if err != nil {
 			replyError(err)
 			break
@@ -175,5 +253,64 @@ func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 		if err != nil {
 			replyError(err)
 		}
+
+	case "getStats":
+		if p.Session() == nil {
+			replyError(sfu.ErrNoTransportEstablished)
+			break
+		}
+		_ = conn.Reply(ctx, req.ID, p.Stats())
+
+	case "pin":
+		var pin Pin
+		err := json.Unmarshal(*req.Params, &pin)
+		if err != nil {
+			p.Logger.Error(err, "connect: error parsing pin")
+			replyError(err)
+			break
+		}
+		if p.Subscriber() == nil {
+			replyError(sfu.ErrNoTransportEstablished)
+			break
+		}
+		p.Subscriber().SetPinnedStreams(pin.StreamIDs...)
+		_ = conn.Reply(ctx, req.ID, true)
+
+	case "relay":
+		var r Relay
+		err := json.Unmarshal(*req.Params, &r)
+		if err != nil {
+			p.Logger.Error(err, "connect: error parsing relay")
+			replyError(err)
+			break
+		}
+		s, ok := p.GetProvider().(*sfu.SFU)
+		if !ok {
+			replyError(errRelayUnsupported)
+			break
+		}
+		if !s.AuthorizeNode(r.Secret) {
+			replyError(sfu.ErrUnauthorizedNode)
+			break
+		}
+		signal, err := s.AddRelayPeer(relay.PeerMeta{PeerID: r.UID, SessionID: r.SID}, r.Signal)
+		if err != nil {
+			replyError(err)
+			break
+		}
+		_ = conn.Reply(ctx, req.ID, Relay{SID: r.SID, UID: r.UID, Signal: signal})
+
+	case "migrated":
+		// A peer only confirms its own migration
+		s, ok := p.GetProvider().(*sfu.SFU)
+		if !ok || p.Session() == nil {
+			replyError(sfu.ErrNoTransportEstablished)
+			break
+		}
+		if err := s.Migrated(p.Session().ID(), p.ID()); err != nil {
+			replyError(err)
+			break
+		}
+		_ = conn.Reply(ctx, req.ID, true)
 	}
 }
@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/bep/debounce v1.2.0
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/gammazero/deque v0.1.0
 	github.com/gammazero/workerpool v1.1.2
 	github.com/go-co-op/gocron v1.18.0 // indirect
@@ -34,4 +35,5 @@ require (
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	google.golang.org/grpc v1.41.0
+	google.golang.org/protobuf v1.27.1
 )
@@ -0,0 +1,102 @@
+// Package admin provides the HTTP API used by the operators to inspect a SFU.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/sfu"
+)
+
+// Handler returns the admin API of the SFU, serving:
+//
+//	GET  /stats?sid={session}&uid={peer}       the stats snapshot of a peer
+//	POST /drain?timeout={seconds}              drains the SFU, the timeout defaults to the config one
+//	POST /migrate?sid={session}&target={node}  migrates a session to another node
+//
+// The requests must carry the admin token of the SFU as a bearer authorization, all of
+// them are rejected when the token is empty. The token is read on each request so a
+// reloaded token applies at once.
+func Handler(s *sfu.SFU) http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sid, uid := r.URL.Query().Get("sid"), r.URL.Query().Get("uid")
+		if sid == "" || uid == "" {
+			http.Error(w, "sid and uid are required", http.StatusBadRequest)
+			return
+		}
+		st, err := s.PeerStats(sid, uid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, st)
+	})
+	m.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var timeout time.Duration
+		if t := r.URL.Query().Get("timeout"); t != "" {
+			sec, err := strconv.Atoi(t)
+			if err != nil || sec < 0 {
+				http.Error(w, "invalid timeout", http.StatusBadRequest)
+				return
+			}
+			timeout = time.Duration(sec) * time.Second
+		}
+		go s.Drain(timeout)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	m.HandleFunc("/migrate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sid, target := r.URL.Query().Get("sid"), r.URL.Query().Get("target")
+		if sid == "" || target == "" {
+			http.Error(w, "sid and target are required", http.StatusBadRequest)
+			return
+		}
+		switch err := s.Migrate(sid, target); err {
+		case nil:
+			w.WriteHeader(http.StatusAccepted)
+		case sfu.ErrSessionNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case sfu.ErrMigrationInProgress:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case sfu.ErrNoRelaySignal:
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+	})
+	return authorize(s, m)
+}
+
+// authorize rejects the requests not carrying the admin token as a bearer token
+func authorize(s *sfu.SFU, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || !s.AuthorizeAdmin(strings.TrimPrefix(auth, "Bearer ")) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "token"
+
+func newRequest(method, url string) *http.Request {
+	r := httptest.NewRequest(method, url, nil)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	return r
+}
+
+func newTestSFU(token string) *sfu.SFU {
+	c := sfu.Config{Router: sfu.RouterConfig{MaxPacketTrack: 200}}
+	c.SFU.AdminToken = token
+	return sfu.NewSFU(c)
+}
+
+func TestHandler_Authorization(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{name: "Must reject requests without token", token: testToken, want: http.StatusUnauthorized},
+		{name: "Must reject a wrong token", token: testToken, authorization: "Bearer other", want: http.StatusUnauthorized},
+		{name: "Must reject all requests when disabled", authorization: "Bearer ", want: http.StatusUnauthorized},
+		{name: "Must accept the token", token: testToken, authorization: "Bearer " + testToken, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/stats?sid=session&uid=peer", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			Handler(newTestSFU(tt.token)).ServeHTTP(rec, r)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestHandler_Stats(t *testing.T) {
+	h := Handler(newTestSFU(testToken))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{name: "Must require the peer", method: http.MethodGet, url: "/stats?sid=session", want: http.StatusBadRequest},
+		{name: "Must return not found for unknown peers", method: http.MethodGet, url: "/stats?sid=session&uid=peer", want: http.StatusNotFound},
+		{name: "Must only allow GET", method: http.MethodPost, url: "/stats?sid=session&uid=peer", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, newRequest(tt.method, tt.url))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestHandler_Drain(t *testing.T) {
+	s := newTestSFU(testToken)
+	h := Handler(s)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{name: "Must only allow POST", method: http.MethodGet, url: "/drain", want: http.StatusMethodNotAllowed},
+		{name: "Must reject an invalid timeout", method: http.MethodPost, url: "/drain?timeout=soon", want: http.StatusBadRequest},
+		{name: "Must drain the SFU", method: http.MethodPost, url: "/drain?timeout=1", want: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, newRequest(tt.method, tt.url))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+
+	select {
+	case <-s.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SFU not drained")
+	}
+	assert.True(t, s.Draining())
+}
+
+func TestHandler_Migrate(t *testing.T) {
+	s := newTestSFU(testToken)
+	h := Handler(s)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{name: "Must only allow POST", method: http.MethodGet, url: "/migrate?sid=session&target=node", want: http.StatusMethodNotAllowed},
+		{name: "Must require the target", method: http.MethodPost, url: "/migrate?sid=session", want: http.StatusBadRequest},
+		{name: "Must require a relay signal", method: http.MethodPost, url: "/migrate?sid=session&target=node", want: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, newRequest(tt.method, tt.url))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+
+	s.SetRelaySignal(func(target string, meta relay.PeerMeta, signal []byte) ([]byte, error) {
+		return nil, nil
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest(http.MethodPost, "/migrate?sid=session&target=node"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
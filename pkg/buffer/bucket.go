@@ -35,9 +35,11 @@ func (b *Bucket) AddPacket(pkt []byte, sn uint16, latest bool) ([]byte, error) {
 	}
 	diff := sn - b.headSN
 	b.headSN = sn
+	// Skip the slots of the missing packets, wrapping as push does so the positions
+	// computed by get stay consistent
 	for i := uint16(1); i < diff; i++ {
 		b.step++
-		if b.step >= b.maxSteps {
+		if b.step > b.maxSteps {
 			b.step = 0
 		}
 	}
@@ -112,3 +114,21 @@ func (b *Bucket) set(sn uint16, pkt []byte) ([]byte, error) {
 	copy(b.buf[off+2:], pkt)
 	return b.buf[off+2 : off+2+len(pkt)], nil
 }
+
+// copyTo copies the most recent packets that fit in the given empty bucket, in sequence order
+func (b *Bucket) copyTo(to *Bucket) {
+	if !b.init {
+		return
+	}
+	n := b.maxSteps + 1
+	if n > to.maxSteps+1 {
+		n = to.maxSteps + 1
+	}
+	start := b.headSN - uint16(n) + 1
+	for i := 0; i < n; i++ {
+		sn := start + uint16(i)
+		if pkt := b.get(sn); pkt != nil {
+			to.AddPacket(pkt, sn, true)
+		}
+	}
+}
@@ -137,3 +137,50 @@ func Test_queue_edges(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedSN+1, np.SequenceNumber)
 }
+
+func Test_queue_gapWrap(t *testing.T) {
+	// The gap of 5 after 2 skips the two last slots, the bucket keeps maxSteps+1 packets
+	b := make([]byte, 4*maxPktSize)
+	q := NewBucket(&b)
+	for _, sn := range []uint16{1, 2, 5} {
+		buf, err := (&rtp.Packet{Header: rtp.Header{SequenceNumber: sn}}).Marshal()
+		assert.NoError(t, err)
+		_, err = q.AddPacket(buf, sn, true)
+		assert.NoError(t, err)
+	}
+
+	np := rtp.Packet{}
+	buff := make([]byte, maxPktSize)
+	for _, sn := range []uint16{2, 5} {
+		i, err := q.GetPacket(buff, sn)
+		assert.NoError(t, err)
+		assert.NoError(t, np.Unmarshal(buff[:i]))
+		assert.Equal(t, sn, np.SequenceNumber)
+	}
+}
+
+func Test_bucketCopyTo(t *testing.T) {
+	b := make([]byte, 15000)
+	q := NewBucket(&b)
+	for _, p := range TestPackets {
+		buf, err := p.Marshal()
+		assert.NoError(t, err)
+		_, err = q.AddPacket(buf, p.SequenceNumber, true)
+		assert.NoError(t, err)
+	}
+
+	s := make([]byte, 4*maxPktSize)
+	small := NewBucket(&s)
+	q.copyTo(small)
+
+	np := rtp.Packet{}
+	buff := make([]byte, maxPktSize)
+	for _, sn := range []uint16{7, 10} {
+		i, err := small.GetPacket(buff, sn)
+		assert.NoError(t, err)
+		assert.NoError(t, np.Unmarshal(buff[:i]))
+		assert.Equal(t, sn, np.SequenceNumber)
+	}
+	_, err := small.GetPacket(buff, 6)
+	assert.ErrorIs(t, err, errPacketNotFound)
+}
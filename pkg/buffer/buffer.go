@@ -20,6 +20,14 @@ const (
 	maxSN = 1 << 16
 
 	reportDelta = 1e9
+
+	// initialBucketPackets is the size of the adaptive video buckets until the bitrate is known
+	initialBucketPackets = 256
+)
+
+const (
+	FrameMarkingURI         = "urn:ietf:params:rtp-hdrext:framemarking"
+	DependencyDescriptorURI = "https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension"
 )
 
 // Logger is an implementation of logr.Logger. If is not provided - will be turned off.
@@ -42,10 +50,17 @@ type ExtPacket struct {
 // Buffer contains all packets
 type Buffer struct {
 	sync.Mutex
-	bucket     *Bucket
-	nacker     *nackQueue
-	videoPool  *sync.Pool
-	audioPool  *sync.Pool
+	bucket    *Bucket
+	nacker    *nackQueue
+	videoPool *sync.Pool
+	audioPool *sync.Pool
+	// pools allocates the video buckets sized by the bitrate when set
+	pools *bucketPools
+	// retired are the buckets replaced by a resize, released once the packets read
+	// from them are forwarded
+	retired []*[]byte
+	// rtt in ms of the subscribers retransmitting from the buffer
+	rtt        uint32
 	codecType  webrtc.RTPCodecType
 	extPackets deque.Deque
 	pPackets   []pendingPackets
@@ -56,9 +71,21 @@ type Buffer struct {
 	lastReport int64
 	twccExt    uint8
 	audioExt   uint8
-	bound      bool
-	closed     atomicBool
-	mime       string
+	// e2ee is set when the payloads are encrypted, the keyframes are detected from the
+	// frame marking or dependency descriptor extensions.
+	e2ee          bool
+	frameMarkExt  uint8
+	dependencyExt uint8
+	bound         bool
+	closed        atomicBool
+	mime          string
+	// payloadType of the bound codec
+	payloadType uint8
+	// rtx is set when the buffer receives a RTX stream
+	rtx *rtxHelper
+	// reorder holds out of order packets when a reordering window is set
+	reorder       *reorderQueue
+	reorderWindow int64
 
 	// supported feedbacks
 	remb       bool
@@ -108,6 +135,16 @@ type Stats struct {
 // BufferOptions provides configuration options for the buffer
 type Options struct {
 	MaxBitRate uint64
+	// E2EE disables the payload parsing for end to end encrypted tracks
+	E2EE bool
+}
+
+// SetReorderWindow sets the time in ms out of order packets are held waiting for the
+// missing packets, must be called before Bind. Zero disables the reordering.
+func (b *Buffer) SetReorderWindow(ms int) {
+	b.Lock()
+	b.reorderWindow = int64(ms) * 1e6
+	b.Unlock()
 }
 
 // NewBuffer constructs a new Buffer
@@ -130,6 +167,8 @@ func (b *Buffer) Bind(params webrtc.RTPParameters, o Options) {
 	b.clockRate = codec.ClockRate
 	b.maxBitrate = o.MaxBitRate
 	b.mime = strings.ToLower(codec.MimeType)
+	b.payloadType = uint8(codec.PayloadType)
+	b.e2ee = o.E2EE
 
 	switch {
 	case strings.HasPrefix(b.mime, "audio/"):
@@ -137,15 +176,23 @@ func (b *Buffer) Bind(params webrtc.RTPParameters, o Options) {
 		b.bucket = NewBucket(b.audioPool.Get().(*[]byte))
 	case strings.HasPrefix(b.mime, "video/"):
 		b.codecType = webrtc.RTPCodecTypeVideo
-		b.bucket = NewBucket(b.videoPool.Get().(*[]byte))
+		if b.pools != nil {
+			b.bucket = NewBucket(b.pools.get(initialBucketPackets))
+		} else {
+			b.bucket = NewBucket(b.videoPool.Get().(*[]byte))
+		}
 	default:
 		b.codecType = webrtc.RTPCodecType(0)
 	}
 
 	for _, ext := range params.HeaderExtensions {
-		if ext.URI == sdp.TransportCCURI {
+		switch ext.URI {
+		case sdp.TransportCCURI:
 			b.twccExt = uint8(ext.ID)
-			break
+		case FrameMarkingURI:
+			b.frameMarkExt = uint8(ext.ID)
+		case DependencyDescriptorURI:
+			b.dependencyExt = uint8(ext.ID)
 		}
 	}
 
@@ -173,6 +220,10 @@ func (b *Buffer) Bind(params webrtc.RTPParameters, o Options) {
 		}
 	}
 
+	if b.reorderWindow > 0 {
+		b.reorder = newReorderQueue(b.reorderWindow)
+	}
+
 	for _, pp := range b.pPackets {
 		b.calc(pp.packet, pp.arrivalTime)
 	}
@@ -192,6 +243,10 @@ func (b *Buffer) Write(pkt []byte) (n int, err error) {
 		return
 	}
 
+	if b.rtx != nil {
+		return b.writeRTX(pkt)
+	}
+
 	if !b.bound {
 		packet := make([]byte, len(pkt))
 		copy(packet, pkt)
@@ -237,6 +292,16 @@ func (b *Buffer) ReadExtended() (*ExtPacket, error) {
 			return nil, io.EOF
 		}
 		b.Lock()
+		if len(b.retired) > 0 && b.extPackets.Len() == 0 && (b.reorder == nil || len(b.reorder.packets) == 0) {
+			// The packets previously read are forwarded, no packet references the
+			// retired buckets anymore
+			b.releaseRetired()
+		}
+		if b.reorder != nil && b.extPackets.Len() == 0 {
+			for _, rp := range b.reorder.pop(time.Now().UnixNano()) {
+				b.extPackets.PushBack(rp)
+			}
+		}
 		if b.extPackets.Len() > 0 {
 			extPkt := b.extPackets.PopFront().(*ExtPacket)
 			b.Unlock()
@@ -252,8 +317,13 @@ func (b *Buffer) Close() error {
 	defer b.Unlock()
 
 	b.closeOnce.Do(func() {
+		b.releaseRetired()
 		if b.bucket != nil && b.codecType == webrtc.RTPCodecTypeVideo {
-			b.videoPool.Put(b.bucket.src)
+			if b.pools != nil {
+				b.pools.put(b.bucket.src)
+			} else {
+				b.videoPool.Put(b.bucket.src)
+			}
 		}
 		if b.bucket != nil && b.codecType == webrtc.RTPCodecTypeAudio {
 			b.audioPool.Put(b.bucket.src)
@@ -326,15 +396,17 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 		Arrival: arrivalTime,
 	}
 
-	switch b.mime {
-	case "video/vp8":
+	switch {
+	case b.e2ee:
+		ep.KeyFrame = b.isExtensionKeyFrame(&p)
+	case b.mime == "video/vp8":
 		vp8Packet := VP8{}
 		if err := vp8Packet.Unmarshal(p.Payload); err != nil {
 			return
 		}
 		ep.Payload = vp8Packet
 		ep.KeyFrame = vp8Packet.IsKeyFrame
-	case "video/h264":
+	case b.mime == "video/h264":
 		ep.KeyFrame = isH264Keyframe(p.Payload)
 	}
 
@@ -343,8 +415,7 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 			b.baseSN = sn
 		}
 
-		if b.mime == "video/vp8" {
-			pld := ep.Payload.(VP8)
+		if pld, ok := ep.Payload.(VP8); ok {
 			mtl := atomic.LoadInt32(&b.maxTemporalLayer)
 			if mtl < int32(pld.TID) {
 				atomic.StoreInt32(&b.maxTemporalLayer, int32(pld.TID))
@@ -354,7 +425,13 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 		b.minPacketProbe++
 	}
 
-	b.extPackets.PushBack(&ep)
+	if b.reorder != nil {
+		for _, rp := range b.reorder.push(b.extendedSN(sn), &ep, arrivalTime) {
+			b.extPackets.PushBack(rp)
+		}
+	} else {
+		b.extPackets.PushBack(&ep)
+	}
 
 	// if first time update or the timestamp is later (factoring timestamp wrap around)
 	latestTimestamp := atomic.LoadUint32(&b.latestTimestamp)
@@ -401,12 +478,73 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 	if diff >= reportDelta {
 		br := (8 * b.bitrateHelper * uint64(reportDelta)) / uint64(diff)
 		atomic.StoreUint64(&b.bitrate, br)
+		if b.pools != nil && b.codecType == webrtc.RTPCodecTypeVideo {
+			b.resizeBucket(br)
+		}
 		b.feedbackCB(b.getRTCP())
 		b.lastReport = arrivalTime
 		b.bitrateHelper = 0
 	}
 }
 
+// resizeBucket sizes the bucket to keep twice the RTT of packets at the current bitrate,
+// buckets grow as soon as needed and shrink when two size classes too big.
+func (b *Buffer) resizeBucket(bitrate uint64) {
+	if b.stats.PacketCount == 0 {
+		return
+	}
+	avgPacketSize := uint32(b.stats.TotalByte / uint64(b.stats.PacketCount))
+	class := bucketClass(b.pools.packets(bitrate, avgPacketSize, atomic.LoadUint32(&b.rtt)))
+	if class > b.pools.maxPackets {
+		class = b.pools.maxPackets
+	}
+	current := b.bucket.maxSteps + 1
+	if class == current || (class < current && class*4 > current) {
+		return
+	}
+	// Packets in flight still reference the old bucket until they are forwarded, it is
+	// retired until they are.
+	buf := b.pools.get(class)
+	if len(*buf)/maxPktSize == current {
+		// The budget doesn't allow a bigger bucket
+		b.pools.put(buf)
+		return
+	}
+	bucket := NewBucket(buf)
+	b.bucket.copyTo(bucket)
+	b.retired = append(b.retired, b.bucket.src)
+	b.bucket = bucket
+	atomic.AddUint64(&b.pools.resizes, 1)
+}
+
+// releaseRetired returns the retired buckets to the pools
+func (b *Buffer) releaseRetired() {
+	for i, buf := range b.retired {
+		b.pools.put(buf)
+		b.retired[i] = nil
+	}
+	b.retired = b.retired[:0]
+}
+
+// SetRTT updates the round trip time in ms of a subscriber retransmitting packets from
+// the buffer, the buffer keeps the highest RTT decaying slowly.
+func (b *Buffer) SetRTT(rtt uint32) {
+	current := atomic.LoadUint32(&b.rtt)
+	if rtt < current {
+		rtt = (7*current + rtt) / 8
+	}
+	atomic.StoreUint32(&b.rtt, rtt)
+}
+
+// extendedSN returns the sequence number extended with the cycles count, taking in
+// account the packets received out of order from the previous cycle.
+func (b *Buffer) extendedSN(sn uint16) uint32 {
+	if sn > b.maxSeqNo && sn&0x8000 > 0 && b.maxSeqNo&0x8000 == 0 && b.cycles >= maxSN {
+		return (b.cycles - maxSN) | uint32(sn)
+	}
+	return b.cycles | uint32(sn)
+}
+
 func (b *Buffer) buildNACKPacket() []rtcp.Packet {
 	if nacks, askKeyframe := b.nacker.pairs(b.cycles | uint32(b.maxSeqNo)); (nacks != nil && len(nacks) > 0) || askKeyframe {
 		var pkts []rtcp.Packet
@@ -496,6 +634,21 @@ func (b *Buffer) SetSenderReportData(rtpTime uint32, ntpTime uint64) {
 	atomic.StoreInt64(&b.lastSRRecv, time.Now().UnixNano())
 }
 
+// isExtensionKeyFrame detects keyframes of encrypted payloads from the header extensions
+func (b *Buffer) isExtensionKeyFrame(p *rtp.Packet) bool {
+	if b.dependencyExt != 0 {
+		if ext := p.GetExtension(b.dependencyExt); ext != nil {
+			return isDependencyDescriptorKeyFrame(ext)
+		}
+	}
+	if b.frameMarkExt != 0 {
+		if ext := p.GetExtension(b.frameMarkExt); ext != nil {
+			return isFrameMarkingKeyFrame(ext)
+		}
+	}
+	return false
+}
+
 func (b *Buffer) getRTCP() []rtcp.Packet {
 	var pkts []rtcp.Packet
 
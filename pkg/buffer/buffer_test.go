@@ -3,9 +3,11 @@ package buffer
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/pion/ion-sfu/pkg/logger"
 	"github.com/pion/rtcp"
+	"github.com/pion/transport/packetio"
 
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v3"
@@ -182,3 +184,124 @@ func TestNewBuffer(t *testing.T) {
 		})
 	}
 }
+
+func TestRTX(t *testing.T) {
+	factory := NewBufferFactory(100, logger.New())
+	factory.SetRTXPair(123, 456)
+	media := factory.GetOrNew(packetio.RTPBufferPacket, 123).(*Buffer)
+	rtx := factory.GetOrNew(packetio.RTPBufferPacket, 456).(*Buffer)
+	media.Bind(webrtc.RTPParameters{
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:  "video/h264",
+				ClockRate: 90000,
+			},
+			PayloadType: 102,
+		}},
+	}, Options{})
+
+	pkt, err := (&rtp.Packet{
+		Header:  rtp.Header{Version: 2, SSRC: 123, PayloadType: 102, SequenceNumber: 10, Timestamp: 900},
+		Payload: []byte{1, 2, 3},
+	}).Marshal()
+	assert.NoError(t, err)
+	_, err = media.Write(pkt)
+	assert.NoError(t, err)
+
+	pkt, err = (&rtp.Packet{
+		Header:  rtp.Header{Version: 2, SSRC: 456, PayloadType: 103, SequenceNumber: 1, Timestamp: 800},
+		Payload: []byte{0, 9, 4, 5, 6},
+	}).Marshal()
+	assert.NoError(t, err)
+	_, err = rtx.Write(pkt)
+	assert.NoError(t, err)
+
+	// Padding only RTX packets are discarded
+	pkt, err = (&rtp.Packet{
+		Header:      rtp.Header{Version: 2, SSRC: 456, PayloadType: 103, SequenceNumber: 2, Timestamp: 800},
+		PaddingSize: 100,
+	}).Marshal()
+	assert.NoError(t, err)
+	_, err = rtx.Write(pkt)
+	assert.NoError(t, err)
+
+	ep, err := media.ReadExtended()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(10), ep.Packet.SequenceNumber)
+	ep, err = media.ReadExtended()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(123), ep.Packet.SSRC)
+	assert.Equal(t, uint8(102), ep.Packet.PayloadType)
+	assert.Equal(t, uint16(9), ep.Packet.SequenceNumber)
+	assert.Equal(t, uint32(800), ep.Packet.Timestamp)
+	assert.Equal(t, []byte{4, 5, 6}, ep.Packet.Payload)
+	assert.False(t, ep.Head)
+	assert.Equal(t, 0, media.extPackets.Len())
+}
+
+func TestFactory_ForTransport(t *testing.T) {
+	factory := NewBufferFactory(100, logger.New())
+	var collisions []uint32
+	factory.OnSSRCCollision(func(ssrc uint32) {
+		collisions = append(collisions, ssrc)
+	})
+	t1, t2 := factory.ForTransport(), factory.ForTransport()
+
+	b1 := t1.GetOrNew(packetio.RTPBufferPacket, 123).(*Buffer)
+	b2 := t2.GetOrNew(packetio.RTPBufferPacket, 123).(*Buffer)
+	assert.NotSame(t, b1, b2)
+	assert.Same(t, b1, t1.GetBuffer(123))
+	assert.Nil(t, factory.GetBuffer(123))
+	assert.Equal(t, []uint32{123}, collisions)
+
+	assert.NoError(t, b2.Close())
+	assert.Nil(t, t2.GetBuffer(123))
+	t2.GetOrNew(packetio.RTPBufferPacket, 456)
+	assert.Equal(t, []uint32{123}, collisions)
+}
+
+func TestBuffer_resizeBucket(t *testing.T) {
+	pool := &sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, 1500)
+			return &b
+		},
+	}
+	buff := NewBuffer(123, pool, pool, logger.New())
+	buff.pools = newBucketPools(1024)
+	buff.OnFeedback(func(_ []rtcp.Packet) {})
+	buff.OnClose(func() {})
+	buff.Bind(webrtc.RTPParameters{
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/vp8", ClockRate: 90000},
+		}},
+	}, Options{})
+	defer buff.Close()
+
+	for _, p := range CreateTestListPackets([]SequenceNumberAndTimeStamp{{1, 1}, {2, 1}, {3, 1}}) {
+		buf, err := p.Marshal()
+		assert.NoError(t, err)
+		_, err = buff.Write(buf)
+		assert.NoError(t, err)
+	}
+	buff.Lock()
+	buff.resizeBucket(1e9)
+	buff.Unlock()
+	// The packets queued to be read still reference the old bucket
+	assert.Equal(t, int64(2), buff.pools.stats().Buckets)
+	assert.Equal(t, uint64(1), buff.pools.stats().Resizes)
+
+	for sn := uint16(1); sn <= 3; sn++ {
+		ep, err := buff.ReadExtended()
+		assert.NoError(t, err)
+		assert.Equal(t, sn, ep.Packet.SequenceNumber)
+		assert.Equal(t, []byte{1, 2, 3}, ep.Packet.Payload)
+		assert.Equal(t, int64(2), buff.pools.stats().Buckets)
+	}
+
+	// The old bucket is released once the read packets are forwarded
+	go buff.ReadExtended()
+	assert.Eventually(t, func() bool {
+		return buff.pools.stats().Buckets == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -14,7 +14,18 @@ type Factory struct {
 	audioPool   *sync.Pool
 	rtpBuffers  map[uint32]*Buffer
 	rtcpReaders map[uint32]*RTCPReader
+	rtxPairs    map[uint32]uint32 // RTX SSRC -> media SSRC
 	logger      logr.Logger
+	// reorderWindow in ms set to the new buffers
+	reorderWindow int
+	// parent is the factory a transport factory was created from
+	parent *Factory
+	// ssrcs counts the RTP buffers of the transport factories by SSRC
+	ssrcs       map[uint32]int
+	onCollision func(ssrc uint32)
+	// pools allocates the adaptive video buckets
+	pools    *bucketPools
+	adaptive bool
 }
 
 func NewBufferFactory(trackingPackets int, logger logr.Logger) *Factory {
@@ -42,10 +53,84 @@ func NewBufferFactory(trackingPackets int, logger logr.Logger) *Factory {
 		},
 		rtpBuffers:  make(map[uint32]*Buffer),
 		rtcpReaders: make(map[uint32]*RTCPReader),
+		rtxPairs:    make(map[uint32]uint32),
+		ssrcs:       make(map[uint32]int),
+		pools:       newBucketPools(trackingPackets),
 		logger:      logger,
 	}
 }
 
+// SetAdaptiveBuckets sizes the video buckets of the new buffers by the stream bitrate
+// and the subscribers RTT, up to the tracked packets of the factory.
+func (f *Factory) SetAdaptiveBuckets(enabled bool) {
+	f.Lock()
+	f.adaptive = enabled
+	f.Unlock()
+}
+
+// SetMemoryBudget sets the max memory in bytes of the adaptive video buckets of the
+// factory and its transport factories, zero means unlimited.
+func (f *Factory) SetMemoryBudget(bytes int64) {
+	f.pools.setBudget(bytes)
+}
+
+// PoolStats returns the usage of the adaptive video buckets
+func (f *Factory) PoolStats() PoolStats {
+	return f.pools.stats()
+}
+
+// ForTransport returns a factory for the streams of a single transport, sharing the
+// packet pools and settings of f. Streams of different transports using the same SSRC
+// get their own buffers, the collisions are reported to the OnSSRCCollision handler.
+func (f *Factory) ForTransport() *Factory {
+	f.RLock()
+	defer f.RUnlock()
+	return &Factory{
+		videoPool:     f.videoPool,
+		audioPool:     f.audioPool,
+		rtpBuffers:    make(map[uint32]*Buffer),
+		rtcpReaders:   make(map[uint32]*RTCPReader),
+		rtxPairs:      make(map[uint32]uint32),
+		logger:        f.logger,
+		reorderWindow: f.reorderWindow,
+		parent:        f,
+		pools:         f.pools,
+		adaptive:      f.adaptive,
+	}
+}
+
+// OnSSRCCollision sets the handler called when a transport factory creates a buffer for
+// a SSRC already used by another transport.
+func (f *Factory) OnSSRCCollision(fn func(ssrc uint32)) {
+	f.Lock()
+	f.onCollision = fn
+	f.Unlock()
+}
+
+func (f *Factory) addSSRC(ssrc uint32) {
+	f.Lock()
+	f.ssrcs[ssrc]++
+	collision := f.ssrcs[ssrc] > 1
+	fn := f.onCollision
+	f.Unlock()
+	if collision {
+		f.logger.V(1).Info("SSRC used by several transports", "ssrc", ssrc)
+		if fn != nil {
+			fn(ssrc)
+		}
+	}
+}
+
+func (f *Factory) removeSSRC(ssrc uint32) {
+	f.Lock()
+	if f.ssrcs[ssrc] > 1 {
+		f.ssrcs[ssrc]--
+	} else {
+		delete(f.ssrcs, ssrc)
+	}
+	f.Unlock()
+}
+
 func (f *Factory) GetOrNew(packetType packetio.BufferPacketType, ssrc uint32) io.ReadWriteCloser {
 	f.Lock()
 	defer f.Unlock()
@@ -67,11 +152,26 @@ func (f *Factory) GetOrNew(packetType packetio.BufferPacketType, ssrc uint32) io
 			return reader
 		}
 		buffer := NewBuffer(ssrc, f.videoPool, f.audioPool, f.logger)
+		buffer.SetReorderWindow(f.reorderWindow)
+		if f.adaptive {
+			buffer.pools = f.pools
+		}
 		f.rtpBuffers[ssrc] = buffer
+		if mediaSSRC, ok := f.rtxPairs[ssrc]; ok {
+			buffer.setRTX(mediaSSRC, f.GetBuffer)
+		}
+		// Transport factories lock their parent while locked, never the opposite
+		if f.parent != nil {
+			f.parent.addSSRC(ssrc)
+		}
 		buffer.OnClose(func() {
 			f.Lock()
 			delete(f.rtpBuffers, ssrc)
+			delete(f.rtxPairs, ssrc)
 			f.Unlock()
+			if f.parent != nil {
+				f.parent.removeSSRC(ssrc)
+			}
 		})
 		return buffer
 	}
@@ -95,3 +195,23 @@ func (f *Factory) GetRTCPReader(ssrc uint32) *RTCPReader {
 	defer f.RUnlock()
 	return f.rtcpReaders[ssrc]
 }
+
+// SetRTXPair sets the RTX stream repairing a media stream, packets received on the
+// RTX SSRC are restored and written into the media buffer.
+func (f *Factory) SetRTXPair(mediaSSRC, rtxSSRC uint32) {
+	f.Lock()
+	f.rtxPairs[rtxSSRC] = mediaSSRC
+	buffer := f.rtpBuffers[rtxSSRC]
+	f.Unlock()
+	// Buffers lock the factory on close, never lock a buffer holding the factory lock
+	if buffer != nil {
+		buffer.setRTX(mediaSSRC, f.GetBuffer)
+	}
+}
+
+// SetReorderWindow sets the reordering window in ms of the buffers created by the factory
+func (f *Factory) SetReorderWindow(ms int) {
+	f.Lock()
+	f.reorderWindow = ms
+	f.Unlock()
+}
@@ -143,6 +143,26 @@ func (p *VP8) Unmarshal(payload []byte) error {
 	return nil
 }
 
+// isFrameMarkingKeyFrame detects if the frame marking extension belongs to the first
+// packet of an independent frame.
+func isFrameMarkingKeyFrame(ext []byte) bool {
+	if len(ext) < 1 {
+		return false
+	}
+	// S and I bits
+	return ext[0]&0xa0 == 0xa0
+}
+
+// isDependencyDescriptorKeyFrame detects if the dependency descriptor extension belongs
+// to the first packet of a keyframe, keyframes carry the template dependency structure.
+func isDependencyDescriptorKeyFrame(ext []byte) bool {
+	if len(ext) < 4 {
+		return false
+	}
+	// start_of_frame and template_dependency_structure_present_flag bits
+	return ext[0]&0x80 != 0 && ext[3]&0x80 != 0
+}
+
 // isH264Keyframe detects if h264 payload is a keyframe
 // this code was taken from https://github.com/jech/galene/blob/codecs/rtpconn/rtpreader.go#L45
 // all credits belongs to Juliusz Chroboczek @jech and the awesome Galene SFU
@@ -92,3 +92,66 @@ func TestVP8Helper_Unmarshal(t *testing.T) {
 		})
 	}
 }
+
+func Test_isFrameMarkingKeyFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  []byte
+		want bool
+	}{
+		{
+			name: "Must detect start of independent frame",
+			ext:  []byte{0xa0},
+			want: true,
+		},
+		{
+			name: "Must ignore independent frame continuation",
+			ext:  []byte{0x20},
+		},
+		{
+			name: "Must ignore start of dependent frame",
+			ext:  []byte{0x80},
+		},
+		{
+			name: "Must ignore empty extension",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isFrameMarkingKeyFrame(tt.ext))
+		})
+	}
+}
+
+func Test_isDependencyDescriptorKeyFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  []byte
+		want bool
+	}{
+		{
+			name: "Must detect start of frame with dependency structure",
+			ext:  []byte{0x80, 0x00, 0x01, 0x80, 0x00},
+			want: true,
+		},
+		{
+			name: "Must ignore frames without dependency structure",
+			ext:  []byte{0x80, 0x00, 0x01, 0x00},
+		},
+		{
+			name: "Must ignore mandatory fields only",
+			ext:  []byte{0x80, 0x00, 0x01},
+		},
+		{
+			name: "Must ignore packets not starting the frame",
+			ext:  []byte{0x40, 0x00, 0x01, 0x80},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isDependencyDescriptorKeyFrame(tt.ext))
+		})
+	}
+}
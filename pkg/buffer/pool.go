@@ -0,0 +1,134 @@
+package buffer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// minBucketPackets is the smallest video bucket size
+	minBucketPackets = 64
+	// defaultRTT in ms used to size the buckets until the RTT is known
+	defaultRTT = 250
+)
+
+// PoolStats are the usage statistics of the video bucket pools
+type PoolStats struct {
+	// InUseBytes is the memory held by the buffers buckets
+	InUseBytes int64
+	// BudgetBytes is the max memory of the buckets, zero means unlimited
+	BudgetBytes int64
+	// Buckets is the number of buckets in use
+	Buckets int64
+	// Resizes is the number of buckets resized to follow the stream bitrate
+	Resizes uint64
+	// OverBudget is the number of buckets allocated smaller than needed or over the
+	// budget, the min bucket is always allocated.
+	OverBudget uint64
+}
+
+// bucketPools allocates the video buckets by size classes of power of two packets,
+// keeping the memory of all the buckets under a budget.
+type bucketPools struct {
+	sync.Mutex
+	pools      map[int]*sync.Pool
+	maxPackets int
+	budget     int64
+
+	inUse      int64
+	buckets    int64
+	resizes    uint64
+	overBudget uint64
+}
+
+func newBucketPools(maxPackets int) *bucketPools {
+	return &bucketPools{
+		pools:      make(map[int]*sync.Pool),
+		maxPackets: bucketClass(maxPackets),
+	}
+}
+
+// bucketClass rounds up the packets to the size class
+func bucketClass(packets int) int {
+	class := minBucketPackets
+	for class < packets {
+		class <<= 1
+	}
+	return class
+}
+
+func (p *bucketPools) setBudget(bytes int64) {
+	atomic.StoreInt64(&p.budget, bytes)
+}
+
+// get returns a bucket memory for the given packets, the size is reduced to fit in the
+// memory budget.
+func (p *bucketPools) get(packets int) *[]byte {
+	class := bucketClass(packets)
+	if class > p.maxPackets {
+		class = p.maxPackets
+	}
+	if budget := atomic.LoadInt64(&p.budget); budget > 0 {
+		inUse := atomic.LoadInt64(&p.inUse)
+		reduced := class
+		for reduced > minBucketPackets && inUse+int64(reduced*maxPktSize) > budget {
+			reduced >>= 1
+		}
+		if reduced != class || inUse+int64(reduced*maxPktSize) > budget {
+			atomic.AddUint64(&p.overBudget, 1)
+		}
+		class = reduced
+	}
+
+	p.Lock()
+	pool, ok := p.pools[class]
+	if !ok {
+		size := class * maxPktSize
+		pool = &sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, size)
+				return &b
+			},
+		}
+		p.pools[class] = pool
+	}
+	p.Unlock()
+
+	buf := pool.Get().(*[]byte)
+	atomic.AddInt64(&p.inUse, int64(len(*buf)))
+	atomic.AddInt64(&p.buckets, 1)
+	return buf
+}
+
+func (p *bucketPools) put(buf *[]byte) {
+	p.Lock()
+	pool, ok := p.pools[len(*buf)/maxPktSize]
+	p.Unlock()
+	atomic.AddInt64(&p.inUse, -int64(len(*buf)))
+	atomic.AddInt64(&p.buckets, -1)
+	if ok {
+		pool.Put(buf)
+	}
+}
+
+// packets returns the bucket size keeping the packets sent at the bitrate during
+// twice the RTT, so retransmissions can be served within the NACK round trip.
+func (p *bucketPools) packets(bitrate uint64, avgPacketSize, rtt uint32) int {
+	if avgPacketSize == 0 {
+		return minBucketPackets
+	}
+	if rtt == 0 {
+		rtt = defaultRTT
+	}
+	return int(bitrate / 8 * 2 * uint64(rtt) / 1000 / uint64(avgPacketSize))
+}
+
+func (p *bucketPools) stats() PoolStats {
+	return PoolStats{
+		InUseBytes:  atomic.LoadInt64(&p.inUse),
+		BudgetBytes: atomic.LoadInt64(&p.budget),
+		Buckets:     atomic.LoadInt64(&p.buckets),
+		Resizes:     atomic.LoadUint64(&p.resizes),
+		OverBudget:  atomic.LoadUint64(&p.overBudget),
+	}
+}
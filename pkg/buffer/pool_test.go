@@ -0,0 +1,56 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bucketClass(t *testing.T) {
+	tests := []struct {
+		packets int
+		want    int
+	}{
+		{packets: 0, want: minBucketPackets},
+		{packets: 64, want: 64},
+		{packets: 65, want: 128},
+		{packets: 500, want: 512},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, bucketClass(tt.packets))
+	}
+}
+
+func Test_bucketPoolsPackets(t *testing.T) {
+	p := newBucketPools(500)
+	// 2.4 Mbps of 1200 bytes packets is 250 packets per second
+	assert.Equal(t, 100, p.packets(2400000, 1200, 200))
+	assert.Equal(t, 125, p.packets(2400000, 1200, 0))
+	assert.Equal(t, minBucketPackets, p.packets(2400000, 0, 200))
+}
+
+func Test_bucketPoolsBudget(t *testing.T) {
+	p := newBucketPools(500)
+	assert.Equal(t, 512, p.maxPackets)
+
+	buf := p.get(1000)
+	assert.Equal(t, 512*maxPktSize, len(*buf))
+
+	p.setBudget(int64(640 * maxPktSize))
+	small := p.get(512)
+	assert.Equal(t, 128*maxPktSize, len(*small))
+	min := p.get(512)
+	assert.Equal(t, minBucketPackets*maxPktSize, len(*min))
+
+	stats := p.stats()
+	assert.Equal(t, int64(3), stats.Buckets)
+	assert.Equal(t, int64(704*maxPktSize), stats.InUseBytes)
+	assert.Equal(t, uint64(2), stats.OverBudget)
+
+	p.put(buf)
+	p.put(small)
+	p.put(min)
+	stats = p.stats()
+	assert.Equal(t, int64(0), stats.Buckets)
+	assert.Equal(t, int64(0), stats.InUseBytes)
+}
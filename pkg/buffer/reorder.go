@@ -0,0 +1,65 @@
+package buffer
+
+// reorderQueue holds the packets received out of order until the gaps are filled or
+// the reordering window of the oldest packet expires, packets are released ordered
+// by their extended sequence number.
+type reorderQueue struct {
+	window  int64
+	packets []*reorderPacket
+	nextSN  uint32
+	started bool
+}
+
+type reorderPacket struct {
+	extSN  uint32
+	packet *ExtPacket
+}
+
+func newReorderQueue(window int64) *reorderQueue {
+	return &reorderQueue{window: window}
+}
+
+// push adds a packet to the queue and returns the packets ready to be forwarded
+func (q *reorderQueue) push(extSN uint32, ep *ExtPacket, now int64) []*ExtPacket {
+	if !q.started {
+		q.started = true
+		q.nextSN = extSN
+	}
+	if extSN < q.nextSN {
+		// The window already expired for this packet, forward it as out of order
+		ep.Head = false
+		return append([]*ExtPacket{ep}, q.pop(now)...)
+	}
+
+	idx := len(q.packets)
+	for idx > 0 && q.packets[idx-1].extSN >= extSN {
+		if q.packets[idx-1].extSN == extSN {
+			// Duplicated packet
+			return q.pop(now)
+		}
+		idx--
+	}
+	q.packets = append(q.packets, nil)
+	copy(q.packets[idx+1:], q.packets[idx:])
+	q.packets[idx] = &reorderPacket{extSN: extSN, packet: ep}
+
+	return q.pop(now)
+}
+
+// pop returns the consecutive packets from the next expected sequence number, gaps
+// are skipped once the oldest packet waited longer than the window.
+func (q *reorderQueue) pop(now int64) []*ExtPacket {
+	var released []*ExtPacket
+	for len(q.packets) > 0 {
+		p := q.packets[0]
+		if p.extSN != q.nextSN && now-p.packet.Arrival < q.window {
+			break
+		}
+		p.packet.Head = true
+		released = append(released, p.packet)
+		q.nextSN = p.extSN + 1
+		q.packets[0] = nil
+		q.packets = q.packets[1:]
+	}
+	return released
+}
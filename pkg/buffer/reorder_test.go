@@ -0,0 +1,67 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_reorderQueue(t *testing.T) {
+	type push struct {
+		sn      uint32
+		arrival int64
+		want    []uint32
+	}
+	tests := []struct {
+		name   string
+		pushes []push
+	}{
+		{
+			name: "Must release in order packets",
+			pushes: []push{
+				{sn: 1, arrival: 0, want: []uint32{1}},
+				{sn: 2, arrival: 1, want: []uint32{2}},
+			},
+		},
+		{
+			name: "Must hold packets until gap is filled",
+			pushes: []push{
+				{sn: 1, arrival: 0, want: []uint32{1}},
+				{sn: 3, arrival: 1, want: nil},
+				{sn: 4, arrival: 2, want: nil},
+				{sn: 2, arrival: 3, want: []uint32{2, 3, 4}},
+			},
+		},
+		{
+			name: "Must skip gaps after window",
+			pushes: []push{
+				{sn: 1, arrival: 0, want: []uint32{1}},
+				{sn: 3, arrival: 1, want: nil},
+				{sn: 4, arrival: 20, want: []uint32{3, 4}},
+				{sn: 2, arrival: 21, want: []uint32{2}},
+			},
+		},
+		{
+			name: "Must drop duplicated packets",
+			pushes: []push{
+				{sn: 1, arrival: 0, want: []uint32{1}},
+				{sn: 3, arrival: 1, want: nil},
+				{sn: 3, arrival: 2, want: nil},
+				{sn: 2, arrival: 3, want: []uint32{2, 3}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			q := newReorderQueue(10)
+			for _, p := range tt.pushes {
+				var got []uint32
+				for _, ep := range q.push(p.sn, &ExtPacket{Arrival: p.arrival, Cycle: p.sn}, p.arrival) {
+					got = append(got, ep.Cycle)
+				}
+				assert.Equal(t, p.want, got)
+			}
+		})
+	}
+}
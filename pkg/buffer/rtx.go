@@ -0,0 +1,74 @@
+package buffer
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// rtxHelper de-encapsulates the RFC 4588 retransmissions received on a RTX
+// stream into the buffer of the repaired media stream.
+type rtxHelper struct {
+	mediaSSRC uint32
+	media     *Buffer
+	lookup    func(ssrc uint32) *Buffer
+}
+
+func (b *Buffer) setRTX(mediaSSRC uint32, lookup func(ssrc uint32) *Buffer) {
+	b.Lock()
+	b.rtx = &rtxHelper{
+		mediaSSRC: mediaSSRC,
+		lookup:    lookup,
+	}
+	b.Unlock()
+}
+
+// writeRTX restores the original packet from a retransmission and writes it into
+// the media buffer, padding only packets used for probing are discarded.
+func (b *Buffer) writeRTX(pkt []byte) (n int, err error) {
+	n = len(pkt)
+	if b.rtx.media == nil {
+		if b.rtx.media = b.rtx.lookup(b.rtx.mediaSSRC); b.rtx.media == nil {
+			return
+		}
+	}
+
+	var p rtp.Packet
+	if err = p.Unmarshal(pkt); err != nil {
+		return
+	}
+	if len(p.Payload) < 2 {
+		return
+	}
+	p.Header.SSRC = b.rtx.mediaSSRC
+	p.Header.SequenceNumber = binary.BigEndian.Uint16(p.Payload)
+	p.Header.Padding = false
+	p.PaddingSize = 0
+	p.Payload = p.Payload[2:]
+
+	err = b.rtx.media.writeRepaired(&p)
+	return
+}
+
+// writeRepaired adds a packet restored from a repair stream
+func (b *Buffer) writeRepaired(p *rtp.Packet) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed.get() {
+		return nil
+	}
+	if !b.bound {
+		// Packets are only repaired after the media is flowing
+		return nil
+	}
+
+	p.Header.PayloadType = b.payloadType
+	pkt, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	b.calc(pkt, time.Now().UnixNano())
+	return nil
+}
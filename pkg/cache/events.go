@@ -0,0 +1,43 @@
+package cacheredis
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pion/ion-sfu/pkg/sfu"
+)
+
+// EventStream adds the SFU events to a redis stream
+type EventStream struct {
+	stream string
+	maxLen int64
+}
+
+// NewEventStream creates a sink adding the events to the stream, the stream is
+// trimmed to about maxLen entries when not zero.
+func NewEventStream(stream string, maxLen int64) *EventStream {
+	return &EventStream{stream: stream, maxLen: maxLen}
+}
+
+// Send implements sfu.EventSink
+func (s *EventStream) Send(e sfu.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: map[string]interface{}{
+			"type":    string(e.Type),
+			"session": e.SessionID,
+			"event":   data,
+		},
+	}).Err()
+}
+
+// Close implements sfu.EventSink
+func (s *EventStream) Close() error {
+	return nil
+}
@@ -0,0 +1,24 @@
+package cacheredis
+
+import "github.com/go-redis/redis/v8"
+
+// MeshRegistry reads the mesh nodes of the sessions from redis, the key of a session
+// holds the JSON list of its nodes.
+type MeshRegistry struct {
+	prefix string
+}
+
+// NewMeshRegistry creates a registry reading the nodes of a session from the prefix
+// followed by the session id.
+func NewMeshRegistry(prefix string) *MeshRegistry {
+	return &MeshRegistry{prefix: prefix}
+}
+
+// Nodes returns the nodes of the session, it implements sfu.MeshNodesFunc
+func (r *MeshRegistry) Nodes(sid string) ([]string, error) {
+	nodes, err := GetCacheRedis(r.prefix + sid)
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return nodes, err
+}
@@ -23,6 +23,8 @@ type setRemoteMedia struct {
 	Framerate string   `json:"framerate"`
 	Audio     bool     `json:"audio"`
 	Layers    []string `json:"layers"`
+	// Pinned replaces the streams forwarded regardless of the last-N selection
+	Pinned []string `json:"pinned"`
 }
 
 type activeLayerMessage struct {
@@ -97,6 +99,9 @@ func SubscriberAPI(next sfu.MessageProcessor) sfu.MessageProcessor {
 		if err := json.Unmarshal(args.Message.Data, srm); err != nil {
 			return
 		}
+		if srm.Pinned != nil {
+			args.Peer.Subscriber().SetPinnedStreams(srm.Pinned...)
+		}
 		// Publisher changing active layers
 		if srm.Layers != nil && len(srm.Layers) > 0 {
 			layers, err := transformLayers(srm.Layers)
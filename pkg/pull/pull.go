@@ -2,11 +2,14 @@ package pull
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	_ "net/http/pprof"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
@@ -14,10 +17,19 @@ import (
 
 	"github.com/pion/ion-sfu/cmd/signal/json-rpc/server"
 	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/pion/ion-sfu/pkg/stats"
+	"github.com/pion/ion-sfu/pkg/tracing"
 	"github.com/pion/webrtc/v3"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+const (
+	// reconnectDelay is the delay before connecting again to the origin
+	reconnectDelay = 2 * time.Second
+	// pingInterval is the interval of the pings measuring the origin RTT
+	pingInterval = 5 * time.Second
+)
+
 type Candidate struct {
 	Target    int                  `json:"target"`
 	Candidate *webrtc.ICECandidate `json:"candidate"`
@@ -35,8 +47,8 @@ type TrickleResponse struct {
 	Method string         `json:"method"`
 }
 
-func readMessage(c *websocket.Conn, p *server.JSONSignal, logger logr.Logger, done chan struct{}) {
-	//defer close(done)
+func readMessage(ctx context.Context, c *websocket.Conn, p *server.JSONSignal, logger logr.Logger, done chan struct{}) {
+	defer close(done)
 	for {
 		_, mess, errRead := c.ReadMessage()
 		if errRead != nil {
@@ -46,14 +58,19 @@ func readMessage(c *websocket.Conn, p *server.JSONSignal, logger logr.Logger, do
 		json.Unmarshal(mess, &response)
 		if response.Result != nil {
 			fmt.Println("got answer")
+			_, span := tracing.Start(ctx, "pull.answer")
 			result := *response.Result
 			if err := p.SetRemoteDescription(result); err != nil {
+				span.RecordError(err)
 				logger.Error(err, "Err set remote answer")
 			}
+			span.End()
 		} else if response.Method == "offer" {
 			fmt.Println("got offer")
-			answer, err := p.Answer(*response.Params)
+			offerCtx, span := tracing.Start(ctx, "pull.offer")
+			answer, err := p.AnswerContext(offerCtx, *response.Params)
 			if err != nil {
+				span.RecordError(err)
 				logger.Error(err, "Err create ans")
 			}
 
@@ -75,11 +92,13 @@ func readMessage(c *websocket.Conn, p *server.JSONSignal, logger logr.Logger, do
 					Num:      connectionID,
 				},
 			}
+			_ = answerMessage.SetMeta(server.RequestMeta{Traceparent: tracing.Inject(offerCtx)})
 
 			reqBodyBytes := new(bytes.Buffer)
 			json.NewEncoder(reqBodyBytes).Encode(answerMessage)
 			messageBytes := reqBodyBytes.Bytes()
 			c.WriteMessage(websocket.TextMessage, messageBytes)
+			span.End()
 		} else if response.Method == "trickle" {
 
 			var trickleResponse TrickleResponse
@@ -95,10 +114,14 @@ func readMessage(c *websocket.Conn, p *server.JSONSignal, logger logr.Logger, do
 	}
 }
 
-func createConnWs(address string, logger logr.Logger) *websocket.Conn {
+func originAddress(address string) string {
 	var addrConn string
 	flag.StringVar(&addrConn, "add", address, "address to use")
 	flag.Parse()
+	return addrConn
+}
+
+func createConnWs(addrConn string, logger logr.Logger) *websocket.Conn {
 	u := url.URL{Scheme: "ws", Host: addrConn, Path: "/ws"}
 	logger.Info("connecting to", u.String())
 	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
@@ -173,7 +196,13 @@ func createPeer(peerLocal *sfu.PeerLocal, c *websocket.Conn, logger logr.Logger)
 	return p
 }
 
-func sendOfferJoin(pc *webrtc.PeerConnection, c *websocket.Conn, logger logr.Logger) error {
+func sendOfferJoin(ctx context.Context, pc *webrtc.PeerConnection, c *websocket.Conn, logger logr.Logger) (err error) {
+	ctx, span := tracing.Start(ctx, "pull.sendOfferJoin")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	offer, err := pc.CreateOffer(nil)
 
 	errSetDps := pc.SetLocalDescription(offer)
@@ -207,6 +236,7 @@ func sendOfferJoin(pc *webrtc.PeerConnection, c *websocket.Conn, logger logr.Log
 			Num:      connectionID,
 		},
 	}
+	_ = offerMessage.SetMeta(server.RequestMeta{Traceparent: tracing.Inject(ctx)})
 	reqBodyBytes := new(bytes.Buffer)
 	json.NewEncoder(reqBodyBytes).Encode(offerMessage)
 
@@ -215,26 +245,104 @@ func sendOfferJoin(pc *webrtc.PeerConnection, c *websocket.Conn, logger logr.Log
 	return nil
 }
 
-func ConnectOrigin(s *sfu.SFU, logger logr.Logger) {
-	c := createConnWs("localhost:7070", logger)
+// monitorLink measures the RTT to the origin with websocket pings and the lost rate of
+// the packets received from the origin, until done is closed.
+func monitorLink(c *websocket.Conn, pc *webrtc.PeerConnection, link *stats.PullMetrics, done chan struct{}) {
+	c.SetPongHandler(func(appData string) error {
+		if sent, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			link.ObserveRTT(time.Duration(time.Now().UnixNano() - sent))
+		}
+		return nil
+	})
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if err := c.WriteControl(websocket.PingMessage, []byte(strconv.FormatInt(now.UnixNano(), 10)),
+				now.Add(pingInterval)); err != nil {
+				return
+			}
+			var lost, received float64
+			for _, s := range pc.GetStats() {
+				if in, ok := s.(webrtc.InboundRTPStreamStats); ok {
+					lost += float64(in.PacketsLost)
+					received += float64(in.PacketsReceived)
+				}
+			}
+			if lost+received > 0 {
+				link.ObserveLostRate(lost / (lost + received))
+			}
+		}
+	}
+}
+
+func connectOrigin(s *sfu.SFU, address string, link *stats.PullMetrics, drain chan struct{}, logger logr.Logger) {
+	c := createConnWs(address, logger)
+	if c == nil {
+		return
+	}
 	defer c.Close()
 
 	p := createPeer(sfu.NewPeer(s), c, logger)
 	defer p.Close()
 
-	p.Join("test room", "pull", sfu.JoinConfig{
+	ctx, span := tracing.Start(context.Background(), "pull.ConnectOrigin")
+	span.SetAttribute("origin", address)
+
+	p.JoinContext(ctx, "test room", "pull", sfu.JoinConfig{
 		NoPublish:       false,
 		NoSubscribe:     false,
 		NoAutoSubscribe: false,
+		NoRelay:         true,
 	})
 
 	pc := p.Subscriber().GetPeerConnection()
 
 	done := make(chan struct{})
 
-	go readMessage(c, p, logger, done)
+	go readMessage(ctx, c, p, logger, done)
+	go monitorLink(c, pc, link, done)
+
+	span.RecordError(sendOfferJoin(ctx, pc, c, logger))
+	span.End()
 
-	sendOfferJoin(pc, c, logger)
+	pull := sfu.Event{
+		SessionID: "test room",
+		PeerID:    "pull",
+		Attrs:     map[string]string{"origin": address},
+	}
+	pull.Type = sfu.EventPullStarted
+	s.Events().Emit(pull)
 
-	<-done
+	select {
+	case <-done:
+	case <-drain:
+	}
+
+	pull.Type = sfu.EventPullStopped
+	s.Events().Emit(pull)
+}
+
+// ConnectOrigin pulls the streams of the origin SFU, connecting again when the link
+// to the origin is lost. It returns when the SFU drains.
+func ConnectOrigin(s *sfu.SFU, logger logr.Logger) {
+	address := originAddress("localhost:7070")
+	link := s.Metrics().PullLink(address)
+	drain := make(chan struct{})
+	s.OnDrain(func() { close(drain) })
+	for {
+		connectOrigin(s, address, link, drain, logger)
+		select {
+		case <-drain:
+			logger.Info("stopped pulling from origin, SFU draining", "address", address)
+			return
+		case <-time.After(reconnectDelay):
+		}
+		logger.Info("reconnecting to origin", "address", address)
+		link.Reconnect()
+	}
 }
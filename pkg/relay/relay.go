@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/pion/ion-sfu/pkg/tracing"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 )
@@ -41,6 +42,8 @@ type request struct {
 	IsReply bool   `json:"reply"`
 	Event   string `json:"event"`
 	Payload []byte `json:"payload"`
+	// Traceparent propagates the span of the request to the remote peer
+	Traceparent string `json:"traceparent,omitempty"`
 }
 
 type TrackMeta struct {
@@ -509,11 +512,22 @@ func (p *Peer) Emit(event string, data []byte) error {
 	return p.signalingDC.Send(msg)
 }
 
-func (p *Peer) Request(ctx context.Context, event string, data []byte) ([]byte, error) {
+// Request sends the data argument to remote peer and waits for its reply, the span of
+// ctx is propagated to the remote peer.
+func (p *Peer) Request(ctx context.Context, event string, data []byte) (res []byte, err error) {
+	ctx, span := tracing.Start(ctx, "relay.Request")
+	span.SetAttribute("event", event)
+	span.SetAttribute("peer_id", p.meta.PeerID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	req := request{
-		ID:      p.rand.Uint64(),
-		Event:   event,
-		Payload: data,
+		ID:          p.rand.Uint64(),
+		Event:       event,
+		Payload:     data,
+		Traceparent: tracing.Inject(ctx),
 	}
 
 	msg, err := json.Marshal(req)
@@ -552,7 +566,22 @@ func (p *Peer) handleRequest(msg webrtc.DataChannelMessage) {
 		return
 	}
 
-	if mr.Event == signalerRequestEvent && !mr.IsReply {
+	if mr.IsReply {
+		p.rmu.Lock()
+		if c, ok := p.pendingRequests[mr.ID]; ok {
+			c <- mr.Payload
+			delete(p.pendingRequests, mr.ID)
+		}
+		p.rmu.Unlock()
+		return
+	}
+
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), mr.Traceparent), "relay.HandleRequest")
+	span.SetAttribute("event", mr.Event)
+	span.SetAttribute("peer_id", p.meta.PeerID)
+	defer span.End()
+
+	if mr.Event == signalerRequestEvent {
 		p.mu.Lock()
 		defer p.mu.Unlock()
 
@@ -562,6 +591,7 @@ func (p *Peer) handleRequest(msg webrtc.DataChannelMessage) {
 			return
 		}
 		if err := p.receive(r); err != nil {
+			span.RecordError(err)
 			p.log.Error(err, "Error receiving remote track", "peer_id", p.meta.PeerID, "session_id", p.meta.SessionID)
 			return
 		}
@@ -573,28 +603,15 @@ func (p *Peer) handleRequest(msg webrtc.DataChannelMessage) {
 		return
 	}
 
-	if mr.IsReply {
-		p.rmu.Lock()
-		if c, ok := p.pendingRequests[mr.ID]; ok {
-			c <- mr.Payload
-			delete(p.pendingRequests, mr.ID)
-		}
-		p.rmu.Unlock()
-		return
+	if f := p.onRequest.Load(); f != nil {
+		f.(func(string, Message))(mr.Event, Message{
+			p:     p,
+			ctx:   ctx,
+			event: mr.Event,
+			id:    mr.ID,
+			msg:   mr.Payload,
+		})
 	}
-
-	if mr.Event != signalerRequestEvent {
-		if f := p.onRequest.Load(); f != nil {
-			f.(func(string, Message))(mr.Event, Message{
-				p:     p,
-				event: mr.Event,
-				id:    mr.ID,
-				msg:   mr.Payload,
-			})
-		}
-		return
-	}
-
 }
 
 func (p *Peer) reply(id uint64, event string, payload []byte) error {
@@ -643,11 +660,20 @@ func joinErrs(errs ...error) error {
 
 type Message struct {
 	p     *Peer
+	ctx   context.Context
 	event string
 	id    uint64
 	msg   []byte
 }
 
+// Context returns the context of the request, carrying the span handling it
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
 func (m *Message) Payload() []byte {
 	return m.msg
 }
@@ -0,0 +1,34 @@
+package sfu
+
+import "errors"
+
+var (
+	// ErrSessionLimit is returned when a peer joins a new session and the SFU has
+	// reached the max number of sessions of the config
+	ErrSessionLimit = errors.New("max number of sessions reached")
+	// ErrPeerLimit is returned when a peer joins a session which has reached the max
+	// number of peers of the config
+	ErrPeerLimit = errors.New("max number of peers in the session reached")
+)
+
+// Admit returns an error if a peer can't join the session because of the admission
+// limits of the config, zero limits don't limit. The limits are checked when the peers
+// join, the sessions and peers above a reloaded lower limit are kept.
+func (s *SFU) Admit(sid string) error {
+	s.RLock()
+	maxSessions, maxPeers := s.config.SFU.MaxSessions, s.config.SFU.MaxPeers
+	session := s.sessions[sid]
+	sessions := len(s.sessions)
+	s.RUnlock()
+
+	if session == nil {
+		if maxSessions > 0 && sessions >= maxSessions {
+			return ErrSessionLimit
+		}
+		return nil
+	}
+	if maxPeers > 0 && len(session.Peers()) >= maxPeers {
+		return ErrPeerLimit
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSFU_Admit(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSessions int
+		maxPeers    int
+		sid         string
+		want        error
+	}{
+		{name: "Must admit without limits", sid: "new"},
+		{name: "Must admit a new session below the limit", maxSessions: 2, sid: "new"},
+		{name: "Must refuse a new session at the limit", maxSessions: 1, sid: "new", want: ErrSessionLimit},
+		{name: "Must admit an existing session at the session limit", maxSessions: 1, sid: "session"},
+		{name: "Must admit a peer below the limit", maxPeers: 2, sid: "session"},
+		{name: "Must refuse a peer at the limit", maxPeers: 1, sid: "session", want: ErrPeerLimit},
+		{name: "Must not limit the peers of a new session", maxPeers: 1, sid: "new"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConfig()
+			c.SFU.MaxSessions = tt.maxSessions
+			c.SFU.MaxPeers = tt.maxPeers
+			s := NewSFU(c)
+			session, _ := s.GetSession("session")
+			session.AddPeer(&PeerLocal{id: "peer"})
+
+			assert.Equal(t, tt.want, s.Admit(tt.sid))
+		})
+	}
+}
+
+func TestPeerLocal_Join_admission(t *testing.T) {
+	c := newTestConfig()
+	c.SFU.MaxSessions = 1
+	s := NewSFU(c)
+	session, _ := s.GetSession("session")
+	session.AddPeer(&PeerLocal{id: "peer"})
+
+	assert.Equal(t, ErrSessionLimit, NewPeer(s).Join("new", "other"))
+	assert.Nil(t, s.getSession("new"))
+}
@@ -9,6 +9,23 @@ type audioStream struct {
 	id    string
 	sum   int
 	total int
+	// level is the smoothed audio level and active the voice activity of the last interval
+	level  float64
+	active bool
+}
+
+// AudioLevel is the audio level of a stream, from 0 (silence) to 1 (loudest)
+type AudioLevel struct {
+	StreamID string  `json:"streamId"`
+	Level    float64 `json:"level"`
+	Active   bool    `json:"active"`
+}
+
+// DominantSpeaker is the loudest active stream, the confidence is its share of the
+// audio levels of all the active streams.
+type DominantSpeaker struct {
+	StreamID   string  `json:"streamId"`
+	Confidence float64 `json:"confidence"`
 }
 
 type AudioObserver struct {
@@ -17,9 +34,21 @@ type AudioObserver struct {
 	expected  int
 	threshold uint8
 	previous  []string
+	// smoothing is the weight of the previous level in the smoothed levels
+	smoothing       float64
+	dominant        DominantSpeaker
+	dominantChanged bool
 }
 
 func NewAudioObserver(threshold uint8, interval, filter int) *AudioObserver {
+	a := &AudioObserver{}
+	a.Configure(threshold, interval, filter)
+	return a
+}
+
+// Configure sets the max audio level in dBov of the active streams and the percentage
+// of the packets of an interval in ms that must reach it.
+func (a *AudioObserver) Configure(threshold uint8, interval, filter int) {
 	if threshold > 127 {
 		threshold = 127
 	}
@@ -30,10 +59,24 @@ func NewAudioObserver(threshold uint8, interval, filter int) *AudioObserver {
 		filter = 100
 	}
 
-	return &AudioObserver{
-		threshold: threshold,
-		expected:  interval * filter / 2000,
+	a.Lock()
+	a.threshold = threshold
+	a.expected = interval * filter / 2000
+	a.Unlock()
+}
+
+// SetSmoothing sets the weight in percentage [0-100] of the previous level in the
+// smoothed audio levels, higher values give steadier but slower levels.
+func (a *AudioObserver) SetSmoothing(percent int) {
+	if percent < 0 {
+		percent = 0
 	}
+	if percent > 100 {
+		percent = 100
+	}
+	a.Lock()
+	a.smoothing = float64(percent) / 100
+	a.Unlock()
 }
 
 func (a *AudioObserver) addStream(streamID string) {
@@ -89,13 +132,25 @@ func (a *AudioObserver) Calc() []string {
 	})
 
 	streamIDs := make([]string, 0, len(a.streams))
+	var total float64
 	for _, s := range a.streams {
 		if s.total >= a.expected {
 			streamIDs = append(streamIDs, s.id)
 		}
+		var level float64
+		if s.total > 0 {
+			// Average dBov of the voiced packets, 0 is the loudest
+			level = 1 - float64(s.sum)/float64(s.total)/127
+		}
+		s.level = a.smoothing*s.level + (1-a.smoothing)*level
+		s.active = s.total > 0 && s.total >= a.expected
+		if s.active {
+			total += s.level
+		}
 		s.total = 0
 		s.sum = 0
 	}
+	a.updateDominant(total)
 
 	if len(a.previous) == len(streamIDs) {
 		for i, s := range a.previous {
@@ -110,3 +165,53 @@ func (a *AudioObserver) Calc() []string {
 	a.previous = streamIDs
 	return streamIDs
 }
+
+// speakers returns the active speakers of the last Calc
+func (a *AudioObserver) speakers() []string {
+	a.RLock()
+	defer a.RUnlock()
+	speakers := make([]string, len(a.previous))
+	copy(speakers, a.previous)
+	return speakers
+}
+
+// streamIDs returns the ids of the observed audio streams
+func (a *AudioObserver) streamIDs() []string {
+	a.RLock()
+	defer a.RUnlock()
+	ids := make([]string, 0, len(a.streams))
+	for _, s := range a.streams {
+		ids = append(ids, s.id)
+	}
+	return ids
+}
+
+// updateDominant sets the dominant speaker from the sorted streams
+func (a *AudioObserver) updateDominant(total float64) {
+	dominant := DominantSpeaker{}
+	if len(a.streams) > 0 && a.streams[0].active && total > 0 {
+		dominant.StreamID = a.streams[0].id
+		dominant.Confidence = a.streams[0].level / total
+	}
+	a.dominantChanged = dominant.StreamID != a.dominant.StreamID
+	a.dominant = dominant
+}
+
+// Levels returns the smoothed audio levels of the streams computed by the last Calc
+func (a *AudioObserver) Levels() []AudioLevel {
+	a.RLock()
+	defer a.RUnlock()
+	levels := make([]AudioLevel, 0, len(a.streams))
+	for _, s := range a.streams {
+		levels = append(levels, AudioLevel{StreamID: s.id, Level: s.level, Active: s.active})
+	}
+	return levels
+}
+
+// DominantSpeaker returns the dominant speaker computed by the last Calc, and true if it
+// changed in the last Calc. The stream id is empty when nobody is speaking.
+func (a *AudioObserver) DominantSpeaker() (DominantSpeaker, bool) {
+	a.RLock()
+	defer a.RUnlock()
+	return a.dominant, a.dominantChanged
+}
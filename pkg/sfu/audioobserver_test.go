@@ -3,6 +3,7 @@ package sfu
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -269,3 +270,122 @@ func Test_newAudioLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestAudioObserver_Levels(t *testing.T) {
+	a := &AudioObserver{
+		streams: []*audioStream{
+			{id: "a", sum: 0, total: 5},
+			{id: "b", sum: 127 * 3, total: 3},
+			{id: "c"},
+		},
+		expected: 2,
+	}
+	a.SetSmoothing(50)
+	a.Calc()
+
+	assert.Equal(t, []AudioLevel{
+		{StreamID: "a", Level: 0.5, Active: true},
+		{StreamID: "b", Level: 0, Active: true},
+		{StreamID: "c", Level: 0},
+	}, a.Levels())
+
+	dominant, changed := a.DominantSpeaker()
+	assert.True(t, changed)
+	assert.Equal(t, DominantSpeaker{StreamID: "a", Confidence: 1}, dominant)
+
+	a.observe("a", 0)
+	a.observe("a", 0)
+	a.Calc()
+	dominant, changed = a.DominantSpeaker()
+	assert.False(t, changed)
+	assert.Equal(t, "a", dominant.StreamID)
+	assert.Equal(t, 0.75, a.Levels()[0].Level)
+
+	a.Calc()
+	dominant, changed = a.DominantSpeaker()
+	assert.True(t, changed)
+	assert.Equal(t, DominantSpeaker{}, dominant)
+}
+
+func Test_levelsChanged(t *testing.T) {
+	levels := []AudioLevel{{StreamID: "a", Level: 0.5, Active: true}, {StreamID: "b"}}
+	tests := []struct {
+		name string
+		next []AudioLevel
+		want bool
+	}{
+		{
+			name: "Must not change with the same levels",
+			next: []AudioLevel{{StreamID: "a", Level: 0.5, Active: true}, {StreamID: "b"}},
+		},
+		{
+			name: "Must not change under the delta",
+			next: []AudioLevel{{StreamID: "a", Level: 0.505, Active: true}, {StreamID: "b", Level: 0.005}},
+		},
+		{
+			name: "Must change with a level over the delta",
+			next: []AudioLevel{{StreamID: "a", Level: 0.52, Active: true}, {StreamID: "b"}},
+			want: true,
+		},
+		{
+			name: "Must change with the voice activity",
+			next: []AudioLevel{{StreamID: "a", Level: 0.5}, {StreamID: "b"}},
+			want: true,
+		},
+		{
+			name: "Must change with the streams",
+			next: []AudioLevel{{StreamID: "a", Level: 0.5, Active: true}},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, levelsChanged(levels, tt.next))
+		})
+	}
+}
+
+func Test_audioNotifier_notify(t *testing.T) {
+	called, block := make(chan struct{}, 10), make(chan struct{})
+	received := make(chan []AudioLevel, 10)
+	speakers := make(chan DominantSpeaker, 10)
+	p := &PeerLocal{
+		OnAudioLevels: func(levels []AudioLevel) {
+			called <- struct{}{}
+			<-block
+			received <- levels
+		},
+		OnDominantSpeaker: func(speaker DominantSpeaker) {
+			speakers <- speaker
+		},
+	}
+
+	// A peer which can't keep up doesn't block the observer and gets the latest values
+	p.audioEvents.notify(p, []AudioLevel{{StreamID: "a", Level: 0.1}}, nil)
+	<-called
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 2; i <= 10; i++ {
+			p.audioEvents.notify(p, []AudioLevel{{StreamID: "a", Level: float64(i) / 10}}, nil)
+		}
+		p.audioEvents.notify(p, nil, &DominantSpeaker{StreamID: "a", Confidence: 1})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("notify blocked")
+	}
+	close(block)
+
+	assert.Equal(t, []AudioLevel{{StreamID: "a", Level: 0.1}}, <-received)
+	assert.Equal(t, []AudioLevel{{StreamID: "a", Level: 1}}, <-received)
+	assert.Equal(t, DominantSpeaker{StreamID: "a", Confidence: 1}, <-speakers)
+	assert.Eventually(t, func() bool {
+		p.audioEvents.Lock()
+		defer p.audioEvents.Unlock()
+		return !p.audioEvents.running
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, received)
+}
@@ -2,13 +2,16 @@ package sfu
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/ion-sfu/pkg/stats"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/transport/packetio"
 	"github.com/pion/webrtc/v3"
 )
@@ -38,17 +41,42 @@ type DownTrack struct {
 	bufferFactory *buffer.Factory
 	payload       *[]byte
 
+	// RTX helpers
+	rtxSSRC           uint32
+	rtxPayloadType    uint8
+	rtxSequenceNumber uint32
+	// FEC helpers
+	fec *flexFEC
+	// Probe helpers
+	probe *probeHelper
+	// processor runs the packet interceptors before writing the packets
+	processor PacketProcessor
+	// writeMu serializes the writes, the interceptors, the layers and the keyframe
+	// replays write from their own goroutines
+	writeMu sync.Mutex
+	// metrics of the egress packets, nil without stats
+	metrics *stats.DownTrackMetrics
+
+	// RED helpers
+	sourceRED       bool
+	opusPayloadType uint8
+	redBuffers      [redMaxRedundancy + 1]*[]byte
+
 	currentSpatialLayer int32
 	targetSpatialLayer  int32
 	temporalLayer       int32
 
-	enabled  atomicBool
-	reSync   atomicBool
-	snOffset uint16
-	tsOffset uint32
-	lastSSRC uint32
-	lastSN   uint16
-	lastTS   uint32
+	enabled atomicBool
+	reSync  atomicBool
+	// paused is set when the last-N selection stops forwarding the track
+	paused atomicBool
+	// keyFrameReplay is set until the receiver replays its keyframe cache
+	keyFrameReplay atomicBool
+	snOffset       uint16
+	tsOffset       uint32
+	lastSSRC       uint32
+	lastSN         uint16
+	lastTS         uint32
 
 	simulcast        simulcastTrackHelpers
 	maxSpatialLayer  int32
@@ -60,12 +88,18 @@ type DownTrack struct {
 	writeStream    webrtc.TrackLocalWriter
 	onCloseHandler func()
 	onBind         func()
-	closeOnce      sync.Once
+	// onLayerSwitched is called when the forwarded spatial layer is switched
+	onLayerSwitched func(layer int32)
+	closeOnce       sync.Once
 
 	// Report helpers
 	octetCount  uint32
 	packetCount uint32
 	maxPacketTs uint32
+	// Last receiver report of the subscriber
+	fractionLost uint32
+	jitter       uint32
+	rtt          uint32
 }
 
 // NewDownTrack returns a DownTrack.
@@ -87,6 +121,21 @@ func NewDownTrack(c webrtc.RTPCodecCapability, r Receiver, bf *buffer.Factory, p
 func (d *DownTrack) Bind(t webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
 	parameters := webrtc.RTPCodecParameters{RTPCodecCapability: d.codec}
 	if codec, err := codecParametersFuzzySearch(parameters, t.CodecParameters()); err == nil {
+		if d.Kind() == webrtc.RTPCodecTypeAudio {
+			codec = d.bindRED(codec, t.CodecParameters())
+		}
+		if d.rtxSSRC != 0 {
+			d.bindRTX(codec, t.CodecParameters())
+		}
+		if d.fec != nil {
+			if fec, err := codecParametersFuzzySearch(webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeFlexFEC},
+			}, t.CodecParameters()); err == nil {
+				d.fec.payloadType = uint8(fec.PayloadType)
+			} else {
+				d.fec = nil
+			}
+		}
 		d.ssrc = uint32(t.SSRC())
 		d.payloadType = uint8(codec.PayloadType)
 		d.writeStream = t.WriteStream()
@@ -154,11 +203,34 @@ func (d *DownTrack) SetTransceiver(transceiver *webrtc.RTPTransceiver) {
 	d.transceiver = transceiver
 }
 
+// Use sets the interceptors executed on the packets forwarded by the DownTrack,
+// it must be called before the DownTrack is added to the receiver. The writes are
+// serialized, an interceptor may call the next processor from another goroutine.
+func (d *DownTrack) Use(interceptors ...func(PacketProcessor) PacketProcessor) {
+	d.processor = PacketInterceptors(interceptors).Process(PacketProcessFunc(func(args PacketArgs) error {
+		return d.writeRTP(args.Packet, args.Layer)
+	}))
+}
+
 // WriteRTP writes a RTP Packet to the DownTrack
 func (d *DownTrack) WriteRTP(p *buffer.ExtPacket, layer int) error {
-	if !d.enabled.get() || !d.bound.get() {
+	if !d.enabled.get() || !d.bound.get() || d.paused.get() {
 		return nil
 	}
+	if d.processor != nil {
+		return d.processor.Process(PacketArgs{
+			Receiver:  d.receiver,
+			DownTrack: d,
+			Layer:     layer,
+			Packet:    p,
+		})
+	}
+	return d.writeRTP(p, layer)
+}
+
+func (d *DownTrack) writeRTP(p *buffer.ExtPacket, layer int) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
 	switch d.trackType {
 	case SimpleDownTrack:
 		return d.writeSimpleRTP(p)
@@ -183,6 +255,18 @@ func (d *DownTrack) Mute(val bool) {
 	}
 }
 
+// pause stops or resumes the media forwarding independently of Mute, the forwarding
+// resumes on a keyframe.
+func (d *DownTrack) pause(val bool) {
+	if d.paused.get() == val {
+		return
+	}
+	d.paused.set(val)
+	if !val {
+		d.reSync.set(true)
+	}
+}
+
 // Close track
 func (d *DownTrack) Close() {
 	d.closeOnce.Do(func() {
@@ -190,6 +274,11 @@ func (d *DownTrack) Close() {
 		if d.payload != nil {
 			packetFactory.Put(d.payload)
 		}
+		for _, buf := range d.redBuffers {
+			if buf != nil {
+				packetFactory.Put(buf)
+			}
+		}
 		if d.onCloseHandler != nil {
 			d.onCloseHandler()
 		}
@@ -226,6 +315,10 @@ func (d *DownTrack) SwitchSpatialLayer(targetLayer int32, setAsMax bool) error {
 
 func (d *DownTrack) SwitchSpatialLayerDone(layer int32) {
 	atomic.StoreInt32(&d.currentSpatialLayer, layer)
+	d.metrics.LayerSwitch()
+	if d.onLayerSwitched != nil {
+		d.onLayerSwitched(layer)
+	}
 }
 
 func (d *DownTrack) UptrackLayersChange(availableLayers []uint16) (int64, error) {
@@ -315,24 +408,18 @@ func (d *DownTrack) CreateSenderReport() *rtcp.SenderReport {
 	if !d.bound.get() {
 		return nil
 	}
-	srRTP, srNTP := d.receiver.GetSenderReportTime(int(atomic.LoadInt32(&d.currentSpatialLayer)))
-	if srRTP == 0 {
+	srRTP, srNTP, srRecv := d.receiver.GetSenderReportTime(int(atomic.LoadInt32(&d.currentSpatialLayer)))
+	if srRecv == 0 {
 		return nil
 	}
 
-	now := time.Now()
-	nowNTP := toNtpTime(now)
-
-	diff := (uint64(now.Sub(ntpTime(srNTP).Time())) * uint64(d.codec.ClockRate)) / uint64(time.Second)
-	if diff < 0 {
-		diff = 0
-	}
+	rtpTS, ntpTS := projectSenderReport(srRTP, srNTP, srRecv, time.Now().UnixNano(), d.codec.ClockRate)
 	octets, packets := d.getSRStats()
 
 	return &rtcp.SenderReport{
 		SSRC:        d.ssrc,
-		NTPTime:     uint64(nowNTP),
-		RTPTime:     srRTP + uint32(diff),
+		NTPTime:     ntpTS,
+		RTPTime:     rtpTS - d.tsOffset,
 		PacketCount: packets,
 		OctetCount:  octets,
 	}
@@ -341,6 +428,7 @@ func (d *DownTrack) CreateSenderReport() *rtcp.SenderReport {
 func (d *DownTrack) UpdateStats(packetLen uint32) {
 	atomic.AddUint32(&d.octetCount, packetLen)
 	atomic.AddUint32(&d.packetCount, 1)
+	d.metrics.Packet(int(packetLen))
 }
 
 func (d *DownTrack) writeSimpleRTP(extPkt *buffer.ExtPacket) error {
@@ -362,7 +450,16 @@ func (d *DownTrack) writeSimpleRTP(extPkt *buffer.ExtPacket) error {
 		d.reSync.set(false)
 	}
 
-	d.UpdateStats(uint32(len(extPkt.Packet.Payload)))
+	payload := extPkt.Packet.Payload
+	if d.opusPayloadType != 0 || d.sourceRED {
+		var err error
+		if payload, err = d.redPayload(extPkt); err != nil {
+			Logger.V(1).Error(err, "Error processing red payload", "peer_id", d.peerID)
+			return nil
+		}
+	}
+
+	d.UpdateStats(uint32(len(payload)))
 
 	newSN := extPkt.Packet.SequenceNumber - d.snOffset
 	newTS := extPkt.Packet.Timestamp - d.tsOffset
@@ -379,10 +476,120 @@ func (d *DownTrack) writeSimpleRTP(extPkt *buffer.ExtPacket) error {
 	hdr.SequenceNumber = newSN
 	hdr.SSRC = d.ssrc
 
-	_, err := d.writeStream.WriteRTP(&hdr, extPkt.Packet.Payload)
+	_, err := d.writeStream.WriteRTP(&hdr, payload)
+	if err == nil && d.fec != nil {
+		d.writeFEC(&hdr, payload)
+	}
+	return err
+}
+
+func (d *DownTrack) writeFEC(hdr *rtp.Header, payload []byte) {
+	if fecHdr, fecPayload, ok := d.fec.push(hdr, payload); ok {
+		if _, err := d.writeStream.WriteRTP(fecHdr, fecPayload); err != nil {
+			Logger.V(1).Error(err, "Writing fec packet err", "peer_id", d.peerID)
+		}
+	}
+}
+
+// ssrcGroups returns the repair streams of the DownTrack that must be signaled
+// to the remote peer along with the media SSRC.
+func (d *DownTrack) ssrcGroups() []ssrcGroup {
+	if (d.fec == nil && d.rtxSSRC == 0) || d.transceiver == nil {
+		return nil
+	}
+	encodings := d.transceiver.Sender().GetParameters().Encodings
+	if len(encodings) == 0 {
+		return nil
+	}
+	media := uint32(encodings[0].SSRC)
+	var groups []ssrcGroup
+	if d.rtxSSRC != 0 {
+		groups = append(groups, ssrcGroup{semantics: "FID", media: media, repair: d.rtxSSRC})
+	}
+	if d.fec != nil {
+		groups = append(groups, ssrcGroup{semantics: "FEC-FR", media: media, repair: d.fec.ssrc})
+	}
+	return groups
+}
+
+// bindRTX checks if the remote peer negotiated RTX for the DownTrack codec, if not
+// the retransmissions are sent on the media SSRC.
+func (d *DownTrack) bindRTX(codec webrtc.RTPCodecParameters, codecs []webrtc.RTPCodecParameters) {
+	apt := strconv.Itoa(int(codec.PayloadType))
+	for _, c := range codecs {
+		if !strings.EqualFold(c.MimeType, mimeTypeRTX) {
+			continue
+		}
+		if v, ok := fmtpParameter(c.SDPFmtpLine, "apt"); ok && v == apt {
+			d.rtxPayloadType = uint8(c.PayloadType)
+			return
+		}
+	}
+	d.rtxSSRC = 0
+}
+
+// writeRTX sends a packet on the RTX stream, the payload must be already RFC 4588
+// encapsulated, or empty for padding only packets.
+func (d *DownTrack) writeRTX(hdr *rtp.Header, payload []byte) error {
+	rtxHdr := *hdr
+	rtxHdr.SSRC = d.rtxSSRC
+	rtxHdr.PayloadType = d.rtxPayloadType
+	rtxHdr.SequenceNumber = uint16(atomic.AddUint32(&d.rtxSequenceNumber, 1))
+	_, err := d.writeStream.WriteRTP(&rtxHdr, payload)
 	return err
 }
 
+// bindRED checks if the remote peer negotiated RED for the opus DownTrack, if so
+// the RED codec is used and the redundancy is generated from the publisher packets.
+func (d *DownTrack) bindRED(codec webrtc.RTPCodecParameters, codecs []webrtc.RTPCodecParameters) webrtc.RTPCodecParameters {
+	d.sourceRED = strings.EqualFold(d.receiver.Codec().MimeType, mimeTypeRED)
+	if !strings.EqualFold(codec.MimeType, mimeTypeOpus) {
+		return codec
+	}
+	red, err := codecParametersFuzzySearch(webrtc.RTPCodecParameters{RTPCodecCapability: redCodecCapability(codec.PayloadType)}, codecs)
+	if err != nil {
+		return codec
+	}
+	d.opusPayloadType = uint8(codec.PayloadType)
+	for i := range d.redBuffers {
+		d.redBuffers[i] = packetFactory.Get().(*[]byte)
+	}
+	return red
+}
+
+// redPayload returns the payload to be sent to the remote peer, generating the RED
+// redundancy from the packets stored in the publisher buffer if the source is plain opus,
+// or extracting the primary encoding if the remote peer does not support RED.
+func (d *DownTrack) redPayload(extPkt *buffer.ExtPacket) ([]byte, error) {
+	if d.opusPayloadType == 0 {
+		// RED source and opus only remote peer
+		return extractREDPrimary(extPkt.Packet.Payload)
+	}
+	if d.sourceRED {
+		buf := *d.redBuffers[0]
+		payload := buf[:copy(buf, extPkt.Packet.Payload)]
+		if err := setREDPayloadType(payload, d.opusPayloadType); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+
+	blocks := make([]redBlock, 0, redMaxRedundancy)
+	for i := redMaxRedundancy; i > 0; i-- {
+		buf := *d.redBuffers[i]
+		n, err := d.receiver.GetPacket(buf, 0, extPkt.Packet.SequenceNumber-uint16(i))
+		if err != nil {
+			continue
+		}
+		var pkt rtp.Packet
+		if err = pkt.Unmarshal(buf[:n]); err != nil {
+			continue
+		}
+		blocks = append(blocks, redBlock{timestamp: pkt.Timestamp, payload: pkt.Payload})
+	}
+	return encodeRED(*d.redBuffers[0], d.opusPayloadType, extPkt.Packet.Timestamp, extPkt.Packet.Payload, blocks)
+}
+
 func (d *DownTrack) writeSimulcastRTP(extPkt *buffer.ExtPacket, layer int) error {
 	// Check if packet SSRC is different from before
 	// if true, the video source changed
@@ -465,8 +672,7 @@ func (d *DownTrack) writeSimulcastRTP(extPkt *buffer.ExtPacket, layer int) error
 		}
 	}
 
-	atomic.AddUint32(&d.octetCount, uint32(len(extPkt.Packet.Payload)))
-	atomic.AddUint32(&d.packetCount, 1)
+	d.UpdateStats(uint32(len(extPkt.Packet.Payload)))
 
 	if extPkt.Head {
 		d.lastSN = newSN
@@ -482,6 +688,12 @@ func (d *DownTrack) writeSimulcastRTP(extPkt *buffer.ExtPacket, layer int) error
 	hdr.PayloadType = d.payloadType
 
 	_, err := d.writeStream.WriteRTP(&hdr, payload)
+	if err == nil && d.fec != nil {
+		d.writeFEC(&hdr, payload)
+	}
+	if err == nil && d.probe != nil && extPkt.Head && hdr.Marker {
+		d.writeProbe(&hdr)
+	}
 	return err
 }
 
@@ -516,6 +728,7 @@ func (d *DownTrack) handleRTCP(bytes []byte) {
 				p.SenderSSRC = d.ssrc
 				fwdPkts = append(fwdPkts, p)
 				pliOnce = false
+				d.metrics.PLISent()
 			}
 		case *rtcp.FullIntraRequest:
 			if firOnce {
@@ -533,6 +746,17 @@ func (d *DownTrack) handleRTCP(bytes []byte) {
 				if maxRatePacketLoss == 0 || maxRatePacketLoss < r.FractionLost {
 					maxRatePacketLoss = r.FractionLost
 				}
+				if r.SSRC == d.ssrc {
+					atomic.StoreUint32(&d.fractionLost, uint32(r.FractionLost))
+					atomic.StoreUint32(&d.jitter, r.Jitter)
+					if rtt := reportRTT(toNtpTime(time.Now()), r.LastSenderReport, r.Delay); rtt != 0 {
+						atomic.StoreUint32(&d.rtt, rtt)
+						d.receiver.SetRTT(rtt)
+					}
+				}
+			}
+			if d.fec != nil && len(p.Reports) > 0 {
+				d.fec.updateLoss(maxRatePacketLoss)
 			}
 		case *rtcp.TransportLayerNack:
 			if d.sequencer != nil {
@@ -546,6 +770,10 @@ func (d *DownTrack) handleRTCP(bytes []byte) {
 			}
 		}
 	}
+	if d.fec != nil && expectedMinBitrate != 0 {
+		// Keep room for the repair packets in the bandwidth budget
+		expectedMinBitrate = expectedMinBitrate * 100 / (100 + d.fec.overhead())
+	}
 	if d.trackType == SimulcastDownTrack && (maxRatePacketLoss != 0 || expectedMinBitrate != 0) {
 		d.handleLayerChange(maxRatePacketLoss, expectedMinBitrate)
 	}
@@ -578,10 +806,17 @@ func (d *DownTrack) handleLayerChange(maxRatePacketLoss uint8, expectedMinBitrat
 				}
 				if currentTemporalLayer >= mctl && expectedMinBitrate >= 3*cbr/2 && currentSpatialLayer+1 <= atomic.LoadInt32(&d.maxSpatialLayer) &&
 					currentSpatialLayer+1 <= 2 {
+					if d.probe != nil {
+						d.probe.stop()
+					}
 					if err := d.SwitchSpatialLayer(currentSpatialLayer+1, false); err == nil {
 						d.SwitchTemporalLayer(0, false)
 					}
 					d.simulcast.switchDelay = time.Now().Add(5 * time.Second)
+				} else if d.probe != nil && currentTemporalLayer >= mctl && currentSpatialLayer+1 <= atomic.LoadInt32(&d.maxSpatialLayer) &&
+					currentSpatialLayer+1 <= 2 && brs[currentSpatialLayer+1] > expectedMinBitrate {
+					// Estimate is not enough for the next layer, probe for its bitrate
+					d.probe.start(brs[currentSpatialLayer+1] - expectedMinBitrate)
 				}
 			}
 			if maxRatePacketLoss >= 25 {
@@ -0,0 +1,108 @@
+package sfu
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DrainMethod is the API datachannel message sent to the peers when the SFU drains
+	DrainMethod = "drain"
+
+	defaultDrainTimeout = 300
+	drainCheckInterval  = 500 * time.Millisecond
+)
+
+// ErrDraining is returned when a peer joins a draining SFU
+var ErrDraining = errors.New("sfu is draining")
+
+// Draining returns true once the SFU is draining, it doesn't accept new peers anymore
+func (s *SFU) Draining() bool {
+	return s.draining.get()
+}
+
+// Drained returns a channel closed when the SFU is drained and closed
+func (s *SFU) Drained() <-chan struct{} {
+	return s.drained
+}
+
+// OnDrain adds a handler called when the SFU starts draining, e.g. to close the pull
+// peers or to report the node as not serving.
+func (s *SFU) OnDrain(f func()) {
+	s.Lock()
+	defer s.Unlock()
+	s.onDrain = append(s.onDrain, f)
+}
+
+// Drain stops accepting new peers, notifies the peers to migrate to another node and
+// waits for the sessions to empty up to the timeout, the drain timeout of the config
+// when zero. The SFU is then closed. Only the first call drains, the other ones wait
+// for it to end.
+func (s *SFU) Drain(timeout time.Duration) {
+	if !s.draining.set(true) {
+		<-s.drained
+		return
+	}
+	s.RLock()
+	if timeout <= 0 {
+		timeout = time.Duration(s.config.SFU.DrainTimeout) * time.Second
+	}
+	handlers := append([]func(){}, s.onDrain...)
+	s.RUnlock()
+	Logger.Info("Draining SFU", "timeout", timeout)
+
+	for _, f := range handlers {
+		f()
+	}
+
+	for _, session := range s.GetSessions() {
+		if sl, ok := session.(*SessionLocal); ok {
+			sl.drain()
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for len(s.GetSessions()) > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			Logger.Info("Drain timeout reached, closing the remaining sessions", "sessions", len(s.GetSessions()))
+			for _, session := range s.GetSessions() {
+				session.RemoveAllPeer()
+			}
+			s.close()
+			return
+		}
+	}
+	Logger.Info("SFU drained")
+	s.close()
+}
+
+// close flushes the events and the spans and stops the TURN server
+func (s *SFU) close() {
+	s.webrtc.Events.Close()
+	if s.tracer != nil {
+		if err := s.tracer.Shutdown(); err != nil {
+			Logger.Error(err, "Shutting down tracer failed")
+		}
+	}
+	if s.turn != nil {
+		if err := s.turn.Close(); err != nil {
+			Logger.Error(err, "Closing turn server failed")
+		}
+	}
+	close(s.drained)
+}
+
+// drain notifies the peers of the session that the SFU is draining
+func (s *SessionLocal) drain() {
+	s.sendAPIMessage(DrainMethod, nil)
+	for _, p := range s.Peers() {
+		if peer, ok := p.(*PeerLocal); ok && peer.OnDrain != nil {
+			peer.OnDrain()
+		}
+	}
+}
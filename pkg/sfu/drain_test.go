@@ -0,0 +1,53 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSFU_Drain(t *testing.T) {
+	s := NewSFU(newSessionTestConfig())
+	var drains int
+	s.OnDrain(func() { drains++ })
+
+	accept, _, _ := s.CheckSession("session")
+	assert.True(t, accept)
+
+	done := make(chan struct{})
+	go func() {
+		s.Drain(time.Second)
+		close(done)
+	}()
+	s.Drain(time.Second)
+	<-done
+
+	select {
+	case <-s.Drained():
+	default:
+		t.Fatal("SFU not drained")
+	}
+	assert.True(t, s.Draining())
+	assert.Equal(t, 1, drains)
+
+	accept, _, _ = s.CheckSession("session")
+	assert.False(t, accept)
+	assert.Equal(t, ErrDraining, NewPeer(s).Join("session", "peer"))
+}
+
+func TestSFU_DrainTimeout(t *testing.T) {
+	s := NewSFU(newSessionTestConfig())
+	session, _ := s.GetSession("session")
+	p := NewPeer(s)
+	p.session = session
+	session.AddPeer(p)
+	var notified bool
+	p.OnDrain = func() { notified = true }
+
+	start := time.Now()
+	s.Drain(time.Second)
+	assert.True(t, notified)
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Empty(t, s.GetSessions())
+}
@@ -8,6 +8,10 @@ var (
 	errCreatingDataChannel      = errors.New("failed to create data channel")
 	// router errors
 	errNoReceiverFound = errors.New("no receiver found")
+	// receiver errors
+	errPacketNotFound = errors.New("packet not found in buffer")
+	// RED errors
+	errInvalidREDPacket = errors.New("invalid red packet")
 	// Helpers errors
 	errShortPacket = errors.New("packet is not large enough")
 	errNilPacket   = errors.New("invalid nil packet")
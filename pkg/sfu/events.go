@@ -0,0 +1,147 @@
+package sfu
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of a session lifecycle event
+type EventType string
+
+const (
+	EventSessionCreated      EventType = "session.created"
+	EventSessionClosed       EventType = "session.closed"
+	EventPeerJoined          EventType = "peer.joined"
+	EventPeerLeft            EventType = "peer.left"
+	EventTrackPublished      EventType = "track.published"
+	EventTrackUnpublished    EventType = "track.unpublished"
+	EventSubscriptionAdded   EventType = "subscription.added"
+	EventSubscriptionRemoved EventType = "subscription.removed"
+	EventPullStarted         EventType = "pull.started"
+	EventPullStopped         EventType = "pull.stopped"
+	EventLayerSwitched       EventType = "layer.switched"
+	EventSessionMigrating    EventType = "session.migrating"
+	EventSessionMigrated     EventType = "session.migrated"
+)
+
+// eventQueueSize is the number of events queued by sink before dropping them
+const eventQueueSize = 1024
+
+// Event is a session lifecycle event, the track events are emitted with the publisher
+// as PeerID, the subscription events with the subscriber.
+type Event struct {
+	Type      EventType         `json:"type"`
+	Time      time.Time         `json:"time"`
+	SessionID string            `json:"sessionId"`
+	PeerID    string            `json:"peerId,omitempty"`
+	TrackID   string            `json:"trackId,omitempty"`
+	StreamID  string            `json:"streamId,omitempty"`
+	Kind      string            `json:"kind,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// EventSink receives the events emitted on the bus
+type EventSink interface {
+	Send(e Event) error
+	Close() error
+}
+
+// EventsConfig defines the sinks of the session events
+type EventsConfig struct {
+	// Webhooks the events are posted to
+	Webhooks []WebhookConfig `mapstructure:"webhooks"`
+	// File the events are appended to as JSON lines
+	File string `mapstructure:"file"`
+	// RedisStream the events are added to, used by the signal servers
+	RedisStream string `mapstructure:"redisstream"`
+}
+
+type sinkQueue struct {
+	sink EventSink
+	ch   chan Event
+	done chan struct{}
+}
+
+func (q *sinkQueue) run() {
+	defer close(q.done)
+	for e := range q.ch {
+		if err := q.sink.Send(e); err != nil {
+			Logger.Error(err, "Sending event failed", "type", e.Type, "session_id", e.SessionID)
+		}
+	}
+	if err := q.sink.Close(); err != nil {
+		Logger.Error(err, "Closing event sink failed")
+	}
+}
+
+// EventBus dispatches the events to the sinks, each sink sends its events in order
+// from its own goroutine. Events are dropped when a sink can't keep up, emitting never
+// blocks the media path.
+type EventBus struct {
+	mu     sync.RWMutex
+	sinks  []*sinkQueue
+	closed bool
+}
+
+// NewEventBus creates an event bus without sinks
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// AddSink adds a sink receiving the events emitted after the call
+func (b *EventBus) AddSink(sink EventSink) {
+	q := &sinkQueue{
+		sink: sink,
+		ch:   make(chan Event, eventQueueSize),
+		done: make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		_ = sink.Close()
+		return
+	}
+	b.sinks = append(b.sinks, q)
+	go q.run()
+}
+
+// Emit sends the event to the sinks, the time is set when not given
+func (b *EventBus) Emit(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, q := range b.sinks {
+		select {
+		case q.ch <- e:
+		default:
+			Logger.V(1).Info("Event sink queue full, dropping event", "type", e.Type, "session_id", e.SessionID)
+		}
+	}
+}
+
+// Close sends the queued events and closes the sinks
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	sinks := b.sinks
+	b.sinks = nil
+	for _, q := range sinks {
+		close(q.ch)
+	}
+	b.mu.Unlock()
+	for _, q := range sinks {
+		<-q.done
+	}
+}
@@ -0,0 +1,115 @@
+package sfu
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSink struct {
+	sync.Mutex
+	events []Event
+	closed bool
+}
+
+func (s *testSink) Send(e Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	sink := &testSink{}
+	bus.AddSink(sink)
+
+	bus.Emit(Event{Type: EventSessionCreated, SessionID: "s"})
+	bus.Emit(Event{Type: EventPeerJoined, SessionID: "s", PeerID: "p"})
+	bus.Close()
+	bus.Emit(Event{Type: EventSessionClosed, SessionID: "s"})
+
+	assert.True(t, sink.closed)
+	if assert.Len(t, sink.events, 2) {
+		assert.Equal(t, EventSessionCreated, sink.events[0].Type)
+		assert.Equal(t, "p", sink.events[1].PeerID)
+		assert.False(t, sink.events[0].Time.IsZero())
+	}
+
+	var nilBus *EventBus
+	assert.NotPanics(t, func() {
+		nilBus.Emit(Event{Type: EventSessionCreated})
+	})
+}
+
+func TestWebhookSink(t *testing.T) {
+	var calls int32
+	var signature string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		signature = r.Header.Get(WebhookSignatureHeader)
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(WebhookConfig{URL: srv.URL, Secret: "secret", Retries: 1})
+	sink.retryDelay = time.Millisecond
+	assert.NoError(t, sink.Send(Event{Type: EventTrackPublished, SessionID: "s", TrackID: "t"}))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, signEvent("secret", body), signature)
+
+	var e Event
+	assert.NoError(t, json.Unmarshal(body, &e))
+	assert.Equal(t, "t", e.TrackID)
+
+	failing := NewWebhookSink(WebhookConfig{URL: srv.URL + "/404", Retries: 0})
+	atomic.StoreInt32(&calls, 0)
+	assert.Error(t, failing.Send(Event{Type: EventTrackPublished}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+
+	sink, err := NewFileSink(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Send(Event{Type: EventPeerJoined, PeerID: "a"}))
+	assert.NoError(t, sink.Send(Event{Type: EventPeerLeft, PeerID: "a"}))
+	assert.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var types []EventType
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []EventType{EventPeerJoined, EventPeerLeft}, types)
+}
@@ -0,0 +1,136 @@
+package sfu
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader holds the hex HMAC-SHA256 of the body with the webhook secret
+	WebhookSignatureHeader = "X-SFU-Signature"
+
+	defaultWebhookTimeout = 5000
+	webhookRetryDelay     = 500 * time.Millisecond
+)
+
+// WebhookConfig defines a webhook the events are posted to
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+	// Secret signing the events, no signature is sent when empty
+	Secret string `mapstructure:"secret"`
+	// Retries of the failed posts, the delay between retries doubles each time
+	Retries int `mapstructure:"retries"`
+	// Timeout of each post in ms
+	Timeout int `mapstructure:"timeout"`
+}
+
+// WebhookSink posts each event as JSON to a webhook
+type WebhookSink struct {
+	config     WebhookConfig
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+// NewWebhookSink creates a sink posting the events to the webhook
+func NewWebhookSink(c WebhookConfig) *WebhookSink {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultWebhookTimeout
+	}
+	return &WebhookSink{
+		config:     c,
+		client:     &http.Client{Timeout: time.Duration(c.Timeout) * time.Millisecond},
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// Send implements EventSink
+func (w *WebhookSink) Send(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var signature string
+	if w.config.Secret != "" {
+		signature = signEvent(w.config.Secret, body)
+	}
+
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		if err = w.post(body, signature); err == nil || attempt >= w.config.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (w *WebhookSink) post(body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(WebhookSignatureHeader, signature)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook %s replied %s", w.config.URL, res.Status)
+	}
+	return nil
+}
+
+// Close implements EventSink
+func (w *WebhookSink) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// signEvent returns the "sha256=" prefixed hex HMAC-SHA256 of the body
+func signEvent(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// FileSink appends the events to a file as JSON lines
+type FileSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileSink opens the file the events are appended to
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Send implements EventSink
+func (s *FileSink) Send(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+// Close implements EventSink
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,171 @@
+package sfu
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	mimeTypeFlexFEC    = "video/flexfec-03"
+	flexFECPayloadType = 49
+	// flexFECHeaderSize is the size of the FlexFEC-03 header protecting a single SSRC
+	// with the short (15 bits) packet mask.
+	flexFECHeaderSize = 20
+	// flexFECMaxGroupSize is the max number of media packets the short mask can protect
+	flexFECMaxGroupSize = 15
+	rtpHeaderSize       = 12
+)
+
+// FECConfig defines the egress forward error correction configuration
+type FECConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// LossThreshold is the subscriber loss percentage that enables the FEC generation
+	LossThreshold uint8 `mapstructure:"lossthreshold"`
+	// MaxOverhead is the max FEC overhead percentage over the media packets
+	MaxOverhead uint8 `mapstructure:"maxoverhead"`
+}
+
+// flexFEC generates FlexFEC-03 (draft-ietf-payload-flexible-fec-scheme-03) repair
+// packets for a DownTrack, protecting groups of consecutive media packets with a
+// single XOR repair packet.
+type flexFEC struct {
+	ssrc        uint32
+	payloadType uint8
+	config      FECConfig
+	// groupSize is the number of media packets protected by each repair packet,
+	// zero means the FEC generation is disabled.
+	groupSize int32
+
+	sequenceNumber uint16
+	count          int
+	baseSN         uint16
+	nextSN         uint16
+	mask           uint16
+	lastTS         uint32
+	recovery       [2]byte
+	lengthRecovery uint16
+	tsRecovery     uint32
+	payloadLen     int
+	payload        []byte
+	raw            []byte
+}
+
+func newFlexFEC(ssrc uint32, config FECConfig) *flexFEC {
+	return &flexFEC{
+		ssrc:    ssrc,
+		config:  config,
+		payload: make([]byte, flexFECHeaderSize+1500),
+		raw:     make([]byte, 1500),
+	}
+}
+
+// overhead returns the repair over media packets ratio in percentage
+func (f *flexFEC) overhead() uint64 {
+	gs := atomic.LoadInt32(&f.groupSize)
+	if gs == 0 {
+		return 0
+	}
+	return uint64(100 / gs)
+}
+
+// updateLoss adapts the protection level to the loss fraction reported by the subscriber,
+// the overhead is twice the loss rate bounded by the configured max overhead.
+func (f *flexFEC) updateLoss(fractionLost uint8) {
+	loss := int32(fractionLost) * 100 / 256
+	gs := atomic.LoadInt32(&f.groupSize)
+	switch {
+	case loss >= int32(f.config.LossThreshold) && loss > 0:
+		overhead := 2 * loss
+		if overhead > int32(f.config.MaxOverhead) {
+			overhead = int32(f.config.MaxOverhead)
+		}
+		gs = flexFECMaxGroupSize
+		if overhead > 0 && 100/overhead < gs {
+			gs = 100 / overhead
+		}
+		if gs < 2 {
+			gs = 2
+		}
+	case loss < int32(f.config.LossThreshold)/2:
+		gs = 0
+	}
+	atomic.StoreInt32(&f.groupSize, gs)
+}
+
+// push adds a sent media packet to the current protection group, once the group is
+// complete the repair packet header and payload are returned.
+func (f *flexFEC) push(hdr *rtp.Header, payload []byte) (*rtp.Header, []byte, bool) {
+	gs := int(atomic.LoadInt32(&f.groupSize))
+	if gs == 0 {
+		f.count = 0
+		return nil, nil, false
+	}
+	if f.count > 0 && hdr.SequenceNumber != f.nextSN {
+		// Only consecutive packets are protected, restart the group
+		f.count = 0
+	}
+
+	n, err := hdr.MarshalTo(f.raw)
+	if err != nil || n+len(payload) > len(f.raw) {
+		f.count = 0
+		return nil, nil, false
+	}
+	n += copy(f.raw[n:], payload)
+
+	if f.count == 0 {
+		f.baseSN = hdr.SequenceNumber
+		f.mask = 0
+		f.recovery = [2]byte{}
+		f.lengthRecovery = 0
+		f.tsRecovery = 0
+		f.payloadLen = 0
+	}
+
+	f.recovery[0] ^= f.raw[0]
+	f.recovery[1] ^= f.raw[1]
+	f.lengthRecovery ^= uint16(n - rtpHeaderSize)
+	f.tsRecovery ^= hdr.Timestamp
+	fecPayload := f.payload[flexFECHeaderSize:]
+	for i := rtpHeaderSize; i < n; i++ {
+		idx := i - rtpHeaderSize
+		if idx >= f.payloadLen {
+			fecPayload[idx] = 0
+		}
+		fecPayload[idx] ^= f.raw[i]
+	}
+	if n-rtpHeaderSize > f.payloadLen {
+		f.payloadLen = n - rtpHeaderSize
+	}
+	f.mask |= 1 << (14 - uint16(hdr.SequenceNumber-f.baseSN))
+	f.nextSN = hdr.SequenceNumber + 1
+	f.lastTS = hdr.Timestamp
+	f.count++
+
+	if f.count < gs && f.count < flexFECMaxGroupSize {
+		return nil, nil, false
+	}
+	f.count = 0
+
+	buf := f.payload
+	// R and F bits are zero, recovering the P, X and CC bits
+	buf[0] = f.recovery[0] & 0x3f
+	buf[1] = f.recovery[1]
+	binary.BigEndian.PutUint16(buf[2:], f.lengthRecovery)
+	binary.BigEndian.PutUint32(buf[4:], f.tsRecovery)
+	buf[8] = 1
+	buf[9], buf[10], buf[11] = 0, 0, 0
+	binary.BigEndian.PutUint32(buf[12:], hdr.SSRC)
+	binary.BigEndian.PutUint16(buf[16:], f.baseSN)
+	binary.BigEndian.PutUint16(buf[18:], 0x8000|f.mask)
+
+	f.sequenceNumber++
+	return &rtp.Header{
+		Version:        2,
+		PayloadType:    f.payloadType,
+		SequenceNumber: f.sequenceNumber,
+		Timestamp:      f.lastTS,
+		SSRC:           f.ssrc,
+	}, buf[:flexFECHeaderSize+f.payloadLen], true
+}
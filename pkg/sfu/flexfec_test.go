@@ -0,0 +1,113 @@
+package sfu
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_flexFEC_updateLoss(t *testing.T) {
+	tests := []struct {
+		name         string
+		fractionLost uint8
+		current      int32
+		want         int32
+	}{
+		{
+			name:         "Must keep disabled under threshold",
+			fractionLost: 10,
+			want:         0,
+		},
+		{
+			name:         "Must enable over threshold",
+			fractionLost: 26,
+			want:         5,
+		},
+		{
+			name:         "Must bound overhead",
+			fractionLost: 128,
+			want:         4,
+		},
+		{
+			name:         "Must keep enabled in hysteresis range",
+			fractionLost: 8,
+			current:      5,
+			want:         5,
+		},
+		{
+			name:         "Must disable under half threshold",
+			fractionLost: 2,
+			current:      5,
+			want:         0,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFlexFEC(1, FECConfig{Enabled: true, LossThreshold: 5, MaxOverhead: 25})
+			f.groupSize = tt.current
+			f.updateLoss(tt.fractionLost)
+			assert.Equal(t, tt.want, f.groupSize)
+		})
+	}
+}
+
+func Test_flexFEC_push(t *testing.T) {
+	f := newFlexFEC(1234, FECConfig{})
+	f.payloadType = flexFECPayloadType
+	f.groupSize = 3
+
+	var packets [][]byte
+	var fecPayload []byte
+	for i := 0; i < 3; i++ {
+		hdr := rtp.Header{
+			Version:        2,
+			Marker:         i == 2,
+			PayloadType:    96,
+			SequenceNumber: uint16(65534 + i),
+			Timestamp:      3000,
+			SSRC:           5678,
+		}
+		payload := make([]byte, 10+i*5)
+		for j := range payload {
+			payload[j] = byte(i*31 + j)
+		}
+		raw, err := (&rtp.Packet{Header: hdr, Payload: payload}).Marshal()
+		assert.NoError(t, err)
+		packets = append(packets, raw)
+
+		fecHdr, p, ok := f.push(&hdr, payload)
+		if i < 2 {
+			assert.False(t, ok)
+			continue
+		}
+		assert.True(t, ok)
+		assert.Equal(t, uint32(1234), fecHdr.SSRC)
+		assert.Equal(t, uint8(flexFECPayloadType), fecHdr.PayloadType)
+		fecPayload = p
+	}
+
+	assert.Equal(t, uint32(5678), binary.BigEndian.Uint32(fecPayload[12:]))
+	assert.Equal(t, uint16(65534), binary.BigEndian.Uint16(fecPayload[16:]))
+	assert.Equal(t, uint16(0x8000|0x7000), binary.BigEndian.Uint16(fecPayload[18:]))
+
+	// Recover the second packet from the others and the repair packet
+	lost := packets[1]
+	length := binary.BigEndian.Uint16(fecPayload[2:])
+	recovered := make([]byte, len(fecPayload)-flexFECHeaderSize)
+	copy(recovered, fecPayload[flexFECHeaderSize:])
+	first := fecPayload[1]
+	for _, idx := range []int{0, 2} {
+		pkt := packets[idx]
+		length ^= uint16(len(pkt) - rtpHeaderSize)
+		first ^= pkt[1]
+		for j := rtpHeaderSize; j < len(pkt); j++ {
+			recovered[j-rtpHeaderSize] ^= pkt[j]
+		}
+	}
+	assert.Equal(t, uint16(len(lost)-rtpHeaderSize), length)
+	assert.Equal(t, lost[1], first)
+	assert.Equal(t, lost[rtpHeaderSize:], recovered[:length])
+}
@@ -106,6 +106,19 @@ func ntpToMillisSinceEpoch(ntp uint64) uint64 {
 	return (((ntp & 0xFFFFFFFF) * 1000) >> 32) + ((ntp >> 32) * 1000)
 }
 
+// projectSenderReport moves the last sender report of the source to the given time, the
+// source NTP clock is kept so the tracks of a publisher stay in sync across relay and
+// pull hops.
+func projectSenderReport(srRTP uint32, srNTP uint64, srRecv, now int64, clockRate uint32) (uint32, uint64) {
+	elapsed := now - srRecv
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	sec := uint64(elapsed) / 1e9
+	frac := ((uint64(elapsed) % 1e9) << 32) / 1e9
+	return srRTP + uint32(uint64(elapsed)*uint64(clockRate)/1e9), srNTP + (sec<<32 | frac)
+}
+
 func fastForwardTimestampAmount(newestTimestamp uint32, referenceTimestamp uint32) uint32 {
 	if buffer.IsTimestampWrapAround(newestTimestamp, referenceTimestamp) {
 		return uint32(uint64(newestTimestamp) + 0x100000000 - uint64(referenceTimestamp))
@@ -140,3 +153,29 @@ func toNtpTime(t time.Time) ntpTime {
 	}
 	return ntpTime(sec<<32 | frac)
 }
+
+// reportRTT returns the round trip time in ms from the last sender report and delay
+// fields of a reception report received at now, zero when not computable.
+func reportRTT(now ntpTime, lsr, dlsr uint32) uint32 {
+	if lsr == 0 {
+		return 0
+	}
+	// Middle 32 bits of the NTP time in 1/65536 seconds
+	rtt := int64(uint32(now>>16)) - int64(lsr) - int64(dlsr)
+	if rtt < 0 {
+		return 0
+	}
+	return uint32(rtt * 1000 >> 16)
+}
+
+// fmtpParameter returns the value of a parameter of a fmtp line, e.g. the apt of a
+// RTX codec, and false when the line doesn't hold it.
+func fmtpParameter(fmtp, key string) (string, bool) {
+	for _, param := range strings.Split(fmtp, ";") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), key) {
+			return strings.TrimSpace(kv[1]), true
+		}
+	}
+	return "", false
+}
@@ -32,3 +32,130 @@ func Test_timeToNtp(t *testing.T) {
 		})
 	}
 }
+
+func Test_projectSenderReport(t *testing.T) {
+	type args struct {
+		srRTP     uint32
+		srNTP     uint64
+		srRecv    int64
+		now       int64
+		clockRate uint32
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRTP uint32
+		wantNTP uint64
+	}{
+		{
+			name: "Must advance RTP and NTP times by elapsed time",
+			args: args{
+				srRTP:     90000,
+				srNTP:     10 << 32,
+				srRecv:    int64(time.Second),
+				now:       int64(2500 * time.Millisecond),
+				clockRate: 90000,
+			},
+			wantRTP: 225000,
+			wantNTP: 11<<32 | 1<<31,
+		},
+		{
+			name: "Must wrap RTP time",
+			args: args{
+				srRTP:     0xffffffff - 47999,
+				srNTP:     10 << 32,
+				srRecv:    0,
+				now:       int64(2 * time.Second),
+				clockRate: 48000,
+			},
+			wantRTP: 48000,
+			wantNTP: 12 << 32,
+		},
+		{
+			name: "Must not go back in time",
+			args: args{
+				srRTP:     1000,
+				srNTP:     10 << 32,
+				srRecv:    int64(time.Second),
+				now:       0,
+				clockRate: 48000,
+			},
+			wantRTP: 1000,
+			wantNTP: 10 << 32,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			gotRTP, gotNTP := projectSenderReport(tt.args.srRTP, tt.args.srNTP, tt.args.srRecv, tt.args.now, tt.args.clockRate)
+			if gotRTP != tt.wantRTP {
+				t.Errorf("projectSenderReport() gotRTP = %v, want %v", gotRTP, tt.wantRTP)
+			}
+			if gotNTP != tt.wantNTP {
+				t.Errorf("projectSenderReport() gotNTP = %v, want %v", gotNTP, tt.wantNTP)
+			}
+		})
+	}
+}
+
+func Test_reportRTT(t *testing.T) {
+	tests := []struct {
+		name string
+		now  ntpTime
+		lsr  uint32
+		dlsr uint32
+		want uint32
+	}{
+		{
+			name: "Must return the round trip time in ms",
+			now:  ntpTime(uint64(0x00018000+6554) << 16),
+			lsr:  0x00010000,
+			dlsr: 0x8000,
+			want: 100,
+		},
+		{
+			name: "Must return zero without sender report",
+			now:  ntpTime(uint64(0x00018000) << 16),
+			want: 0,
+		},
+		{
+			name: "Must return zero when the delay is after now",
+			now:  ntpTime(uint64(0x00018000) << 16),
+			lsr:  0x00010000,
+			dlsr: 0x10000,
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reportRTT(tt.now, tt.lsr, tt.dlsr); got != tt.want {
+				t.Errorf("reportRTT() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fmtpParameter(t *testing.T) {
+	tests := []struct {
+		name  string
+		fmtp  string
+		key   string
+		want  string
+		found bool
+	}{
+		{name: "Must return the parameter", fmtp: "apt=100", key: "apt", want: "100", found: true},
+		{name: "Must find the parameter among others", fmtp: "level-asymmetry-allowed=1; apt=10;rtx-time=3000", key: "apt", want: "10", found: true},
+		{name: "Must not match a key prefix", fmtp: "xapt=10", key: "apt"},
+		{name: "Must not find a missing parameter", fmtp: "minptime=10;useinbandfec=1", key: "apt"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := fmtpParameter(tt.fmtp, tt.key)
+			if got != tt.want || found != tt.found {
+				t.Errorf("fmtpParameter() = %v, %v, want %v, %v", got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
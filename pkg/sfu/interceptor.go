@@ -0,0 +1,62 @@
+package sfu
+
+import (
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/rtp"
+)
+
+type (
+	// PacketArgs are the arguments passed to the packet interceptors. On the receive
+	// path DownTrack is nil and the packet is shared by all the DownTracks of the
+	// receiver, so interceptors rewriting it must do it on a copy from ClonePacket.
+	// Packets held to be delayed must be cloned too, since the packet memory is
+	// reused by the publisher buffer. The receiver serializes the forwards of a layer
+	// and the DownTrack its writes, so the next processor may be called from another
+	// goroutine on both paths.
+	PacketArgs struct {
+		Receiver  Receiver
+		DownTrack *DownTrack
+		Layer     int
+		Packet    *buffer.ExtPacket
+	}
+
+	// PacketInterceptors are executed in order for each packet, an interceptor drops
+	// a packet by not calling the next processor.
+	PacketInterceptors []func(PacketProcessor) PacketProcessor
+
+	PacketProcessor interface {
+		Process(args PacketArgs) error
+	}
+
+	PacketProcessFunc func(args PacketArgs) error
+)
+
+func (p PacketProcessFunc) Process(args PacketArgs) error {
+	return p(args)
+}
+
+// Process returns a PacketProcessor executing the interceptors before the last processor
+func (pis PacketInterceptors) Process(last PacketProcessor) PacketProcessor {
+	if len(pis) == 0 {
+		return last
+	}
+	h := pis[len(pis)-1](last)
+	for i := len(pis) - 2; i >= 0; i-- {
+		h = pis[i](h)
+	}
+	return h
+}
+
+// ClonePacket returns a copy of the packet owning its memory
+func ClonePacket(pkt *buffer.ExtPacket) (*buffer.ExtPacket, error) {
+	raw, err := pkt.Packet.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	cp := *pkt
+	cp.Packet = rtp.Packet{}
+	if err = cp.Packet.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
@@ -0,0 +1,76 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketInterceptors_Process(t *testing.T) {
+	var calls []string
+	named := func(name string, drop bool) func(PacketProcessor) PacketProcessor {
+		return func(next PacketProcessor) PacketProcessor {
+			return PacketProcessFunc(func(args PacketArgs) error {
+				calls = append(calls, name)
+				if drop {
+					return nil
+				}
+				return next.Process(args)
+			})
+		}
+	}
+	last := PacketProcessFunc(func(args PacketArgs) error {
+		calls = append(calls, "last")
+		return nil
+	})
+
+	tests := []struct {
+		name         string
+		interceptors PacketInterceptors
+		want         []string
+	}{
+		{
+			name: "Must call last processor without interceptors",
+			want: []string{"last"},
+		},
+		{
+			name:         "Must call interceptors in order",
+			interceptors: PacketInterceptors{named("a", false), named("b", false)},
+			want:         []string{"a", "b", "last"},
+		},
+		{
+			name:         "Must drop packet",
+			interceptors: PacketInterceptors{named("a", true), named("b", false)},
+			want:         []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			assert.NoError(t, tt.interceptors.Process(last).Process(PacketArgs{}))
+			assert.Equal(t, tt.want, calls)
+		})
+	}
+}
+
+func TestClonePacket(t *testing.T) {
+	payload := []byte{1, 2, 3}
+	pkt := &buffer.ExtPacket{
+		Head:     true,
+		KeyFrame: true,
+		Packet: rtp.Packet{
+			Header:  rtp.Header{Version: 2, SequenceNumber: 10, Timestamp: 20, SSRC: 30},
+			Payload: payload,
+		},
+	}
+	cp, err := ClonePacket(pkt)
+	assert.NoError(t, err)
+	payload[0] = 9
+	assert.Equal(t, []byte{1, 2, 3}, cp.Packet.Payload)
+	assert.Equal(t, pkt.Packet.Header.SequenceNumber, cp.Packet.Header.SequenceNumber)
+	assert.True(t, cp.KeyFrame)
+	assert.True(t, cp.Head)
+}
@@ -0,0 +1,98 @@
+package sfu
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	defaultPLIInterval = 500 * time.Millisecond
+	defaultFIRTimeout  = 2 * time.Second
+)
+
+// keyFrameRequester coalesces the keyframe requests of all the DownTracks of a
+// receiver, sending at most one request per layer on each interval. If a keyframe
+// does not arrive after a request, the request is escalated to a FIR.
+type keyFrameRequester struct {
+	sync.Mutex
+	minInterval int64
+	firTimeout  int64
+	senderSSRC  uint32
+	firSeqNo    uint8
+	layers      [3]keyFrameRequestState
+	send        func([]rtcp.Packet)
+}
+
+type keyFrameRequestState struct {
+	ssrc        uint32
+	lastRequest int64
+	// pending is set when a request was coalesced and must be sent after the interval
+	pending bool
+	// waiting is set since a request is sent until a keyframe arrives
+	waiting bool
+}
+
+func newKeyFrameRequester(senderSSRC uint32, minInterval, firTimeout time.Duration, send func([]rtcp.Packet)) *keyFrameRequester {
+	if minInterval <= 0 {
+		minInterval = defaultPLIInterval
+	}
+	if firTimeout <= 0 {
+		firTimeout = defaultFIRTimeout
+	}
+	return &keyFrameRequester{
+		minInterval: int64(minInterval),
+		firTimeout:  int64(firTimeout),
+		senderSSRC:  senderSSRC,
+		send:        send,
+	}
+}
+
+// request asks for a keyframe of the layer, requests within the interval are coalesced
+func (k *keyFrameRequester) request(layer int, ssrc uint32, now int64) {
+	k.Lock()
+	defer k.Unlock()
+	st := &k.layers[layer]
+	st.ssrc = ssrc
+	if now-st.lastRequest < k.minInterval {
+		st.pending = true
+		return
+	}
+	k.sendRequest(st, now)
+}
+
+// onPacket tracks the keyframes arrival, sending the coalesced and escalated requests
+func (k *keyFrameRequester) onPacket(layer int, keyFrame bool, now int64) {
+	k.Lock()
+	defer k.Unlock()
+	st := &k.layers[layer]
+	if keyFrame {
+		st.pending = false
+		st.waiting = false
+		return
+	}
+	if st.pending && now-st.lastRequest >= k.minInterval ||
+		st.waiting && now-st.lastRequest >= k.firTimeout {
+		k.sendRequest(st, now)
+	}
+}
+
+func (k *keyFrameRequester) sendRequest(st *keyFrameRequestState, now int64) {
+	var pkt rtcp.Packet
+	if st.waiting && now-st.lastRequest >= k.firTimeout {
+		// The publisher ignored the last request, escalate it
+		k.firSeqNo++
+		pkt = &rtcp.FullIntraRequest{
+			SenderSSRC: k.senderSSRC,
+			MediaSSRC:  st.ssrc,
+			FIR:        []rtcp.FIREntry{{SSRC: st.ssrc, SequenceNumber: k.firSeqNo}},
+		}
+	} else {
+		pkt = &rtcp.PictureLossIndication{SenderSSRC: k.senderSSRC, MediaSSRC: st.ssrc}
+	}
+	st.lastRequest = now
+	st.pending = false
+	st.waiting = true
+	k.send([]rtcp.Packet{pkt})
+}
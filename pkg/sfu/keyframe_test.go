@@ -0,0 +1,44 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keyFrameRequester(t *testing.T) {
+	var sent []rtcp.Packet
+	k := newKeyFrameRequester(1, 500*time.Millisecond, 2*time.Second, func(pkts []rtcp.Packet) {
+		sent = append(sent, pkts...)
+	})
+	ms := int64(time.Millisecond)
+	now := int64(10 * time.Second)
+
+	k.request(0, 1234, now)
+	k.request(0, 1234, now+10*ms)
+	k.request(0, 1234, now+20*ms)
+	assert.Len(t, sent, 1, "must coalesce requests within the interval")
+	assert.IsType(t, &rtcp.PictureLossIndication{}, sent[0])
+
+	k.onPacket(0, false, now+100*ms)
+	assert.Len(t, sent, 1)
+	k.onPacket(0, false, now+500*ms)
+	assert.Len(t, sent, 2, "must send coalesced request after the interval")
+	assert.IsType(t, &rtcp.PictureLossIndication{}, sent[1])
+
+	k.onPacket(0, false, now+2500*ms)
+	assert.Len(t, sent, 3, "must escalate when keyframe does not arrive")
+	fir, ok := sent[2].(*rtcp.FullIntraRequest)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1234), fir.FIR[0].SSRC)
+	assert.Equal(t, uint8(1), fir.FIR[0].SequenceNumber)
+
+	k.onPacket(0, true, now+2600*ms)
+	k.onPacket(0, false, now+6000*ms)
+	assert.Len(t, sent, 3, "must stop requests once keyframe arrives")
+
+	k.request(1, 5678, now+6000*ms)
+	assert.Len(t, sent, 4, "layers must be throttled independently")
+}
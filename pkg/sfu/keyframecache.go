@@ -0,0 +1,59 @@
+package sfu
+
+import "github.com/pion/ion-sfu/pkg/buffer"
+
+// keyFrameCache retains the packets of the most recent keyframe and the following
+// delta frames of a layer, so new DownTracks can start decoding without waiting for
+// a keyframe requested to the publisher.
+type keyFrameCache struct {
+	maxPackets int
+	timestamp  uint32
+	packets    []*buffer.ExtPacket
+}
+
+func newKeyFrameCache(maxPackets int) *keyFrameCache {
+	return &keyFrameCache{
+		maxPackets: maxPackets,
+		packets:    make([]*buffer.ExtPacket, 0, maxPackets),
+	}
+}
+
+// push stores a copy of the packet, the packets in the publisher buffer are overwritten
+// once the bucket wraps, so the cache owns its memory.
+func (c *keyFrameCache) push(pkt *buffer.ExtPacket) {
+	if pkt.KeyFrame && (len(c.packets) == 0 || c.timestamp != pkt.Packet.Timestamp) {
+		c.reset()
+		c.timestamp = pkt.Packet.Timestamp
+	} else if len(c.packets) == 0 {
+		// Waiting for a keyframe
+		return
+	}
+	if len(c.packets) >= c.maxPackets {
+		// Too many packets to be replayed, wait for the next keyframe
+		c.reset()
+		return
+	}
+
+	cp, err := ClonePacket(pkt)
+	if err != nil {
+		return
+	}
+	c.packets = append(c.packets, cp)
+}
+
+func (c *keyFrameCache) reset() {
+	for i := range c.packets {
+		c.packets[i] = nil
+	}
+	c.packets = c.packets[:0]
+}
+
+// replay writes the cached packets into a new DownTrack
+func (c *keyFrameCache) replay(dt *DownTrack, layer int) error {
+	for _, pkt := range c.packets {
+		if err := dt.WriteRTP(pkt, layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
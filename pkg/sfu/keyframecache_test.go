@@ -0,0 +1,49 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keyFrameCache_push(t *testing.T) {
+	packet := func(sn uint16, ts uint32, keyFrame bool) *buffer.ExtPacket {
+		return &buffer.ExtPacket{
+			Head:     true,
+			KeyFrame: keyFrame,
+			Packet: rtp.Packet{
+				Header:  rtp.Header{Version: 2, SequenceNumber: sn, Timestamp: ts},
+				Payload: []byte{byte(sn)},
+			},
+		}
+	}
+	sns := func(c *keyFrameCache) []uint16 {
+		var res []uint16
+		for _, p := range c.packets {
+			res = append(res, p.Packet.SequenceNumber)
+		}
+		return res
+	}
+
+	c := newKeyFrameCache(4)
+	c.push(packet(1, 0, false))
+	assert.Empty(t, c.packets, "must wait for a keyframe")
+
+	c.push(packet(2, 100, true))
+	c.push(packet(3, 100, true))
+	c.push(packet(4, 200, false))
+	assert.Equal(t, []uint16{2, 3, 4}, sns(c))
+
+	pkt := packet(5, 300, false)
+	c.push(pkt)
+	pkt.Packet.Payload[0] = 0
+	assert.Equal(t, []byte{5}, c.packets[3].Packet.Payload, "must own the packet memory")
+
+	c.push(packet(6, 400, false))
+	assert.Empty(t, c.packets, "must drop the cache over the max packets")
+
+	c.push(packet(7, 500, true))
+	assert.Equal(t, []uint16{7}, sns(c))
+}
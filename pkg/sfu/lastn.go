@@ -0,0 +1,98 @@
+package sfu
+
+import "time"
+
+// LastNConfig defines the last-N video forwarding, only the video of the N most recent
+// active speakers and the streams pinned by each subscriber are forwarded.
+type LastNConfig struct {
+	// N is the number of speakers with video forwarded, zero disables last-N
+	N int `mapstructure:"n"`
+	// Hold is the min time in ms a speaker video keeps being forwarded after the
+	// speaker stopped talking, before being replaced by a new speaker.
+	Hold int `mapstructure:"hold"`
+}
+
+// lastNSelector selects the N most recent active speakers from the audio observer output
+type lastNSelector struct {
+	config LastNConfig
+	n      int
+	hold   int64
+	// selected holds the stream ids of the selected speakers
+	selected []string
+	// lastActive holds the last time in unix nanoseconds each stream was speaking
+	lastActive map[string]int64
+}
+
+func newLastNSelector(config LastNConfig) *lastNSelector {
+	return &lastNSelector{
+		config:     config,
+		n:          config.N,
+		hold:       int64(config.Hold) * int64(time.Millisecond),
+		lastActive: make(map[string]int64),
+	}
+}
+
+// update takes the current speakers ordered by loudness and the published audio
+// streams, and returns the selected streams. A selected stream is only replaced once it
+// has been silent for the hold time, the streams no longer published are dropped.
+func (l *lastNSelector) update(speakers, streams []string, now int64) []string {
+	published := make(map[string]bool, len(streams))
+	for _, id := range streams {
+		published[id] = true
+	}
+	for id := range l.lastActive {
+		if !published[id] {
+			delete(l.lastActive, id)
+		}
+	}
+	selected := l.selected[:0]
+	for _, id := range l.selected {
+		if published[id] {
+			selected = append(selected, id)
+		}
+	}
+	l.selected = selected
+
+	for _, id := range speakers {
+		l.lastActive[id] = now
+	}
+
+	for _, id := range speakers {
+		if l.isSelected(id) {
+			continue
+		}
+		if len(l.selected) < l.n {
+			l.selected = append(l.selected, id)
+			continue
+		}
+		oldest := -1
+		for i, sid := range l.selected {
+			if oldest == -1 || l.lastActive[sid] < l.lastActive[l.selected[oldest]] {
+				oldest = i
+			}
+		}
+		if oldest == -1 || now-l.lastActive[l.selected[oldest]] < l.hold {
+			break
+		}
+		delete(l.lastActive, l.selected[oldest])
+		l.selected[oldest] = id
+	}
+
+	selected = make([]string, len(l.selected))
+	copy(selected, l.selected)
+	return selected
+}
+
+// full returns true once N speakers are selected, until then all the videos are forwarded
+func (l *lastNSelector) full() bool {
+	return len(l.selected) >= l.n
+}
+
+func (l *lastNSelector) isSelected(streamID string) bool {
+	for _, id := range l.selected {
+		if id == streamID {
+			return true
+		}
+	}
+	return false
+}
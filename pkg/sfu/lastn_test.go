@@ -0,0 +1,111 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lastNSelector_update(t *testing.T) {
+	type step struct {
+		speakers []string
+		// streams are the published audio streams, a, b and c when nil
+		streams []string
+		at      time.Duration
+		want    []string
+		full    bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "Must select first speakers",
+			steps: []step{
+				{speakers: []string{"a", "b", "c"}, want: []string{"a", "b"}, full: true},
+			},
+		},
+		{
+			name: "Must not be full before N speakers",
+			steps: []step{
+				{want: []string{}},
+				{speakers: []string{"a"}, want: []string{"a"}},
+			},
+		},
+		{
+			name: "Must keep silent speaker during hold",
+			steps: []step{
+				{speakers: []string{"a", "b"}, want: []string{"a", "b"}, full: true},
+				{speakers: []string{"c"}, at: time.Second, want: []string{"a", "b"}, full: true},
+			},
+		},
+		{
+			name: "Must replace least recent speaker after hold",
+			steps: []step{
+				{speakers: []string{"a", "b"}, want: []string{"a", "b"}, full: true},
+				{speakers: []string{"b"}, at: 2 * time.Second, want: []string{"a", "b"}, full: true},
+				{speakers: []string{"c"}, at: 3 * time.Second, want: []string{"c", "b"}, full: true},
+			},
+		},
+		{
+			name: "Must drop the streams no longer published",
+			steps: []step{
+				{speakers: []string{"a", "b"}, want: []string{"a", "b"}, full: true},
+				{speakers: []string{"c"}, streams: []string{"b", "c"}, at: time.Second, want: []string{"b", "c"}, full: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLastNSelector(LastNConfig{N: 2, Hold: 2000})
+			for _, s := range tt.steps {
+				streams := s.streams
+				if streams == nil {
+					streams = []string{"a", "b", "c"}
+				}
+				assert.Equal(t, s.want, l.update(s.speakers, streams, int64(s.at)))
+				assert.Equal(t, s.full, l.full())
+				for id := range l.lastActive {
+					assert.Contains(t, streams, id)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionLocal_forwardLastN(t *testing.T) {
+	video := func(streamID string) *DownTrack {
+		return &DownTrack{codec: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, streamID: streamID}
+	}
+	a, b, screen := video("a"), video("b"), video("screen")
+	sub := &Subscriber{
+		tracks: map[string][]*DownTrack{"a": {a}, "b": {b}, "screen": {screen}},
+		pinned: make(map[string]struct{}),
+	}
+	s := &SessionLocal{peers: map[string]Peer{"peer": &PeerLocal{id: "peer", subscriber: sub}}}
+	streams := []string{"a", "b"}
+
+	// Must forward all the streams until N speakers are selected
+	s.forwardLastN([]string{"a"}, streams, false)
+	assert.False(t, b.paused.get())
+
+	// Must pause the streams out of the selection but the streams without audio
+	s.forwardLastN([]string{"a"}, streams, true)
+	assert.False(t, a.paused.get())
+	assert.True(t, b.paused.get())
+	assert.False(t, screen.paused.get())
+
+	// Must forward a pinned stream at once and while out of the selection
+	sub.SetPinnedStreams("b")
+	assert.False(t, b.paused.get())
+	s.forwardLastN([]string{"a"}, streams, true)
+	assert.False(t, b.paused.get())
+
+	// Must pause an unpinned stream out of the selection
+	sub.SetPinnedStreams()
+	s.forwardLastN([]string{"a"}, streams, true)
+	assert.True(t, b.paused.get())
+}
@@ -1,6 +1,10 @@
 package sfu
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 )
@@ -8,81 +12,184 @@ import (
 const (
 	mimeTypeH264 = "video/h264"
 	mimeTypeOpus = "audio/opus"
+	mimeTypeRED  = "audio/red"
+	mimeTypeRTX  = "video/rtx"
 	mimeTypeVP8  = "video/vp8"
 	mimeTypeVP9  = "video/vp9"
 )
 
-const frameMarking = "urn:ietf:params:rtp-hdrext:framemarking"
+const (
+	opusPayloadType = 111
+	redPayloadType  = 63
+)
+
+// CodecConfig defines a codec negotiated with the publishers
+type CodecConfig struct {
+	Mime        string `mapstructure:"mime"`
+	ClockRate   uint32 `mapstructure:"clockrate"`
+	Channels    uint16 `mapstructure:"channels"`
+	Fmtp        string `mapstructure:"fmtp"`
+	PayloadType uint8  `mapstructure:"payloadtype"`
+	// RTXPayloadType is the payload type of the retransmissions, zero disables RTX for the codec
+	RTXPayloadType uint8 `mapstructure:"rtxpayloadtype"`
+	// RTCPFeedback lists the feedback as "type" or "type parameter", e.g. "nack pli"
+	RTCPFeedback []string `mapstructure:"rtcpfeedback"`
+}
+
+// SessionCodecsConfig restricts the codecs of a session
+type SessionCodecsConfig struct {
+	ID string `mapstructure:"id"`
+	// Codecs lists the mime types allowed in the session
+	Codecs []string `mapstructure:"codecs"`
+}
+
+// MediaConfig defines the codecs and header extensions negotiated with the publishers,
+// the built in codecs and extensions are used when they are not set.
+type MediaConfig struct {
+	Codecs          []CodecConfig         `mapstructure:"codecs"`
+	AudioExtensions []string              `mapstructure:"audioextensions"`
+	VideoExtensions []string              `mapstructure:"videoextensions"`
+	Sessions        []SessionCodecsConfig `mapstructure:"sessions"`
+}
+
+var (
+	videoRTCPFeedback = []string{"goog-remb", "ccm fir", "nack", "nack pli"}
+
+	defaultCodecs = []CodecConfig{
+		{Mime: mimeTypeOpus, ClockRate: 48000, Channels: 2, Fmtp: "minptime=10;useinbandfec=1", PayloadType: opusPayloadType},
+		{Mime: mimeTypeVP8, ClockRate: 90000, PayloadType: 96, RTXPayloadType: 97, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeVP9, ClockRate: 90000, Fmtp: "profile-id=0", PayloadType: 98, RTXPayloadType: 99, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeVP9, ClockRate: 90000, Fmtp: "profile-id=1", PayloadType: 100, RTXPayloadType: 101, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeH264, ClockRate: 90000, Fmtp: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f", PayloadType: 102, RTXPayloadType: 103, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeH264, ClockRate: 90000, Fmtp: "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42001f", PayloadType: 127, RTXPayloadType: 104, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeH264, ClockRate: 90000, Fmtp: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", PayloadType: 125, RTXPayloadType: 107, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeH264, ClockRate: 90000, Fmtp: "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42e01f", PayloadType: 108, RTXPayloadType: 109, RTCPFeedback: videoRTCPFeedback},
+		{Mime: mimeTypeH264, ClockRate: 90000, Fmtp: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032", PayloadType: 123, RTXPayloadType: 124, RTCPFeedback: videoRTCPFeedback},
+	}
+
+	defaultVideoExtensions = []string{
+		sdp.SDESMidURI,
+		sdp.SDESRTPStreamIDURI,
+		sdp.TransportCCURI,
+		buffer.FrameMarkingURI,
+		buffer.DependencyDescriptorURI,
+	}
+
+	defaultAudioExtensions = []string{
+		sdp.SDESMidURI,
+		sdp.SDESRTPStreamIDURI,
+		sdp.AudioLevelURI,
+	}
+)
+
+// codecs returns the configured codecs or the built in ones, a nil slice means not
+// configured while an empty one means no codec allowed.
+func (m MediaConfig) codecs() []CodecConfig {
+	if m.Codecs == nil {
+		return defaultCodecs
+	}
+	return m.Codecs
+}
+
+// restrict returns a copy of the configuration allowing only the given mime types
+func (m MediaConfig) restrict(mimes []string) MediaConfig {
+	codecs := make([]CodecConfig, 0, len(mimes))
+	for _, codec := range m.codecs() {
+		for _, mime := range mimes {
+			if strings.EqualFold(codec.Mime, mime) {
+				codecs = append(codecs, codec)
+				break
+			}
+		}
+	}
+	m.Codecs = codecs
+	return m
+}
+
+// rtxCodec returns the RFC 4588 codec retransmitting the given payload type
+func (m MediaConfig) rtxCodec(apt webrtc.PayloadType) (webrtc.RTPCodecParameters, bool) {
+	for _, codec := range m.codecs() {
+		if webrtc.PayloadType(codec.PayloadType) == apt && codec.RTXPayloadType != 0 {
+			return rtxCodecParameters(apt, webrtc.PayloadType(codec.RTXPayloadType)), true
+		}
+	}
+	return webrtc.RTPCodecParameters{}, false
+}
+
+// parameters returns the codec parameters and the kind of the codec
+func (c CodecConfig) parameters() (webrtc.RTPCodecParameters, webrtc.RTPCodecType, error) {
+	var kind webrtc.RTPCodecType
+	switch mime := strings.ToLower(c.Mime); {
+	case strings.HasPrefix(mime, "audio/"):
+		kind = webrtc.RTPCodecTypeAudio
+	case strings.HasPrefix(mime, "video/"):
+		kind = webrtc.RTPCodecTypeVideo
+	default:
+		return webrtc.RTPCodecParameters{}, 0, fmt.Errorf("invalid codec mime type: %s", c.Mime)
+	}
+	feedback := make([]webrtc.RTCPFeedback, 0, len(c.RTCPFeedback))
+	for _, fb := range c.RTCPFeedback {
+		typ, param := fb, ""
+		if i := strings.IndexByte(fb, ' '); i > 0 {
+			typ, param = fb[:i], strings.TrimSpace(fb[i+1:])
+		}
+		feedback = append(feedback, webrtc.RTCPFeedback{Type: typ, Parameter: param})
+	}
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:     c.Mime,
+			ClockRate:    c.ClockRate,
+			Channels:     c.Channels,
+			SDPFmtpLine:  c.Fmtp,
+			RTCPFeedback: feedback,
+		},
+		PayloadType: webrtc.PayloadType(c.PayloadType),
+	}, kind, nil
+}
 
 func GetMediaEngine() (*webrtc.MediaEngine, error) {
 	me, err := getSubscriberMediaEngine()
 	return me, err
 }
 
-func getPublisherMediaEngine() (*webrtc.MediaEngine, error) {
+func getPublisherMediaEngine(c RouterConfig) (*webrtc.MediaEngine, error) {
 	me := &webrtc.MediaEngine{}
-	if err := me.RegisterCodec(webrtc.RTPCodecParameters{
-		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1", RTCPFeedback: nil},
-		PayloadType:        111,
-	}, webrtc.RTPCodecTypeAudio); err != nil {
-		return nil, err
-	}
-
-	videoRTCPFeedback := []webrtc.RTCPFeedback{{"goog-remb", ""}, {"ccm", "fir"}, {"nack", ""}, {"nack", "pli"}}
-	for _, codec := range []webrtc.RTPCodecParameters{
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeVP8, ClockRate: 90000, RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        96,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeVP9, ClockRate: 90000, SDPFmtpLine: "profile-id=0", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        98,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeVP9, ClockRate: 90000, SDPFmtpLine: "profile-id=1", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        100,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        102,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42001f", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        127,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        125,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42e01f", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        108,
-		},
-		{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032", RTCPFeedback: videoRTCPFeedback},
-			PayloadType:        123,
-		},
-	} {
-		if err := me.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
+	for _, cc := range c.Media.codecs() {
+		codec, kind, err := cc.parameters()
+		if err != nil {
+			return nil, err
+		}
+		if err = me.RegisterCodec(codec, kind); err != nil {
 			return nil, err
 		}
+		if c.EnableRED && strings.EqualFold(codec.MimeType, mimeTypeOpus) {
+			if err = me.RegisterCodec(webrtc.RTPCodecParameters{
+				RTPCodecCapability: redCodecCapability(codec.PayloadType),
+				PayloadType:        redPayloadType,
+			}, kind); err != nil {
+				return nil, err
+			}
+		}
+		if c.EnableRTX && kind == webrtc.RTPCodecTypeVideo && cc.RTXPayloadType != 0 {
+			if err = me.RegisterCodec(rtxCodecParameters(codec.PayloadType, webrtc.PayloadType(cc.RTXPayloadType)), kind); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	for _, extension := range []string{
-		sdp.SDESMidURI,
-		sdp.SDESRTPStreamIDURI,
-		sdp.TransportCCURI,
-		frameMarking,
-	} {
+	videoExtensions, audioExtensions := c.Media.VideoExtensions, c.Media.AudioExtensions
+	if len(videoExtensions) == 0 {
+		videoExtensions = defaultVideoExtensions
+	}
+	if len(audioExtensions) == 0 {
+		audioExtensions = defaultAudioExtensions
+	}
+	for _, extension := range videoExtensions {
 		if err := me.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: extension}, webrtc.RTPCodecTypeVideo); err != nil {
 			return nil, err
 		}
 	}
-	for _, extension := range []string{
-		sdp.SDESMidURI,
-		sdp.SDESRTPStreamIDURI,
-		sdp.AudioLevelURI,
-	} {
+	for _, extension := range audioExtensions {
 		if err := me.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: extension}, webrtc.RTPCodecTypeAudio); err != nil {
 			return nil, err
 		}
@@ -91,6 +198,27 @@ func getPublisherMediaEngine() (*webrtc.MediaEngine, error) {
 	return me, nil
 }
 
+func opusCodecCapability(fmtp string) webrtc.RTPCodecCapability {
+	if fmtp == "" {
+		fmtp = "minptime=10;useinbandfec=1"
+	}
+	return webrtc.RTPCodecCapability{MimeType: mimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: fmtp}
+}
+
+// redCodecCapability returns the RFC 2198 capability for opus redundancy, the format
+// parameters list the payload type of the primary and redundant encodings.
+func redCodecCapability(opusPT webrtc.PayloadType) webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: mimeTypeRED, ClockRate: 48000, Channels: 2, SDPFmtpLine: fmt.Sprintf("%d/%d", opusPT, opusPT)}
+}
+
+// rtxCodecParameters returns the RFC 4588 codec retransmitting the given payload type
+func rtxCodecParameters(apt, pt webrtc.PayloadType) webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeRTX, ClockRate: 90000, SDPFmtpLine: fmt.Sprintf("apt=%d", apt)},
+		PayloadType:        pt,
+	}
+}
+
 func getSubscriberMediaEngine() (*webrtc.MediaEngine, error) {
 	me := &webrtc.MediaEngine{}
 	return me, nil
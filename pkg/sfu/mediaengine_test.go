@@ -0,0 +1,103 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaConfig_restrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MediaConfig
+		mimes  []string
+		want   []string
+	}{
+		{
+			name:  "Must restrict built in codecs",
+			mimes: []string{"video/H264", "audio/opus"},
+			want:  []string{mimeTypeOpus, mimeTypeH264, mimeTypeH264, mimeTypeH264, mimeTypeH264, mimeTypeH264},
+		},
+		{
+			name: "Must restrict configured codecs",
+			config: MediaConfig{Codecs: []CodecConfig{
+				{Mime: mimeTypeOpus, ClockRate: 48000, PayloadType: 111},
+				{Mime: mimeTypeVP8, ClockRate: 90000, PayloadType: 96},
+			}},
+			mimes: []string{mimeTypeVP8},
+			want:  []string{mimeTypeVP8},
+		},
+		{
+			name:  "Must allow no codecs",
+			mimes: []string{"video/av1"},
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, codec := range tt.config.restrict(tt.mimes).codecs() {
+				got = append(got, codec.Mime)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMediaConfig_rtxCodec(t *testing.T) {
+	config := MediaConfig{Codecs: []CodecConfig{
+		{Mime: mimeTypeH264, ClockRate: 90000, PayloadType: 110, RTXPayloadType: 111},
+		{Mime: mimeTypeVP8, ClockRate: 90000, PayloadType: 96},
+	}}
+
+	rtx, ok := config.rtxCodec(110)
+	assert.True(t, ok)
+	assert.Equal(t, webrtc.PayloadType(111), rtx.PayloadType)
+	assert.Equal(t, "apt=110", rtx.SDPFmtpLine)
+
+	_, ok = config.rtxCodec(96)
+	assert.False(t, ok)
+
+	rtx, ok = MediaConfig{}.rtxCodec(96)
+	assert.True(t, ok)
+	assert.Equal(t, webrtc.PayloadType(97), rtx.PayloadType)
+}
+
+func TestCodecConfig_parameters(t *testing.T) {
+	codec, kind, err := CodecConfig{
+		Mime:         mimeTypeVP8,
+		ClockRate:    90000,
+		PayloadType:  96,
+		RTCPFeedback: []string{"nack", "nack pli"},
+	}.parameters()
+	assert.NoError(t, err)
+	assert.Equal(t, webrtc.RTPCodecTypeVideo, kind)
+	assert.Equal(t, []webrtc.RTCPFeedback{{Type: "nack"}, {Type: "nack", Parameter: "pli"}}, codec.RTCPFeedback)
+
+	_, _, err = CodecConfig{Mime: "vp8"}.parameters()
+	assert.Error(t, err)
+
+	_, err = getPublisherMediaEngine(RouterConfig{EnableRED: true, EnableRTX: true})
+	assert.NoError(t, err)
+}
+
+func TestDownTrack_bindRTX(t *testing.T) {
+	rtx := func(pt webrtc.PayloadType, apt string) webrtc.RTPCodecParameters {
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeRTX, ClockRate: 90000, SDPFmtpLine: "apt=" + apt},
+			PayloadType:        pt,
+		}
+	}
+	codec := webrtc.RTPCodecParameters{PayloadType: 10}
+
+	d := &DownTrack{rtxSSRC: 1}
+	d.bindRTX(codec, []webrtc.RTPCodecParameters{rtx(101, "100"), rtx(11, "10")})
+	assert.Equal(t, uint8(11), d.rtxPayloadType)
+	assert.Equal(t, uint32(1), d.rtxSSRC)
+
+	d = &DownTrack{rtxSSRC: 1}
+	d.bindRTX(codec, []webrtc.RTPCodecParameters{rtx(101, "100")})
+	assert.Zero(t, d.rtxSSRC)
+}
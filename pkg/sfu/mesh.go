@@ -0,0 +1,219 @@
+package sfu
+
+import (
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+)
+
+// defaultMeshRefresh is the interval in seconds the sessions are synced with their nodes
+const defaultMeshRefresh = 10
+
+// MeshConfig relays the publishers of the sessions to the other nodes of a mesh, each
+// node subscribing its peers to the relayed tracks.
+type MeshConfig struct {
+	// Nodes the publishers are relayed to, reached with the relay signal of the SFU
+	Nodes []string `mapstructure:"nodes"`
+	// Sessions relayed to the nodes, all the sessions when empty
+	Sessions []string `mapstructure:"sessions"`
+	// Self is the address of this node, skipped in the lists of nodes
+	Self string `mapstructure:"self"`
+	// RedisPrefix of the registry keys listing the nodes of the sessions, the key of a
+	// session is the prefix followed by its id. Used instead of Nodes when set.
+	RedisPrefix string `mapstructure:"redisprefix"`
+	// Refresh is the interval in seconds the sessions are synced with their nodes, 10
+	// when zero
+	Refresh int `mapstructure:"refresh"`
+}
+
+// MeshNodesFunc returns the nodes the publishers of a session are relayed to
+type MeshNodesFunc func(sid string) ([]string, error)
+
+// meshSink syncs the relays of the sessions when their peers join or leave
+type meshSink struct {
+	sfu *SFU
+}
+
+// Send implements EventSink
+func (m *meshSink) Send(e Event) error {
+	switch e.Type {
+	case EventPeerJoined, EventPeerLeft:
+		go m.sfu.syncMesh(e.SessionID)
+	}
+	return nil
+}
+
+// Close implements EventSink
+func (m *meshSink) Close() error {
+	return nil
+}
+
+// SetMeshNodes sets the source of the nodes of the sessions, e.g. a registry, used
+// instead of the nodes of the mesh config.
+func (s *SFU) SetMeshNodes(f MeshNodesFunc) {
+	s.Lock()
+	defer s.Unlock()
+	s.meshNodes = f
+}
+
+// meshTargets returns the nodes the publishers of the session are relayed to
+func (s *SFU) meshTargets(sid string) []string {
+	s.RLock()
+	c := s.config.Mesh
+	nodesFn := s.meshNodes
+	s.RUnlock()
+
+	if len(c.Sessions) > 0 {
+		var meshed bool
+		for _, id := range c.Sessions {
+			if id == sid {
+				meshed = true
+				break
+			}
+		}
+		if !meshed {
+			return nil
+		}
+	}
+	nodes := c.Nodes
+	if nodesFn != nil {
+		var err error
+		if nodes, err = nodesFn(sid); err != nil {
+			Logger.Error(err, "Getting mesh nodes failed", "session_id", sid)
+			return nil
+		}
+	}
+
+	targets := make([]string, 0, len(nodes))
+	seen := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		if n == "" || n == c.Self || seen[n] {
+			continue
+		}
+		seen[n] = true
+		targets = append(targets, n)
+	}
+	return targets
+}
+
+// syncMesh relays the publishers of the session to its nodes
+func (s *SFU) syncMesh(sid string) {
+	sl, ok := s.getSession(sid).(*SessionLocal)
+	if !ok || sl == nil {
+		return
+	}
+	s.RLock()
+	relaySignal := s.relaySignal
+	s.RUnlock()
+	if relaySignal == nil {
+		Logger.V(1).Info("No relay signal, mesh disabled", "session_id", sid)
+		return
+	}
+	sl.syncMesh(s.meshTargets(sid), relaySignal)
+}
+
+// meshLoop syncs the sessions with their nodes until the SFU is drained
+func (s *SFU) meshLoop(refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, session := range s.GetSessions() {
+				s.syncMesh(session.ID())
+			}
+		case <-s.drained:
+			return
+		}
+	}
+}
+
+// syncMesh relays the publishers of the session to the nodes they aren't relayed to
+// yet, closes their relays to the nodes removed from the mesh and forgets the relays of
+// the publishers that left, their publisher closed them. The tracks of the relay peers
+// and of the publishers joined with NoRelay, e.g. pulled from another node, aren't
+// relayed so the nodes don't loop.
+func (s *SessionLocal) syncMesh(nodes []string, relaySignal RelaySignalFunc) {
+	s.meshMu.Lock()
+	defer s.meshMu.Unlock()
+	if s.closed.get() {
+		return
+	}
+
+	publishers := make(map[string]*Publisher)
+	for _, p := range s.Peers() {
+		if pub := p.Publisher(); pub != nil && !pub.noRelay {
+			publishers[p.ID()] = pub
+		}
+	}
+	meshed := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		meshed[node] = true
+	}
+	removed := make(map[*relay.Peer]*Publisher)
+	s.mu.Lock()
+	for pid, relays := range s.meshRelays {
+		pub, ok := publishers[pid]
+		if !ok {
+			delete(s.meshRelays, pid)
+			continue
+		}
+		for node, rp := range relays {
+			if !meshed[node] {
+				removed[rp] = pub
+				delete(relays, node)
+			}
+		}
+	}
+	s.mu.Unlock()
+	for rp, pub := range removed {
+		Logger.V(0).Info("Closing relay to removed mesh node", "session_id", s.id, "peer_id", pub.id)
+		if err := pub.closeRelay(rp); err != nil {
+			Logger.Error(err, "Closing relay to removed mesh node failed", "session_id", s.id, "peer_id", pub.id)
+		}
+	}
+
+	for pid, pub := range publishers {
+		for _, node := range nodes {
+			if s.meshRelayed(pid, node) {
+				continue
+			}
+			pid, node := pid, node
+			rp, err := pub.Relay(func(meta relay.PeerMeta, signal []byte) ([]byte, error) {
+				return relaySignal(node, meta, signal)
+			}, RelayWithSenderReports())
+			if err != nil {
+				Logger.Error(err, "Relaying publisher to mesh node failed", "session_id", s.id, "peer_id", pid, "node", node)
+				continue
+			}
+			Logger.V(0).Info("Relaying publisher to mesh node", "session_id", s.id, "peer_id", pid, "node", node)
+
+			s.mu.Lock()
+			if s.meshRelays == nil {
+				s.meshRelays = make(map[string]map[string]*relay.Peer)
+			}
+			if s.meshRelays[pid] == nil {
+				s.meshRelays[pid] = make(map[string]*relay.Peer)
+			}
+			s.meshRelays[pid][node] = rp
+			s.mu.Unlock()
+
+			// Relay again on the next sync when the link to the node is lost
+			rp.OnClose(func() {
+				s.mu.Lock()
+				if s.meshRelays[pid][node] == rp {
+					delete(s.meshRelays[pid], node)
+				}
+				s.mu.Unlock()
+			})
+		}
+	}
+}
+
+// meshRelayed returns true if the publisher is relayed to the node by the mesh
+func (s *SessionLocal) meshRelayed(pid, node string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.meshRelays[pid][node]
+	return ok
+}
@@ -0,0 +1,171 @@
+package sfu
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSFU_meshTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		mesh  MeshConfig
+		nodes MeshNodesFunc
+		sid   string
+		want  []string
+	}{
+		{
+			name: "Must relay to the nodes of the config",
+			mesh: MeshConfig{Nodes: []string{"a", "b"}},
+			sid:  "session",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "Must skip this node and the duplicates",
+			mesh: MeshConfig{Nodes: []string{"a", "self", "b", "a", ""}, Self: "self"},
+			sid:  "session",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "Must only relay the meshed sessions",
+			mesh: MeshConfig{Nodes: []string{"a"}, Sessions: []string{"other"}},
+			sid:  "session",
+		},
+		{
+			name: "Must relay to the nodes of the registry",
+			mesh: MeshConfig{Nodes: []string{"a"}, Self: "self"},
+			nodes: func(sid string) ([]string, error) {
+				return []string{"self", sid}, nil
+			},
+			sid:  "session",
+			want: []string{"session"},
+		},
+		{
+			name: "Must not relay when the registry fails",
+			mesh: MeshConfig{Nodes: []string{"a"}},
+			nodes: func(sid string) ([]string, error) {
+				return nil, errors.New("registry unavailable")
+			},
+			sid: "session",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SFU{config: Config{Mesh: tt.mesh}, meshNodes: tt.nodes}
+			assert.ElementsMatch(t, tt.want, s.meshTargets(tt.sid))
+		})
+	}
+}
+
+// testMesh relays to the SFUs of its nodes and counts the relays signaled to each node
+type testMesh struct {
+	sync.Mutex
+	nodes   map[string]*SFU
+	signals map[string]int
+}
+
+func newTestMesh(nodes ...string) *testMesh {
+	m := &testMesh{nodes: make(map[string]*SFU), signals: make(map[string]int)}
+	for _, node := range nodes {
+		m.nodes[node] = NewSFU(newSessionTestConfig())
+	}
+	return m
+}
+
+func (m *testMesh) relaySignal(node string, meta relay.PeerMeta, signal []byte) ([]byte, error) {
+	m.Lock()
+	m.signals[node]++
+	m.Unlock()
+	return m.nodes[node].AddRelayPeer(meta, signal)
+}
+
+func (m *testMesh) signaled(node string) int {
+	m.Lock()
+	defer m.Unlock()
+	return m.signals[node]
+}
+
+func (m *testMesh) close() {
+	for _, s := range m.nodes {
+		for _, session := range s.GetSessions() {
+			session.(*SessionLocal).Close()
+		}
+	}
+}
+
+// meshRelay returns the relay of the publisher to the node, nil if not relayed
+func meshRelay(s *SessionLocal, pid, node string) *relay.Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.meshRelays[pid][node]
+}
+
+func TestSessionLocal_syncMesh(t *testing.T) {
+	mesh := newTestMesh("a", "b")
+	defer mesh.close()
+	s := NewSFU(newSessionTestConfig())
+	p, _, _, stop := joinPublisher(t, s, "session")
+	defer stop()
+	defer p.Close()
+	session := p.Session().(*SessionLocal)
+	defer session.Close()
+	relayPeers := func() int {
+		p.Publisher().mu.RLock()
+		defer p.Publisher().mu.RUnlock()
+		return len(p.Publisher().relayPeers)
+	}
+
+	// Must relay the publisher once to each node
+	session.syncMesh([]string{"a", "b"}, mesh.relaySignal)
+	session.syncMesh([]string{"a", "b"}, mesh.relaySignal)
+	assert.Equal(t, 1, mesh.signaled("a"))
+	assert.Equal(t, 1, mesh.signaled("b"))
+	assert.Eventually(t, func() bool { return relayPeers() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// Must not relay the relay peers of the nodes back
+	target := mesh.nodes["a"].getSession("session").(*SessionLocal)
+	target.syncMesh([]string{"b"}, mesh.relaySignal)
+	assert.Equal(t, 1, mesh.signaled("b"))
+
+	// Must close the relay to a node removed from the mesh
+	session.syncMesh([]string{"a"}, mesh.relaySignal)
+	assert.Nil(t, meshRelay(session, p.ID(), "b"))
+	assert.Equal(t, 1, relayPeers())
+	assert.Equal(t, 1, mesh.signaled("b"))
+
+	// Must relay again once the relay to a node is closed
+	rp := meshRelay(session, p.ID(), "a")
+	if assert.NotNil(t, rp) {
+		assert.NoError(t, rp.Close())
+	}
+	assert.Nil(t, meshRelay(session, p.ID(), "a"))
+	session.syncMesh([]string{"a"}, mesh.relaySignal)
+	assert.Equal(t, 2, mesh.signaled("a"))
+	assert.NotNil(t, meshRelay(session, p.ID(), "a"))
+
+	// Must forget the relays of a publisher which left, a subscriber keeps the session
+	session.AddPeer(&PeerLocal{id: "subscriber"})
+	session.RemovePeer(p)
+	session.syncMesh([]string{"a"}, mesh.relaySignal)
+	assert.Equal(t, 2, mesh.signaled("a"))
+	session.mu.RLock()
+	assert.Empty(t, session.meshRelays)
+	session.mu.RUnlock()
+}
+
+func TestSessionLocal_syncMesh_noRelay(t *testing.T) {
+	mesh := newTestMesh("a")
+	defer mesh.close()
+	s := NewSFU(newSessionTestConfig())
+	p, _, _, stop := joinPublisher(t, s, "session", JoinConfig{NoRelay: true})
+	defer stop()
+	defer p.Close()
+
+	p.Session().(*SessionLocal).syncMesh([]string{"a"}, mesh.relaySignal)
+	assert.Zero(t, mesh.signaled("a"))
+}
@@ -0,0 +1,199 @@
+package sfu
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+)
+
+const (
+	// MigrateMethod is the API datachannel message asking the peers to join their
+	// session on another node
+	MigrateMethod = "migrate"
+
+	// migrationTimeout is the max time the source node forwards a migrated session
+	migrationTimeout = time.Minute
+)
+
+var (
+	// ErrMigrationInProgress is returned when migrating a session already migrating
+	ErrMigrationInProgress = errors.New("session migration in progress")
+	// ErrNotMigrating is returned when confirming the migration of a session not migrating
+	ErrNotMigrating = errors.New("session is not migrating")
+	// ErrNoRelaySignal is returned when migrating a session without relay signal
+	ErrNoRelaySignal = errors.New("no relay signal to reach the target node")
+	// ErrUnauthorizedNode is returned when a node calls another without the node secret
+	ErrUnauthorizedNode = errors.New("node is not authorized")
+)
+
+// RelaySignalFunc sends the relay signal of a peer to the target node and returns the
+// answer of the target, the target answers it with SFU.AddRelayPeer.
+type RelaySignalFunc func(target string, meta relay.PeerMeta, signal []byte) ([]byte, error)
+
+// Migration is the params of the migrate message, the peers should join the session on
+// the target node then confirm it to the source node.
+type Migration struct {
+	SessionID string `json:"sid"`
+	Target    string `json:"target"`
+}
+
+type migration struct {
+	target  string
+	pending map[string]struct{}
+	timer   *time.Timer
+}
+
+// SetRelaySignal sets the function used to reach the target nodes of the migrations
+func (s *SFU) SetRelaySignal(f RelaySignalFunc) {
+	s.Lock()
+	defer s.Unlock()
+	s.relaySignal = f
+}
+
+// NodeSecret returns the node secret of the config, sent by the relay signals
+func (s *SFU) NodeSecret() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.config.SFU.NodeSecret
+}
+
+// AuthorizeNode returns true if the secret is the node secret of the config, no node is
+// authorized when it is empty.
+func (s *SFU) AuthorizeNode(secret string) bool {
+	s.RLock()
+	want := s.config.SFU.NodeSecret
+	s.RUnlock()
+	return want != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(want)) == 1
+}
+
+// AddRelayPeer answers the relay signal of a peer of another node, e.g. a publisher of
+// a session migrating to this node. The relayed tracks are published in the session.
+func (s *SFU) AddRelayPeer(meta relay.PeerMeta, signal []byte) ([]byte, error) {
+	if s.Draining() {
+		return nil, ErrDraining
+	}
+	session, _ := s.GetSession(meta.SessionID)
+	return session.AddRelayPeer(meta.PeerID, signal)
+}
+
+// Migrate moves a live session to the target node. The tracks of the publishers are
+// relayed to the target, then the peers are asked to join the session on the target.
+// The node keeps forwarding the session until each peer confirms with Migrated or
+// leaves, up to one minute, then closes the remaining peers and the relays.
+func (s *SFU) Migrate(sid, target string) error {
+	s.RLock()
+	relaySignal := s.relaySignal
+	s.RUnlock()
+	if relaySignal == nil {
+		return ErrNoRelaySignal
+	}
+	sl, ok := s.getSession(sid).(*SessionLocal)
+	if !ok || sl == nil {
+		return ErrSessionNotFound
+	}
+	return sl.migrate(target, func(meta relay.PeerMeta, signal []byte) ([]byte, error) {
+		return relaySignal(target, meta, signal)
+	})
+}
+
+// Migrated confirms that a peer joined its session on the target node of the migration
+func (s *SFU) Migrated(sid, uid string) error {
+	sl, ok := s.getSession(sid).(*SessionLocal)
+	if !ok || sl == nil {
+		return ErrSessionNotFound
+	}
+	return sl.migrated(uid)
+}
+
+// migrate relays the publishers of the session with signalFn and notifies the peers
+func (s *SessionLocal) migrate(target string, signalFn func(meta relay.PeerMeta, signal []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	if s.migration != nil {
+		s.mu.Unlock()
+		return ErrMigrationInProgress
+	}
+	m := &migration{target: target}
+	s.migration = m
+	s.mu.Unlock()
+
+	var relays []*relay.Peer
+	for _, p := range s.Peers() {
+		// The publishers relayed by the mesh already reach the target
+		if p.Publisher() == nil || s.meshRelayed(p.ID(), target) {
+			continue
+		}
+		rp, err := p.Publisher().Relay(signalFn, RelayWithSenderReports())
+		if err != nil {
+			for _, r := range relays {
+				if cerr := r.Close(); cerr != nil {
+					Logger.Error(cerr, "Closing migration relay")
+				}
+			}
+			s.mu.Lock()
+			s.migration = nil
+			s.mu.Unlock()
+			return fmt.Errorf("migrating peer %s: %w", p.ID(), err)
+		}
+		relays = append(relays, rp)
+	}
+
+	s.mu.Lock()
+	m.pending = make(map[string]struct{}, len(s.peers))
+	for id := range s.peers {
+		m.pending[id] = struct{}{}
+	}
+	m.timer = time.AfterFunc(migrationTimeout, func() {
+		s.endMigration(m)
+	})
+	s.mu.Unlock()
+
+	Logger.Info("Migrating session", "session_id", s.id, "target", target, "relays", len(relays))
+	s.config.Events.Emit(Event{Type: EventSessionMigrating, SessionID: s.id, Attrs: map[string]string{"target": target}})
+	s.sendAPIMessage(MigrateMethod, Migration{SessionID: s.id, Target: target})
+	for _, p := range s.Peers() {
+		if peer, ok := p.(*PeerLocal); ok && peer.OnMigrate != nil {
+			peer.OnMigrate(target)
+		}
+	}
+	return nil
+}
+
+// migrated records that a peer joined the target node, the migration ends once all the
+// peers did.
+func (s *SessionLocal) migrated(uid string) error {
+	s.mu.Lock()
+	m := s.migration
+	if m == nil || m.pending == nil {
+		s.mu.Unlock()
+		return ErrNotMigrating
+	}
+	delete(m.pending, uid)
+	done := len(m.pending) == 0
+	s.mu.Unlock()
+
+	if done {
+		s.endMigration(m)
+	}
+	return nil
+}
+
+// endMigration closes the peers of the migrated session, their publishers close the
+// relays to the target node.
+func (s *SessionLocal) endMigration(m *migration) {
+	s.mu.Lock()
+	if s.migration != m {
+		s.mu.Unlock()
+		return
+	}
+	s.migration = nil
+	pending := len(m.pending)
+	s.mu.Unlock()
+
+	m.timer.Stop()
+	Logger.Info("Session migrated", "session_id", s.id, "target", m.target, "pending", pending)
+	s.config.Events.Emit(Event{Type: EventSessionMigrated, SessionID: s.id, Attrs: map[string]string{"target": m.target}})
+	s.RemoveAllPeer()
+}
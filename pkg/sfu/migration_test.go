@@ -0,0 +1,68 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSFU_Migrate(t *testing.T) {
+	s := NewSFU(newSessionTestConfig())
+	assert.Equal(t, ErrNoRelaySignal, s.Migrate("session", "node"))
+
+	var signals int
+	s.SetRelaySignal(func(target string, meta relay.PeerMeta, signal []byte) ([]byte, error) {
+		signals++
+		return nil, nil
+	})
+	assert.Equal(t, ErrSessionNotFound, s.Migrate("session", "node"))
+	assert.Equal(t, ErrSessionNotFound, s.Migrated("session", "a"))
+
+	session, _ := s.GetSession("session")
+	targets := make(map[string]string)
+	for _, id := range []string{"a", "b"} {
+		id := id
+		p := NewPeer(s)
+		p.id = id
+		p.session = session
+		p.OnMigrate = func(target string) { targets[id] = target }
+		session.AddPeer(p)
+	}
+	assert.Equal(t, ErrNotMigrating, s.Migrated("session", "a"))
+
+	assert.NoError(t, s.Migrate("session", "node"))
+	assert.Equal(t, map[string]string{"a": "node", "b": "node"}, targets)
+	// The peers don't publish, nothing is relayed
+	assert.Zero(t, signals)
+	assert.Equal(t, ErrMigrationInProgress, s.Migrate("session", "node"))
+
+	// The source forwards the session until each peer confirmed
+	assert.NoError(t, s.Migrated("session", "a"))
+	assert.Len(t, session.Peers(), 2)
+	assert.NoError(t, s.Migrated("session", "b"))
+	assert.Empty(t, session.Peers())
+	assert.Empty(t, s.GetSessions())
+}
+
+func TestSFU_AuthorizeNode(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		caller string
+		want   bool
+	}{
+		{name: "Must refuse all nodes without secret", caller: "", want: false},
+		{name: "Must refuse a wrong secret", secret: "secret", caller: "other", want: false},
+		{name: "Must refuse a missing secret", secret: "secret", caller: "", want: false},
+		{name: "Must authorize the secret", secret: "secret", caller: "secret", want: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSessionTestConfig()
+			c.SFU.NodeSecret = tt.secret
+			assert.Equal(t, tt.want, NewSFU(c).AuthorizeNode(tt.caller))
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package sfu
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/lucsky/cuid"
 
+	"github.com/pion/ion-sfu/pkg/tracing"
 	"github.com/pion/webrtc/v3"
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -45,6 +47,17 @@ type JoinConfig struct {
 	// to customize the subscrbe stream combination as needed.
 	// this parameter depends on NoSubscribe=false.
 	NoAutoSubscribe bool
+	// If true the session is switched to end to end encryption mode, the SFU relies on the
+	// frame marking or dependency descriptor extensions instead of parsing the payloads.
+	// Peers must join the session with it before any track is published.
+	E2EE bool
+	// Policy filters the tracks the peer is automatically subscribed to.
+	Policy *SubscriptionPolicy
+	// Labels describe the peer to the subscription policies of the other peers.
+	Labels map[string]string
+	// If true the tracks of the peer aren't relayed to the mesh nodes, e.g. the tracks
+	// pulled from another node.
+	NoRelay bool
 }
 
 // SessionProvider provides the SessionLocal to the sfu.Peer
@@ -73,9 +86,17 @@ type PeerLocal struct {
 	OnOffer                    func(*webrtc.SessionDescription)
 	OnIceCandidate             func(*webrtc.ICECandidateInit, int)
 	OnICEConnectionStateChange func(webrtc.ICEConnectionState)
+	OnAudioLevels              func([]AudioLevel)
+	OnDominantSpeaker          func(DominantSpeaker)
+	// OnDrain is called when the SFU drains, the peer should migrate to another node
+	OnDrain func()
+	// OnMigrate is called when the session migrates, the peer should join it on the
+	// target node then confirm it with SFU.Migrated
+	OnMigrate func(target string)
 
 	remoteAnswerPending bool
 	negotiationPending  bool
+	audioEvents         audioNotifier
 
 	Conn *jsonrpc2.Conn
 }
@@ -89,6 +110,22 @@ func NewPeer(provider SessionProvider) *PeerLocal {
 
 // Join initializes this peer for a given sessionID
 func (p *PeerLocal) Join(sid, uid string, config ...JoinConfig) error {
+	return p.JoinContext(context.Background(), sid, uid, config...)
+}
+
+// JoinContext is Join traced as a child of the span of ctx
+func (p *PeerLocal) JoinContext(ctx context.Context, sid, uid string, config ...JoinConfig) (err error) {
+	_, span := tracing.Start(ctx, "PeerLocal.Join")
+	span.SetAttribute("session_id", sid)
+	defer func() {
+		span.SetAttribute("peer_id", p.id)
+		span.RecordError(err)
+		span.End()
+	}()
+	return p.join(sid, uid, config...)
+}
+
+func (p *PeerLocal) join(sid, uid string, config ...JoinConfig) error {
 	var conf JoinConfig
 	if len(config) > 0 {
 		conf = config[0]
@@ -99,6 +136,15 @@ func (p *PeerLocal) Join(sid, uid string, config ...JoinConfig) error {
 		return ErrTransportExists
 	}
 
+	if d, ok := p.provider.(interface{ Draining() bool }); ok && d.Draining() {
+		return ErrDraining
+	}
+	if a, ok := p.provider.(interface{ Admit(sid string) error }); ok {
+		if err := a.Admit(sid); err != nil {
+			return err
+		}
+	}
+
 	var err error
 
 	s, cfg := p.provider.GetSession(sid)
@@ -119,6 +165,9 @@ func (p *PeerLocal) Join(sid, uid string, config ...JoinConfig) error {
 	}
 	p.id = uid
 	p.session = s
+	if conf.E2EE {
+		s.EnableE2EE()
+	}
 
 	if !conf.NoSubscribe {
 		p.subscriber, err = NewSubscriber(uid, cfg)
@@ -127,6 +176,7 @@ func (p *PeerLocal) Join(sid, uid string, config ...JoinConfig) error {
 		}
 
 		p.subscriber.noAutoSubscribe = conf.NoAutoSubscribe
+		p.subscriber.policy = conf.Policy
 
 		p.subscriber.OnNegotiationNeeded(func() {
 			p.Lock()
@@ -170,6 +220,8 @@ func (p *PeerLocal) Join(sid, uid string, config ...JoinConfig) error {
 		if err != nil {
 			return fmt.Errorf("error creating transport: %v", err)
 		}
+		p.publisher.labels = conf.Labels
+		p.publisher.noRelay = conf.NoRelay
 		if !conf.NoSubscribe {
 			for _, dc := range p.session.GetDCMiddlewares() {
 				if err := p.subscriber.AddDatachannel(p, dc); err != nil {
@@ -209,6 +261,21 @@ func (p *PeerLocal) Join(sid, uid string, config ...JoinConfig) error {
 
 // Answer an offer from remote
 func (p *PeerLocal) Answer(sdp webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	return p.AnswerContext(context.Background(), sdp)
+}
+
+// AnswerContext is Answer traced as a child of the span of ctx
+func (p *PeerLocal) AnswerContext(ctx context.Context, sdp webrtc.SessionDescription) (answer *webrtc.SessionDescription, err error) {
+	_, span := tracing.Start(ctx, "PeerLocal.Answer")
+	span.SetAttribute("peer_id", p.id)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	return p.answer(sdp)
+}
+
+func (p *PeerLocal) answer(sdp webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
 	if p.publisher == nil {
 		return nil, ErrNoTransportEstablished
 	}
@@ -315,6 +382,57 @@ func (p *PeerLocal) Close() error {
 	return nil
 }
 
+// audioNotifier calls the audio callbacks of a peer from its own goroutine, the observer
+// of the session never waits for the signaling of a peer. A peer which can't keep up
+// only gets the latest levels and dominant speaker.
+type audioNotifier struct {
+	sync.Mutex
+	levels   []AudioLevel
+	dominant *DominantSpeaker
+	running  bool
+}
+
+// notify queues the levels and the dominant speaker, if not nil, replacing the ones
+// not sent yet.
+func (n *audioNotifier) notify(p *PeerLocal, levels []AudioLevel, dominant *DominantSpeaker) {
+	n.Lock()
+	defer n.Unlock()
+	if levels != nil {
+		n.levels = levels
+	}
+	if dominant != nil {
+		n.dominant = dominant
+	}
+	if !n.running {
+		n.running = true
+		go n.run(p)
+	}
+}
+
+func (n *audioNotifier) run(p *PeerLocal) {
+	for {
+		n.Lock()
+		levels, dominant := n.levels, n.dominant
+		n.levels, n.dominant = nil, nil
+		if levels == nil && dominant == nil {
+			n.running = false
+			n.Unlock()
+			return
+		}
+		n.Unlock()
+
+		if p.closed.get() {
+			continue
+		}
+		if levels != nil && p.OnAudioLevels != nil {
+			p.OnAudioLevels(levels)
+		}
+		if dominant != nil && p.OnDominantSpeaker != nil {
+			p.OnDominantSpeaker(*dominant)
+		}
+	}
+}
+
 func (p *PeerLocal) Subscriber() *Subscriber {
 	return p.subscriber
 }
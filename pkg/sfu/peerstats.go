@@ -0,0 +1,178 @@
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// ErrSessionNotFound is returned when getting the stats of a peer of an unknown session
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrPeerNotFound is returned when getting the stats of an unknown peer
+	ErrPeerNotFound = errors.New("peer not found")
+)
+
+// PeerStats is a snapshot of the media statistics of a peer, as seen by the SFU
+type PeerStats struct {
+	PeerID     string          `json:"peerId"`
+	SessionID  string          `json:"sessionId"`
+	Publisher  *TransportStats `json:"publisher,omitempty"`
+	Subscriber *TransportStats `json:"subscriber,omitempty"`
+}
+
+// TransportStats are the statistics of the publisher or the subscriber transport of a peer
+type TransportStats struct {
+	CandidatePair *CandidatePairStats   `json:"candidatePair,omitempty"`
+	Published     []PublishedTrackStats `json:"published,omitempty"`
+	Subscribed    []DownTrackStats      `json:"subscribed,omitempty"`
+}
+
+// CandidatePairStats describes the ICE candidate pair selected by a transport
+type CandidatePairStats struct {
+	Local                string  `json:"local"`
+	Remote               string  `json:"remote"`
+	State                string  `json:"state"`
+	Nominated            bool    `json:"nominated"`
+	BytesSent            uint64  `json:"bytesSent"`
+	BytesReceived        uint64  `json:"bytesReceived"`
+	CurrentRoundTripTime float64 `json:"currentRoundTripTime"`
+}
+
+// PublishedTrackStats are the statistics of a track published by the peer
+type PublishedTrackStats struct {
+	TrackID  string       `json:"trackId"`
+	StreamID string       `json:"streamId"`
+	Kind     string       `json:"kind"`
+	MimeType string       `json:"mimeType"`
+	Layers   []LayerStats `json:"layers"`
+}
+
+// LayerStats are the statistics of a received layer of a published track
+type LayerStats struct {
+	Layer       int     `json:"layer"`
+	SSRC        uint32  `json:"ssrc"`
+	Bitrate     uint64  `json:"bitrate"`
+	PacketCount uint32  `json:"packetCount"`
+	LostRate    float32 `json:"lostRate"`
+	Jitter      float64 `json:"jitter"`
+}
+
+// DownTrackStats are the statistics of a track forwarded to the peer, the loss, jitter
+// and RTT are the ones of the last receiver report of the peer.
+type DownTrackStats struct {
+	TrackID             string `json:"trackId"`
+	StreamID            string `json:"streamId"`
+	Kind                string `json:"kind"`
+	MimeType            string `json:"mimeType"`
+	SSRC                uint32 `json:"ssrc"`
+	PacketCount         uint32 `json:"packetCount"`
+	OctetCount          uint32 `json:"octetCount"`
+	Muted               bool   `json:"muted"`
+	CurrentSpatialLayer int32  `json:"currentSpatialLayer"`
+	TargetSpatialLayer  int32  `json:"targetSpatialLayer"`
+	TemporalLayer       int32  `json:"temporalLayer"`
+	FractionLost        uint8  `json:"fractionLost"`
+	Jitter              uint32 `json:"jitter"`
+	RTT                 uint32 `json:"rtt"`
+}
+
+// Stats returns the stats of the down track
+func (d *DownTrack) Stats() DownTrackStats {
+	return DownTrackStats{
+		TrackID:             d.id,
+		StreamID:            d.streamID,
+		Kind:                d.Kind().String(),
+		MimeType:            d.codec.MimeType,
+		SSRC:                d.ssrc,
+		PacketCount:         atomic.LoadUint32(&d.packetCount),
+		OctetCount:          atomic.LoadUint32(&d.octetCount),
+		Muted:               !d.enabled.get(),
+		CurrentSpatialLayer: atomic.LoadInt32(&d.currentSpatialLayer),
+		TargetSpatialLayer:  atomic.LoadInt32(&d.targetSpatialLayer),
+		TemporalLayer:       atomic.LoadInt32(&d.temporalLayer) & 0x0f,
+		FractionLost:        uint8(atomic.LoadUint32(&d.fractionLost)),
+		Jitter:              atomic.LoadUint32(&d.jitter),
+		RTT:                 atomic.LoadUint32(&d.rtt),
+	}
+}
+
+// Stats returns a snapshot of the stats of the peer
+func (p *PeerLocal) Stats() PeerStats {
+	st := PeerStats{PeerID: p.ID()}
+	if s := p.Session(); s != nil {
+		st.SessionID = s.ID()
+	}
+	if pub := p.Publisher(); pub != nil {
+		ts := &TransportStats{CandidatePair: candidatePairStats(pub.PeerConnection())}
+		for _, t := range pub.PublisherTracks() {
+			ts.Published = append(ts.Published, PublishedTrackStats{
+				TrackID:  t.Receiver.TrackID(),
+				StreamID: t.Receiver.StreamID(),
+				Kind:     t.Receiver.Kind().String(),
+				MimeType: t.Receiver.Codec().MimeType,
+				Layers:   t.Receiver.GetLayerStats(),
+			})
+		}
+		st.Publisher = ts
+	}
+	if sub := p.Subscriber(); sub != nil {
+		ts := &TransportStats{CandidatePair: candidatePairStats(sub.GetPeerConnection())}
+		for _, dt := range sub.DownTracks() {
+			ts.Subscribed = append(ts.Subscribed, dt.Stats())
+		}
+		st.Subscriber = ts
+	}
+	return st
+}
+
+// PeerStats returns a snapshot of the stats of a peer of a session
+func (s *SFU) PeerStats(sid, uid string) (PeerStats, error) {
+	session := s.getSession(sid)
+	if session == nil {
+		return PeerStats{}, ErrSessionNotFound
+	}
+	peer, ok := session.GetPeer(uid).(*PeerLocal)
+	if !ok || peer == nil {
+		return PeerStats{}, ErrPeerNotFound
+	}
+	return peer.Stats(), nil
+}
+
+// candidatePairStats returns the nominated candidate pair of the peer connection
+func candidatePairStats(pc *webrtc.PeerConnection) *CandidatePairStats {
+	if pc == nil {
+		return nil
+	}
+	report := pc.GetStats()
+	var pair *webrtc.ICECandidatePairStats
+	for _, s := range report {
+		if p, ok := s.(webrtc.ICECandidatePairStats); ok {
+			if pair == nil || (p.Nominated && !pair.Nominated) {
+				pair = &p
+			}
+		}
+	}
+	if pair == nil {
+		return nil
+	}
+	return &CandidatePairStats{
+		Local:                candidateAddress(report, pair.LocalCandidateID),
+		Remote:               candidateAddress(report, pair.RemoteCandidateID),
+		State:                string(pair.State),
+		Nominated:            pair.Nominated,
+		BytesSent:            pair.BytesSent,
+		BytesReceived:        pair.BytesReceived,
+		CurrentRoundTripTime: pair.CurrentRoundTripTime,
+	}
+}
+
+func candidateAddress(report webrtc.StatsReport, id string) string {
+	c, ok := report[id].(webrtc.ICECandidateStats)
+	if !ok {
+		return id
+	}
+	return fmt.Sprintf("%s:%d/%s %s", c.IP, c.Port, c.Protocol, c.CandidateType)
+}
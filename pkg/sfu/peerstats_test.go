@@ -0,0 +1,59 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownTrack_Stats(t *testing.T) {
+	d := &DownTrack{
+		id:       "track",
+		streamID: "stream",
+		codec:    webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8},
+		ssrc:     1234,
+	}
+	d.enabled.set(true)
+	d.UpdateStats(100)
+	d.UpdateStats(200)
+	d.SetInitialLayers(1, 2)
+	d.fractionLost = 25
+	d.rtt = 80
+
+	assert.Equal(t, DownTrackStats{
+		TrackID:             "track",
+		StreamID:            "stream",
+		Kind:                webrtc.RTPCodecTypeVideo.String(),
+		MimeType:            webrtc.MimeTypeVP8,
+		SSRC:                1234,
+		PacketCount:         2,
+		OctetCount:          300,
+		CurrentSpatialLayer: 1,
+		TargetSpatialLayer:  1,
+		TemporalLayer:       2,
+		FractionLost:        25,
+		RTT:                 80,
+	}, d.Stats())
+}
+
+func TestSFU_PeerStats(t *testing.T) {
+	s := NewSFU(newSessionTestConfig())
+
+	_, err := s.PeerStats("session", "peer")
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	session, _ := s.GetSession("session")
+	defer session.(*SessionLocal).Close()
+	peer := NewPeer(s)
+	peer.id = "peer"
+	peer.session = session
+	session.AddPeer(peer)
+
+	_, err = s.PeerStats("session", "other")
+	assert.Equal(t, ErrPeerNotFound, err)
+
+	st, err := s.PeerStats("session", "peer")
+	assert.NoError(t, err)
+	assert.Equal(t, PeerStats{PeerID: "peer", SessionID: "session"}, st)
+}
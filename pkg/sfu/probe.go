@@ -0,0 +1,131 @@
+package sfu
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// maxPaddingSize is the biggest padding a RTP packet can carry
+	maxPaddingSize = 255
+	// maxProbePacketsPerFrame limits the probe packets sent in a burst after a frame
+	maxProbePacketsPerFrame = 10
+)
+
+// ProbeConfig defines the bandwidth probing configuration of the DownTracks
+type ProbeConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Duration of each probe in ms
+	Duration int `mapstructure:"duration"`
+	// Interval is the min time between probes in ms
+	Interval int `mapstructure:"interval"`
+}
+
+// probeHelper sends padding only packets over the media to find out if the
+// subscriber has headroom for the next simulcast layer. Probes are started from
+// the RTCP handling and the packets are sent from the RTP write loop.
+type probeHelper struct {
+	config ProbeConfig
+	// until is the probe end time in unix nanoseconds
+	until int64
+	// bitrate is the extra bitrate in bps the probe sends over the media
+	bitrate uint64
+	// next is the earliest time in unix nanoseconds a new probe can start
+	next int64
+
+	lastSent int64
+	budget   int64
+	payload  []byte
+}
+
+func newProbeHelper(config ProbeConfig) *probeHelper {
+	payload := make([]byte, maxPaddingSize)
+	payload[maxPaddingSize-1] = maxPaddingSize
+	return &probeHelper{
+		config:  config,
+		payload: payload,
+	}
+}
+
+// start begins a probe sending the given extra bitrate, it's ignored if a probe was
+// sent recently.
+func (p *probeHelper) start(bitrate uint64) {
+	now := time.Now().UnixNano()
+	if now < atomic.LoadInt64(&p.next) {
+		return
+	}
+	atomic.StoreUint64(&p.bitrate, bitrate)
+	atomic.StoreInt64(&p.until, now+int64(p.config.Duration)*int64(time.Millisecond))
+	atomic.StoreInt64(&p.next, now+int64(p.config.Duration+p.config.Interval)*int64(time.Millisecond))
+}
+
+// stop ends the current probe
+func (p *probeHelper) stop() {
+	atomic.StoreInt64(&p.until, 0)
+}
+
+// packets returns the number of padding packets to be sent now to keep the probe bitrate
+func (p *probeHelper) packets(now int64) int {
+	if now > atomic.LoadInt64(&p.until) {
+		p.lastSent = 0
+		p.budget = 0
+		return 0
+	}
+	if p.lastSent == 0 {
+		p.lastSent = now
+		return 0
+	}
+	p.budget += int64(atomic.LoadUint64(&p.bitrate)) * (now - p.lastSent) / int64(time.Second) / 8
+	p.lastSent = now
+
+	n := int(p.budget / maxPaddingSize)
+	if n > maxProbePacketsPerFrame {
+		n = maxProbePacketsPerFrame
+		p.budget = 0
+	} else {
+		p.budget -= int64(n * maxPaddingSize)
+	}
+	return n
+}
+
+// writeProbe sends padding only packets after the last media packet, the sequence
+// number offset is updated so the media sequence numbers stay contiguous and the
+// padding sequence numbers are recorded so their NACKs are dropped.
+func (d *DownTrack) writeProbe(hdr *rtp.Header) {
+	n := d.probe.packets(time.Now().UnixNano())
+	if d.rtxPayloadType != 0 {
+		// Probe over the RTX stream, media sequence numbers are not affected
+		for i := 0; i < n; i++ {
+			if err := d.writeRTX(&rtp.Header{
+				Version:   2,
+				Padding:   true,
+				Timestamp: hdr.Timestamp,
+			}, d.probe.payload); err != nil {
+				Logger.V(1).Error(err, "Writing probe packet err", "peer_id", d.peerID)
+				return
+			}
+		}
+		return
+	}
+	for i := 0; i < n; i++ {
+		sn := d.lastSN + 1
+		if _, err := d.writeStream.WriteRTP(&rtp.Header{
+			Version:        2,
+			Padding:        true,
+			PayloadType:    d.payloadType,
+			SequenceNumber: sn,
+			Timestamp:      hdr.Timestamp,
+			SSRC:           d.ssrc,
+		}, d.probe.payload); err != nil {
+			Logger.V(1).Error(err, "Writing probe packet err", "peer_id", d.peerID)
+			return
+		}
+		if d.sequencer != nil {
+			d.sequencer.pushPadding(sn, hdr.Timestamp)
+		}
+		d.snOffset--
+		d.lastSN = sn
+	}
+}
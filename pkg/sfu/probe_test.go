@@ -0,0 +1,69 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_probeHelper_packets(t *testing.T) {
+	p := newProbeHelper(ProbeConfig{Enabled: true, Duration: 1000, Interval: 5000})
+	now := time.Now().UnixNano()
+	assert.Equal(t, 0, p.packets(now))
+
+	p.start(208000)
+	start := time.Now().UnixNano()
+	assert.Equal(t, 0, p.packets(start))
+	// 208kbps during 10ms are 260 bytes
+	assert.Equal(t, 1, p.packets(start+int64(10*time.Millisecond)))
+	assert.Equal(t, 0, p.packets(start+int64(15*time.Millisecond)))
+	assert.Equal(t, 1, p.packets(start+int64(20*time.Millisecond)))
+	// Bursts are bounded
+	assert.Equal(t, maxProbePacketsPerFrame, p.packets(start+int64(500*time.Millisecond)))
+
+	// Probes can't be restarted before the interval
+	p.stop()
+	assert.Equal(t, 0, p.packets(start+int64(600*time.Millisecond)))
+	p.start(208000)
+	assert.Equal(t, int64(0), p.until)
+}
+
+type bitrateReceiver struct {
+	Receiver
+	bitrates [3]uint64
+}
+
+func (r *bitrateReceiver) GetBitrate() [3]uint64 {
+	return r.bitrates
+}
+
+func (r *bitrateReceiver) GetMaxTemporalLayer() [3]int32 {
+	return [3]int32{}
+}
+
+func TestDownTrack_handleLayerChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		bitrates [3]uint64
+		estimate uint64
+		want     uint64
+	}{
+		{name: "Must probe for the next layer bitrate", bitrates: [3]uint64{300000, 1200000}, estimate: 400000, want: 800000},
+		{name: "Must not probe when the estimate covers the next layer", bitrates: [3]uint64{300000, 350000}, estimate: 400000},
+		{name: "Must not probe without the next layer", bitrates: [3]uint64{300000}, estimate: 400000},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DownTrack{
+				receiver:         &bitrateReceiver{bitrates: tt.bitrates},
+				maxSpatialLayer:  2,
+				maxTemporalLayer: 2,
+				probe:            newProbeHelper(ProbeConfig{Enabled: true, Duration: 1000, Interval: 5000}),
+			}
+			d.handleLayerChange(0, tt.estimate)
+			assert.Equal(t, tt.want, d.probe.bitrate)
+		})
+	}
+}
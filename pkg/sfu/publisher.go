@@ -3,6 +3,8 @@ package sfu
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/pion/ion-sfu/pkg/relay"
 	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -27,6 +30,8 @@ type Publisher struct {
 	relayed    atomicBool
 	relayPeers []*relayPeer
 	candidates []webrtc.ICECandidateInit
+	labels     map[string]string
+	noRelay    bool
 
 	onICEConnectionStateChangeHandler atomic.Value // func(webrtc.ICEConnectionState)
 	onPublisherTrack                  atomic.Value // func(PublisherTrack)
@@ -35,7 +40,10 @@ type Publisher struct {
 }
 
 type relayPeer struct {
-	peer                    *relay.Peer
+	peer *relay.Peer
+	// cfg is scoped to the relay transport, its buffers don't replace the ones of the
+	// publisher for the same SSRCs
+	cfg                     *WebRTCTransportConfig
 	dcs                     []*webrtc.DataChannel
 	withSRReports           bool
 	relayFanOutDataChannels bool
@@ -50,9 +58,16 @@ type PublisherTrack struct {
 	clientRelay bool
 }
 
+// Labels returns the labels the peer joined with
+func (p *Publisher) Labels() map[string]string {
+	return p.labels
+}
+
 // NewPublisher creates a new Publisher
 func NewPublisher(id string, session Session, cfg *WebRTCTransportConfig) (*Publisher, error) {
-	me, err := getPublisherMediaEngine()
+	tc := cfg.forTransport()
+	cfg = &tc
+	me, err := getPublisherMediaEngine(cfg.Router)
 	if err != nil {
 		Logger.Error(err, "NewPeer error", "peer_id", id)
 		return nil, errPeerConnectionInitFailed
@@ -96,7 +111,7 @@ func NewPublisher(id string, session Session, cfg *WebRTCTransportConfig) (*Publ
 			publisherTrack := PublisherTrack{track, r, true}
 			p.tracks = append(p.tracks, publisherTrack)
 			for _, rp := range p.relayPeers {
-				if err = p.createRelayTrack(track, r, rp.peer); err != nil {
+				if err = p.createRelayTrack(track, r, rp); err != nil {
 					Logger.V(0).Error(err, "Creating relay track.", "peer_id", p.id)
 				}
 			}
@@ -140,6 +155,9 @@ func NewPublisher(id string, session Session, cfg *WebRTCTransportConfig) (*Publ
 }
 
 func (p *Publisher) Answer(offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	if p.cfg.Router.EnableRTX {
+		p.setRTXPairs(offer)
+	}
 	if err := p.pc.SetRemoteDescription(offer); err != nil {
 		return webrtc.SessionDescription{}, err
 	}
@@ -161,6 +179,35 @@ func (p *Publisher) Answer(offer webrtc.SessionDescription) (webrtc.SessionDescr
 	return answer, nil
 }
 
+// setRTXPairs registers the RTX streams signaled by the publisher, so the retransmissions
+// are restored into the media buffers.
+func (p *Publisher) setRTXPairs(offer webrtc.SessionDescription) {
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		return
+	}
+	for _, md := range parsed.MediaDescriptions {
+		for _, attr := range md.Attributes {
+			if attr.Key != sdp.AttrKeySSRCGroup {
+				continue
+			}
+			split := strings.Split(attr.Value, " ")
+			if len(split) != 3 || split[0] != "FID" {
+				continue
+			}
+			media, err := strconv.ParseUint(split[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			rtx, err := strconv.ParseUint(split[2], 10, 32)
+			if err != nil {
+				continue
+			}
+			p.cfg.BufferFactory.SetRTXPair(uint32(media), uint32(rtx))
+		}
+	}
+}
+
 // GetRouter returns Router with mediaSSRC
 func (p *Publisher) GetRouter() Router {
 	return p.router
@@ -169,15 +216,13 @@ func (p *Publisher) GetRouter() Router {
 // Close peer
 func (p *Publisher) Close() {
 	p.closeOnce.Do(func() {
-		if len(p.relayPeers) > 0 {
-			p.mu.Lock()
-			for _, rp := range p.relayPeers {
-				if err := rp.peer.Close(); err != nil {
-					Logger.Error(err, "Closing relay peer transport.")
-				}
+		p.mu.Lock()
+		for _, rp := range p.relayPeers {
+			if err := rp.peer.Close(); err != nil {
+				Logger.Error(err, "Closing relay peer transport.")
 			}
-			p.mu.Unlock()
 		}
+		p.mu.Unlock()
 		p.router.Stop()
 		if err := p.pc.Close(); err != nil {
 			Logger.Error(err, "webrtc transport close err")
@@ -209,7 +254,8 @@ func (p *Publisher) PeerConnection() *webrtc.PeerConnection {
 // Relay will relay all current and future tracks from current Publisher
 func (p *Publisher) Relay(signalFn func(meta relay.PeerMeta, signal []byte) ([]byte, error),
 	options ...func(r *relayPeer)) (*relay.Peer, error) {
-	lrp := &relayPeer{}
+	cfg := p.cfg.forTransport()
+	lrp := &relayPeer{cfg: &cfg}
 	for _, o := range options {
 		o(lrp)
 	}
@@ -218,8 +264,8 @@ func (p *Publisher) Relay(signalFn func(meta relay.PeerMeta, signal []byte) ([]b
 		PeerID:    p.id,
 		SessionID: p.session.ID(),
 	}, &relay.PeerConfig{
-		SettingEngine: p.cfg.Setting,
-		ICEServers:    p.cfg.Configuration.ICEServers,
+		SettingEngine: cfg.Setting,
+		ICEServers:    cfg.Configuration.ICEServers,
 		Logger:        Logger,
 	})
 	if err != nil {
@@ -264,7 +310,7 @@ func (p *Publisher) Relay(signalFn func(meta relay.PeerMeta, signal []byte) ([]b
 				// simulcast will just relay client track for now
 				continue
 			}
-			if err = p.createRelayTrack(tp.Track, tp.Receiver, rp); err != nil {
+			if err := p.createRelayTrack(tp.Track, tp.Receiver, lrp); err != nil {
 				Logger.V(1).Error(err, "Creating relay track.", "peer_id", p.id)
 			}
 		}
@@ -294,6 +340,19 @@ func (p *Publisher) Relay(signalFn func(meta relay.PeerMeta, signal []byte) ([]b
 	return rp, nil
 }
 
+// closeRelay closes a relay of the publisher, its tracks aren't relayed to it anymore
+func (p *Publisher) closeRelay(rp *relay.Peer) error {
+	p.mu.Lock()
+	for i, lrp := range p.relayPeers {
+		if lrp.peer == rp {
+			p.relayPeers = append(p.relayPeers[:i], p.relayPeers[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	return rp.Close()
+}
+
 func (p *Publisher) PublisherTracks() []PublisherTrack {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -370,7 +429,8 @@ func (p *Publisher) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 	return nil
 }
 
-func (p *Publisher) createRelayTrack(track *webrtc.TrackRemote, receiver Receiver, rp *relay.Peer) error {
+func (p *Publisher) createRelayTrack(track *webrtc.TrackRemote, receiver Receiver, lrp *relayPeer) error {
+	rp, cfg := lrp.peer, lrp.cfg
 	codec := track.Codec()
 	downTrack, err := NewDownTrack(webrtc.RTPCodecCapability{
 		MimeType:     codec.MimeType,
@@ -378,7 +438,7 @@ func (p *Publisher) createRelayTrack(track *webrtc.TrackRemote, receiver Receive
 		Channels:     codec.Channels,
 		SDPFmtpLine:  codec.SDPFmtpLine,
 		RTCPFeedback: []webrtc.RTCPFeedback{{"nack", ""}, {"nack", "pli"}},
-	}, receiver, p.cfg.BufferFactory, p.id, p.cfg.Router.MaxPacketTrack)
+	}, receiver, cfg.BufferFactory, p.id, cfg.Router.MaxPacketTrack)
 	if err != nil {
 		Logger.V(1).Error(err, "Create Relay downtrack err", "peer_id", p.id)
 		return err
@@ -390,7 +450,7 @@ func (p *Publisher) createRelayTrack(track *webrtc.TrackRemote, receiver Receive
 		return fmt.Errorf("relay: %w", err)
 	}
 
-	p.cfg.BufferFactory.GetOrNew(packetio.RTCPBufferPacket,
+	cfg.BufferFactory.GetOrNew(packetio.RTCPBufferPacket,
 		uint32(sdr.GetParameters().Encodings[0].SSRC)).(*buffer.RTCPReader).OnPacket(func(bytes []byte) {
 		pkts, err := rtcp.Unmarshal(bytes)
 		if err != nil {
@@ -0,0 +1,92 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/relay"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// joinPublisher joins a peer publishing an audio track to the session, it returns the
+// peer, the remote peer connection, the SSRC of the track and a func stopping the media.
+func joinPublisher(t *testing.T, s *SFU, sid string, config ...JoinConfig) (*PeerLocal, *webrtc.PeerConnection, uint32, func()) {
+	me := webrtc.MediaEngine{}
+	assert.NoError(t, me.RegisterDefaultCodecs())
+	remote, err := webrtc.NewAPI(webrtc.WithMediaEngine(&me)).NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: "audio/opus"}, "audio", "stream")
+	assert.NoError(t, err)
+	sender, err := remote.AddTrack(track)
+	assert.NoError(t, err)
+	ssrc := uint32(sender.GetParameters().Encodings[0].SSRC)
+
+	p := NewPeer(s)
+	p.OnIceCandidate = func(init *webrtc.ICECandidateInit, i int) {
+		if i == publisher {
+			assert.NoError(t, remote.AddICECandidate(*init))
+		}
+	}
+	p.OnOffer = func(*webrtc.SessionDescription) {}
+	published := make(chan struct{})
+	offer, err := remote.CreateOffer(nil)
+	assert.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(remote)
+	assert.NoError(t, remote.SetLocalDescription(offer))
+	<-gatherComplete
+	assert.NoError(t, p.Join(sid, "peer", config...))
+	p.Publisher().OnPublisherTrack(func(PublisherTrack) { close(published) })
+	answer, err := p.Answer(*remote.LocalDescription())
+	assert.NoError(t, err)
+	assert.NoError(t, remote.SetRemoteDescription(*answer))
+
+	start, done := make(chan struct{}), make(chan struct{})
+	close(start)
+	go sendRTPUntilDone(start, done, t, track)
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("track not published")
+	}
+	return p, remote, ssrc, func() {
+		close(done)
+		assert.NoError(t, remote.Close())
+	}
+}
+
+func TestPublisher_Relay(t *testing.T) {
+	s := NewSFU(newSessionTestConfig())
+	target := NewSFU(newSessionTestConfig())
+	defer func() {
+		for _, session := range target.GetSessions() {
+			session.(*SessionLocal).Close()
+		}
+	}()
+
+	p, remote, ssrc, stop := joinPublisher(t, s, "session")
+	defer stop()
+	defer p.Close()
+
+	rp, err := p.Publisher().Relay(func(meta relay.PeerMeta, signal []byte) ([]byte, error) {
+		return target.AddRelayPeer(meta, signal)
+	}, RelayWithSenderReports())
+	assert.NoError(t, err)
+	assert.NotNil(t, rp)
+	assert.Eventually(t, func() bool {
+		p.Publisher().mu.RLock()
+		defer p.Publisher().mu.RUnlock()
+		return len(p.Publisher().relayPeers) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The router of the publisher keeps reading the sender reports of the relayed track
+	buff, _ := p.Publisher().cfg.BufferFactory.GetBufferPair(ssrc)
+	if assert.NotNil(t, buff) {
+		assert.NoError(t, remote.WriteRTCP([]rtcp.Packet{&rtcp.SenderReport{SSRC: ssrc, NTPTime: 42 << 32, RTPTime: 1}}))
+		assert.Eventually(t, func() bool {
+			_, ntp, _ := buff.GetSenderReportData()
+			return ntp == 42<<32
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
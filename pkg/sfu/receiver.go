@@ -1,6 +1,7 @@
 package sfu
 
 import (
+	"encoding/binary"
 	"io"
 	"math/rand"
 	"sync"
@@ -29,11 +30,14 @@ type Receiver interface {
 	GetBitrate() [3]uint64
 	GetMaxTemporalLayer() [3]int32
 	RetransmitPackets(track *DownTrack, packets []packetMeta) error
+	GetPacket(buff []byte, layer int, sn uint16) (int, error)
 	DeleteDownTrack(layer int, id string)
 	OnCloseHandler(fn func())
 	SendRTCP(p []rtcp.Packet)
 	SetRTCPCh(ch chan []rtcp.Packet)
-	GetSenderReportTime(layer int) (rtpTS uint32, ntpTS uint64)
+	GetSenderReportTime(layer int) (rtpTS uint32, ntpTS uint64, recvTS int64)
+	SetRTT(rtt uint32)
+	GetLayerStats() []LayerStats
 }
 
 // WebRTCReceiver receives a video track
@@ -47,7 +51,6 @@ type WebRTCReceiver struct {
 	kind           webrtc.RTPCodecType
 	closed         atomicBool
 	bandwidth      uint64
-	lastPli        int64
 	stream         string
 	receiver       *webrtc.RTPReceiver
 	codec          webrtc.RTPCodecParameters
@@ -62,11 +65,49 @@ type WebRTCReceiver struct {
 	nackWorker     *workerpool.WorkerPool
 	isSimulcast    bool
 	onCloseHandler func()
+
+	keyFrameCacheSize int
+	keyFrameCaches    [3]*keyFrameCache
+	keyFrames         *keyFrameRequester
+	interceptors      PacketInterceptors
+	processor         PacketProcessor
+	// forwardMu serializes the forwards of a layer, the interceptors delaying the
+	// packets forward them from their own goroutines
+	forwardMu [3]sync.Mutex
+}
+
+// ReceiverOpts sets optional features of a WebRTCReceiver
+type ReceiverOpts func(w *WebRTCReceiver)
+
+// ReceiverWithKeyFrameCache retains up to maxPackets packets from the last keyframe
+// of each video layer, the packets are replayed to the new DownTracks.
+func ReceiverWithKeyFrameCache(maxPackets int) ReceiverOpts {
+	return func(w *WebRTCReceiver) {
+		if w.kind == webrtc.RTPCodecTypeVideo {
+			w.keyFrameCacheSize = maxPackets
+		}
+	}
+}
+
+// ReceiverWithKeyFrameRequests sets the min interval between keyframe requests sent to
+// the publisher, and the time to wait for a keyframe before escalating to a FIR.
+func ReceiverWithKeyFrameRequests(minInterval, firTimeout time.Duration) ReceiverOpts {
+	return func(w *WebRTCReceiver) {
+		w.keyFrames = newKeyFrameRequester(w.keyFrames.senderSSRC, minInterval, firTimeout, w.keyFrames.send)
+	}
+}
+
+// ReceiverWithInterceptors sets the interceptors executed on the packets read from the
+// publisher buffers, before being forwarded to the DownTracks.
+func ReceiverWithInterceptors(interceptors PacketInterceptors) ReceiverOpts {
+	return func(w *WebRTCReceiver) {
+		w.interceptors = append(w.interceptors, interceptors...)
+	}
 }
 
 // NewWebRTCReceiver creates a new webrtc track receivers
-func NewWebRTCReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, pid string) Receiver {
-	return &WebRTCReceiver{
+func NewWebRTCReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, pid string, opts ...ReceiverOpts) Receiver {
+	w := &WebRTCReceiver{
 		peerID:      pid,
 		receiver:    receiver,
 		trackID:     track.ID(),
@@ -76,6 +117,14 @@ func NewWebRTCReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote,
 		nackWorker:  workerpool.New(1),
 		isSimulcast: len(track.RID()) > 0,
 	}
+	w.keyFrames = newKeyFrameRequester(rand.Uint32(), defaultPLIInterval, defaultFIRTimeout, func(pkts []rtcp.Packet) {
+		w.rtcpCh <- pkts
+	})
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.processor = w.interceptors.Process(PacketProcessFunc(w.forwardRTP))
+	return w
 }
 
 func (w *WebRTCReceiver) SetTrackMeta(trackID, streamID string) {
@@ -127,6 +176,9 @@ func (w *WebRTCReceiver) AddUpTrack(track *webrtc.TrackRemote, buff *buffer.Buff
 	w.available[layer].set(true)
 	w.downTracks[layer].Store(make([]*DownTrack, 0, 10))
 	w.pendingTracks[layer] = make([]*DownTrack, 0, 10)
+	if w.keyFrameCacheSize > 0 {
+		w.keyFrameCaches[layer] = newKeyFrameCache(w.keyFrameCacheSize)
+	}
 	w.Unlock()
 
 	subBestQuality := func(targetLayer int) {
@@ -194,6 +246,9 @@ func (w *WebRTCReceiver) AddDownTrack(track *DownTrack, bestQualityFirst bool) {
 		track.SetInitialLayers(0, 0)
 		track.trackType = SimpleDownTrack
 	}
+	if w.keyFrameCacheSize > 0 {
+		track.keyFrameReplay.set(true)
+	}
 	w.Lock()
 	w.storeDownTrack(layer, track)
 	w.Unlock()
@@ -262,23 +317,79 @@ func (w *WebRTCReceiver) deleteDownTrack(layer int, id string) {
 }
 
 func (w *WebRTCReceiver) SendRTCP(p []rtcp.Packet) {
-	if _, ok := p[0].(*rtcp.PictureLossIndication); ok {
-		if time.Now().UnixNano()-atomic.LoadInt64(&w.lastPli) < 500e6 {
-			return
+	fwd := p[:0:0]
+	for _, pkt := range p {
+		var mediaSSRC uint32
+		switch pk := pkt.(type) {
+		case *rtcp.PictureLossIndication:
+			mediaSSRC = pk.MediaSSRC
+		case *rtcp.FullIntraRequest:
+			mediaSSRC = pk.MediaSSRC
+		default:
+			fwd = append(fwd, pkt)
+			continue
+		}
+		// Keyframe requests from all the DownTracks are coalesced
+		for layer := range w.buffers {
+			if w.available[layer].get() && w.SSRC(layer) == mediaSSRC {
+				w.keyFrames.request(layer, mediaSSRC, time.Now().UnixNano())
+				break
+			}
 		}
-		atomic.StoreInt64(&w.lastPli, time.Now().UnixNano())
 	}
 
-	w.rtcpCh <- p
+	if len(fwd) > 0 {
+		w.rtcpCh <- fwd
+	}
 }
 
 func (w *WebRTCReceiver) SetRTCPCh(ch chan []rtcp.Packet) {
 	w.rtcpCh = ch
 }
 
-func (w *WebRTCReceiver) GetSenderReportTime(layer int) (rtpTS uint32, ntpTS uint64) {
-	rtpTS, ntpTS, _ = w.buffers[layer].GetSenderReportData()
-	return
+// GetSenderReportTime returns the RTP and NTP times of the last sender report of the layer
+// and its arrival time in unix nanoseconds.
+func (w *WebRTCReceiver) GetSenderReportTime(layer int) (rtpTS uint32, ntpTS uint64, recvTS int64) {
+	return w.buffers[layer].GetSenderReportData()
+}
+
+// SetRTT sets the round trip time in ms of a down track to the layer buffers, so
+// they keep enough packets to serve its retransmissions.
+func (w *WebRTCReceiver) SetRTT(rtt uint32) {
+	for _, b := range w.buffers {
+		if b != nil {
+			b.SetRTT(rtt)
+		}
+	}
+}
+
+// GetLayerStats returns the stats of the layers received
+func (w *WebRTCReceiver) GetLayerStats() []LayerStats {
+	var layers []LayerStats
+	for i, b := range w.buffers {
+		if b == nil {
+			continue
+		}
+		st := b.GetStats()
+		layers = append(layers, LayerStats{
+			Layer:       i,
+			SSRC:        b.GetMediaSSRC(),
+			Bitrate:     b.Bitrate(),
+			PacketCount: st.PacketCount,
+			LostRate:    st.LostRate,
+			Jitter:      st.Jitter,
+		})
+	}
+	return layers
+}
+
+// GetPacket copies the raw packet with the given sequence number from the layer buffer
+func (w *WebRTCReceiver) GetPacket(buff []byte, layer int, sn uint16) (int, error) {
+	b := w.buffers[layer]
+	if b == nil {
+		return 0, errPacketNotFound
+	}
+	return b.GetPacket(buff, sn)
 }
 
 func (w *WebRTCReceiver) RetransmitPackets(track *DownTrack, packets []packetMeta) error {
@@ -287,6 +398,10 @@ func (w *WebRTCReceiver) RetransmitPackets(track *DownTrack, packets []packetMet
 	}
 	w.nackWorker.Submit(func() {
 		src := packetFactory.Get().(*[]byte)
+		var rtxSrc *[]byte
+		if track.rtxPayloadType != 0 {
+			rtxSrc = packetFactory.Get().(*[]byte)
+		}
 		for _, meta := range packets {
 			pktBuff := *src
 			buff := w.buffers[meta.layer]
@@ -320,13 +435,34 @@ func (w *WebRTCReceiver) RetransmitPackets(track *DownTrack, packets []packetMet
 				}
 			}
 
+			if rtxSrc != nil {
+				// RFC 4588 payload, original sequence number followed by the original payload
+				rtxPayload := *rtxSrc
+				if len(pkt.Payload)+2 > len(rtxPayload) {
+					continue
+				}
+				binary.BigEndian.PutUint16(rtxPayload, meta.targetSeqNo)
+				n := copy(rtxPayload[2:], pkt.Payload)
+				pkt.Header.Padding = false
+				if err = track.writeRTX(&pkt.Header, rtxPayload[:n+2]); err != nil {
+					Logger.Error(err, "Writing rtx packet err")
+				} else {
+					track.metrics.NACKServed()
+				}
+				continue
+			}
+
 			if _, err = track.writeStream.WriteRTP(&pkt.Header, pkt.Payload); err != nil {
 				Logger.Error(err, "Writing rtx packet err")
 			} else {
 				track.UpdateStats(uint32(i))
+				track.metrics.NACKServed()
 			}
 		}
 		packetFactory.Put(src)
+		if rtxSrc != nil {
+			packetFactory.Put(rtxSrc)
+		}
 	})
 	return nil
 }
@@ -368,18 +504,53 @@ func (w *WebRTCReceiver) writeRTP(layer int) {
 			}
 		}
 
-		for _, dt := range w.downTracks[layer].Load().([]*DownTrack) {
-			if err = dt.WriteRTP(pkt, layer); err != nil {
-				if err == io.EOF || err == io.ErrClosedPipe {
-					w.Lock()
-					w.deleteDownTrack(layer, dt.id)
-					w.Unlock()
-				}
-				Logger.Error(err, "Error writing to down track", "id", dt.id)
-			}
+		if w.kind == webrtc.RTPCodecTypeVideo {
+			w.keyFrames.onPacket(layer, pkt.KeyFrame, time.Now().UnixNano())
+		}
+
+		if err = w.processor.Process(PacketArgs{
+			Receiver: w,
+			Layer:    layer,
+			Packet:   pkt,
+		}); err != nil {
+			Logger.V(1).Error(err, "Error processing packet", "peer_id", w.peerID, "layer", layer)
 		}
 	}
+}
+
+// forwardRTP writes the packets that went through the receiver interceptors to the DownTracks
+func (w *WebRTCReceiver) forwardRTP(args PacketArgs) error {
+	layer, pkt := args.Layer, args.Packet
+	w.forwardMu[layer].Lock()
+	defer w.forwardMu[layer].Unlock()
+	kfCache := w.keyFrameCaches[layer]
+	if kfCache != nil {
+		kfCache.push(pkt)
+	}
 
+	var err error
+	for _, dt := range w.downTracks[layer].Load().([]*DownTrack) {
+		if kfCache != nil && dt.keyFrameReplay.get() && dt.bound.get() {
+			// The cache includes the current packet
+			dt.keyFrameReplay.set(false)
+			if len(kfCache.packets) > 0 {
+				err = kfCache.replay(dt, layer)
+			} else {
+				err = dt.WriteRTP(pkt, layer)
+			}
+		} else {
+			err = dt.WriteRTP(pkt, layer)
+		}
+		if err != nil {
+			if err == io.EOF || err == io.ErrClosedPipe {
+				w.Lock()
+				w.deleteDownTrack(layer, dt.id)
+				w.Unlock()
+			}
+			Logger.Error(err, "Error writing to down track", "id", dt.id)
+		}
+	}
+	return nil
 }
 
 // closeTracks close all tracks from Receiver
@@ -1,8 +1,13 @@
 package sfu
 
 import (
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,3 +35,46 @@ func TestWebRTCReceiver_OnCloseHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestWebRTCReceiver_forwardRTP_delayed(t *testing.T) {
+	const packets, delay = 20, 10 * time.Millisecond
+	var wg sync.WaitGroup
+	delayed := func(next PacketProcessor) PacketProcessor {
+		return PacketProcessFunc(func(args PacketArgs) error {
+			cp, err := ClonePacket(args.Packet)
+			if err != nil {
+				return err
+			}
+			args.Packet = cp
+			wg.Add(1)
+			time.AfterFunc(delay, func() {
+				defer wg.Done()
+				assert.NoError(t, next.Process(args))
+			})
+			return nil
+		})
+	}
+
+	w := &WebRTCReceiver{kind: webrtc.RTPCodecTypeVideo}
+	w.keyFrameCaches[0] = newKeyFrameCache(packets)
+	w.downTracks[0].Store([]*DownTrack{})
+	w.processor = PacketInterceptors{delayed}.Process(PacketProcessFunc(w.forwardRTP))
+
+	start := time.Now()
+	for i := 0; i < packets; i++ {
+		assert.NoError(t, w.processor.Process(PacketArgs{
+			Receiver: w,
+			Packet: &buffer.ExtPacket{
+				KeyFrame: true,
+				Packet: rtp.Packet{
+					Header:  rtp.Header{Version: 2, SequenceNumber: uint16(i), Timestamp: 1000},
+					Payload: []byte{1},
+				},
+			},
+		}))
+	}
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(delay))
+	assert.Len(t, w.keyFrameCaches[0].packets, packets)
+}
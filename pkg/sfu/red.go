@@ -0,0 +1,99 @@
+package sfu
+
+import "encoding/binary"
+
+const (
+	// redMaxRedundancy is the number of previous frames carried in each RED packet
+	redMaxRedundancy = 2
+	// redMaxTimestampOffset is the biggest offset the 14 bits RED header can hold
+	redMaxTimestampOffset = 1<<14 - 1
+	// redMaxBlockLength is the biggest block length the 10 bits RED header can hold
+	redMaxBlockLength = 1<<10 - 1
+	// opusDTXMaxSize is the payload size below which an opus frame is considered
+	// a DTX (silence) frame and is not worth to be sent as redundancy
+	opusDTXMaxSize = 2
+)
+
+// redBlock is a previous audio frame carried as redundancy of a RED packet
+type redBlock struct {
+	timestamp uint32
+	payload   []byte
+}
+
+// encodeRED builds a RFC 2198 payload in buf with the primary frame and the redundant
+// blocks, blocks must be ordered from the oldest to the newest. Blocks that can't be
+// represented in the RED header (too old or too big) and DTX frames are skipped.
+func encodeRED(buf []byte, pt uint8, timestamp uint32, primary []byte, blocks []redBlock) ([]byte, error) {
+	valid := blocks[:0:0]
+	for _, b := range blocks {
+		offset := timestamp - b.timestamp
+		if offset == 0 || offset > redMaxTimestampOffset || len(b.payload) > redMaxBlockLength ||
+			len(b.payload) <= opusDTXMaxSize {
+			continue
+		}
+		valid = append(valid, b)
+	}
+
+	size := 1 + len(primary)
+	for _, b := range valid {
+		size += 4 + len(b.payload)
+	}
+	if size > len(buf) {
+		return nil, errInvalidREDPacket
+	}
+
+	n := 0
+	for _, b := range valid {
+		hdr := uint32(0x80|pt&0x7f)<<24 | (timestamp-b.timestamp)<<10 | uint32(len(b.payload))
+		binary.BigEndian.PutUint32(buf[n:], hdr)
+		n += 4
+	}
+	buf[n] = pt & 0x7f
+	n++
+	for _, b := range valid {
+		n += copy(buf[n:], b.payload)
+	}
+	n += copy(buf[n:], primary)
+	return buf[:n], nil
+}
+
+// extractREDPrimary returns the primary frame of a RFC 2198 payload.
+func extractREDPrimary(payload []byte) ([]byte, error) {
+	var (
+		idx    int
+		length int
+	)
+	for {
+		if idx >= len(payload) {
+			return nil, errInvalidREDPacket
+		}
+		if payload[idx]&0x80 == 0 {
+			// Last header, primary block
+			idx++
+			break
+		}
+		if idx+4 > len(payload) {
+			return nil, errInvalidREDPacket
+		}
+		length += int(binary.BigEndian.Uint16(payload[idx+2:]) & 0x03ff)
+		idx += 4
+	}
+	if idx+length > len(payload) {
+		return nil, errInvalidREDPacket
+	}
+	return payload[idx+length:], nil
+}
+
+// setREDPayloadType rewrites the payload type of all the blocks in a RFC 2198 payload
+func setREDPayloadType(payload []byte, pt uint8) error {
+	idx := 0
+	for idx < len(payload) {
+		last := payload[idx]&0x80 == 0
+		payload[idx] = payload[idx]&0x80 | pt&0x7f
+		if last {
+			return nil
+		}
+		idx += 4
+	}
+	return errInvalidREDPacket
+}
@@ -0,0 +1,126 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_encodeRED(t *testing.T) {
+	type args struct {
+		timestamp uint32
+		primary   []byte
+		blocks    []redBlock
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      []byte
+		wantError bool
+	}{
+		{
+			name: "Must encode primary only",
+			args: args{
+				timestamp: 960,
+				primary:   []byte{1, 2, 3},
+			},
+			want: []byte{111, 1, 2, 3},
+		},
+		{
+			name: "Must encode redundant blocks before primary",
+			args: args{
+				timestamp: 1920,
+				primary:   []byte{7, 8, 9},
+				blocks: []redBlock{
+					{timestamp: 0, payload: []byte{1, 2, 3}},
+					{timestamp: 960, payload: []byte{4, 5, 6}},
+				},
+			},
+			want: []byte{
+				0x80 | 111, 0x1e, 0x00, 0x03,
+				0x80 | 111, 0x0f, 0x00, 0x03,
+				111,
+				1, 2, 3, 4, 5, 6, 7, 8, 9,
+			},
+		},
+		{
+			name: "Must skip DTX and out of range blocks",
+			args: args{
+				timestamp: 20000,
+				primary:   []byte{7, 8, 9},
+				blocks: []redBlock{
+					{timestamp: 0, payload: []byte{1, 2, 3}},
+					{timestamp: 19040, payload: []byte{4}},
+				},
+			},
+			want: []byte{111, 7, 8, 9},
+		},
+		{
+			name: "Must fail on small buffer",
+			args: args{
+				timestamp: 960,
+				primary:   make([]byte, 1500),
+			},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, 1460)
+			got, err := encodeRED(buf, 111, tt.args.timestamp, tt.args.primary, tt.args.blocks)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			primary, err := extractREDPrimary(got)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.args.primary, primary)
+		})
+	}
+}
+
+func Test_extractREDPrimary(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   []byte
+		want      []byte
+		wantError bool
+	}{
+		{
+			name:    "Must return primary",
+			payload: []byte{0x80 | 111, 0x0f, 0x00, 0x02, 111, 1, 2, 3, 4},
+			want:    []byte{3, 4},
+		},
+		{
+			name:      "Must fail on truncated header",
+			payload:   []byte{0x80 | 111, 0x0f},
+			wantError: true,
+		},
+		{
+			name:      "Must fail on truncated blocks",
+			payload:   []byte{0x80 | 111, 0x0f, 0x00, 0x08, 111, 1, 2},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractREDPrimary(tt.payload)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_setREDPayloadType(t *testing.T) {
+	payload := []byte{0x80 | 109, 0x0f, 0x00, 0x01, 109, 1, 2}
+	assert.NoError(t, setREDPayloadType(payload, 111))
+	assert.Equal(t, []byte{0x80 | 111, 0x0f, 0x00, 0x01, 111, 1, 2}, payload)
+}
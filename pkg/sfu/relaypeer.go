@@ -21,7 +21,7 @@ type RelayPeer struct {
 	router       Router
 	config       *WebRTCTransportConfig
 	tracks       []PublisherTrack
-	relayPeers   []*relay.Peer
+	relayPeers   []*relayPeer
 	dataChannels []*webrtc.DataChannel
 }
 
@@ -67,18 +67,20 @@ func (r *RelayPeer) ID() string {
 }
 
 func (r *RelayPeer) Relay(signalFn func(meta relay.PeerMeta, signal []byte) ([]byte, error)) (*relay.Peer, error) {
+	cfg := r.config.forTransport()
 	rp, err := relay.NewPeer(relay.PeerMeta{
 		PeerID:    r.peer.ID(),
 		SessionID: r.session.ID(),
 	}, &relay.PeerConfig{
-		SettingEngine: r.config.Setting,
-		ICEServers:    r.config.Configuration.ICEServers,
+		SettingEngine: cfg.Setting,
+		ICEServers:    cfg.Configuration.ICEServers,
 		Logger:        Logger,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("relay: %w", err)
 	}
 
+	lrp := &relayPeer{peer: rp, cfg: &cfg}
 	rp.OnReady(func() {
 		r.mu.Lock()
 		for _, tp := range r.tracks {
@@ -86,11 +88,11 @@ func (r *RelayPeer) Relay(signalFn func(meta relay.PeerMeta, signal []byte) ([]b
 				// simulcast will just relay client track for now
 				continue
 			}
-			if err = r.createRelayTrack(tp.Track, tp.Receiver, rp); err != nil {
+			if err := r.createRelayTrack(tp.Track, tp.Receiver, lrp); err != nil {
 				Logger.V(1).Error(err, "Creating relay track.", "peer_id", r.ID())
 			}
 		}
-		r.relayPeers = append(r.relayPeers, rp)
+		r.relayPeers = append(r.relayPeers, lrp)
 		r.mu.Unlock()
 		go r.relayReports(rp)
 	})
@@ -120,7 +122,8 @@ func (r *RelayPeer) DataChannel(label string) *webrtc.DataChannel {
 	return nil
 }
 
-func (r *RelayPeer) createRelayTrack(track *webrtc.TrackRemote, receiver Receiver, rp *relay.Peer) error {
+func (r *RelayPeer) createRelayTrack(track *webrtc.TrackRemote, receiver Receiver, lrp *relayPeer) error {
+	rp, cfg := lrp.peer, lrp.cfg
 	codec := track.Codec()
 	downTrack, err := NewDownTrack(webrtc.RTPCodecCapability{
 		MimeType:     codec.MimeType,
@@ -128,7 +131,7 @@ func (r *RelayPeer) createRelayTrack(track *webrtc.TrackRemote, receiver Receive
 		Channels:     codec.Channels,
 		SDPFmtpLine:  codec.SDPFmtpLine,
 		RTCPFeedback: []webrtc.RTCPFeedback{{"nack", ""}, {"nack", "pli"}},
-	}, receiver, r.config.BufferFactory, r.ID(), r.config.Router.MaxPacketTrack)
+	}, receiver, cfg.BufferFactory, r.ID(), cfg.Router.MaxPacketTrack)
 	if err != nil {
 		Logger.V(1).Error(err, "Create Relay downtrack err", "peer_id", r.ID())
 		return err
@@ -140,7 +143,7 @@ func (r *RelayPeer) createRelayTrack(track *webrtc.TrackRemote, receiver Receive
 		return fmt.Errorf("relay: %w", err)
 	}
 
-	r.config.BufferFactory.GetOrNew(packetio.RTCPBufferPacket,
+	cfg.BufferFactory.GetOrNew(packetio.RTCPBufferPacket,
 		uint32(sdr.GetParameters().Encodings[0].SSRC)).(*buffer.RTCPReader).OnPacket(func(bytes []byte) {
 		pkts, err := rtcp.Unmarshal(bytes)
 		if err != nil {
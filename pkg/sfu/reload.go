@@ -0,0 +1,118 @@
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/pion/turn/v2"
+)
+
+// ErrUnsafeConfigChange is returned when a reloaded config changes fields that can't be
+// applied without a restart, the other fields are applied.
+var ErrUnsafeConfigChange = errors.New("config changes require a restart")
+
+// unsafeFields are the config fields only applied on start
+var unsafeFields = []struct {
+	name  string
+	value func(c *Config) interface{}
+}{
+	{"sfu", func(c *Config) interface{} {
+		sc := c.SFU
+		sc.DrainTimeout = 0
+		sc.AdminToken, sc.NodeSecret = "", ""
+		sc.MaxSessions, sc.MaxPeers = 0, 0
+		sc.PullOrigin = ""
+		return sc
+	}},
+	{"webrtc.singleport", func(c *Config) interface{} { return c.WebRTC.ICESinglePort }},
+	{"webrtc.portrange", func(c *Config) interface{} { return c.WebRTC.ICEPortRange }},
+	{"webrtc.iceserver", func(c *Config) interface{} { return c.WebRTC.ICEServers }},
+	{"webrtc.candidates", func(c *Config) interface{} { return c.WebRTC.Candidates }},
+	{"webrtc.sdpsemantics", func(c *Config) interface{} { return c.WebRTC.SDPSemantics }},
+	{"webrtc.mdns", func(c *Config) interface{} { return c.WebRTC.MDNS }},
+	{"webrtc.timeouts", func(c *Config) interface{} { return c.WebRTC.Timeouts }},
+	// The buffers and the negotiated codecs of the tracks can't change
+	{"router.maxpackettrack", func(c *Config) interface{} { return c.Router.MaxPacketTrack }},
+	{"router.media", func(c *Config) interface{} { return c.Router.Media }},
+	{"turn", func(c *Config) interface{} {
+		t := c.Turn
+		t.Auth = TurnAuth{}
+		return t
+	}},
+	{"events", func(c *Config) interface{} { return c.Events }},
+	{"tracing", func(c *Config) interface{} { return c.Tracing }},
+	{"mesh", func(c *Config) interface{} { return c.Mesh }},
+}
+
+// Reload applies a reloaded config. The router config applies to the new sessions, the
+// audio observer and last-N settings of the existing sessions apply at once and the other
+// router settings to their tracks published and subscribed after the call. The TURN auth
+// applies to the new allocations, the admin token and the node secret to the next
+// requests, the admission limits to the next joins, the pull origin to the next
+// connection to the origin and the drain timeout to the next drain. The changes of the
+// other fields are rejected, they are logged, counted and returned as
+// ErrUnsafeConfigChange.
+func (s *SFU) Reload(c Config) error {
+	s.Lock()
+	var rejected []string
+	for _, f := range unsafeFields {
+		if !reflect.DeepEqual(f.value(&s.config), f.value(&c)) {
+			rejected = append(rejected, f.name)
+		}
+	}
+
+	router := c.Router
+	router.WithStats = s.webrtc.Router.WithStats
+	router.MaxPacketTrack = s.config.Router.MaxPacketTrack
+	router.Media = s.config.Router.Media
+	s.config.Router = router
+	s.webrtc.Router = router
+	s.config.Turn.Auth = c.Turn.Auth
+	if c.SFU.DrainTimeout > 0 {
+		s.config.SFU.DrainTimeout = c.SFU.DrainTimeout
+	}
+	s.config.SFU.AdminToken = c.SFU.AdminToken
+	s.config.SFU.NodeSecret = c.SFU.NodeSecret
+	s.config.SFU.MaxSessions = c.SFU.MaxSessions
+	s.config.SFU.MaxPeers = c.SFU.MaxPeers
+	s.config.SFU.PullOrigin = c.SFU.PullOrigin
+	turnConfig := s.config.Turn
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.Unlock()
+
+	if s.ownsFactory {
+		s.webrtc.BufferFactory.SetReorderWindow(router.ReorderWindow)
+		s.webrtc.BufferFactory.SetAdaptiveBuckets(router.AdaptiveBuckets)
+		s.webrtc.BufferFactory.SetMemoryBudget(int64(router.BufferBudget) * 1024 * 1024)
+	}
+	if s.turnAuth.Load() != nil {
+		s.turnAuth.Store(turnAuthHandler(turnConfig))
+	}
+	for _, session := range sessions {
+		if sl, ok := session.(*SessionLocal); ok {
+			sl.setRouterConfig(router)
+		}
+	}
+
+	s.webrtc.Metrics.ConfigReloaded()
+	if len(rejected) == 0 {
+		Logger.V(0).Info("Config reloaded")
+		return nil
+	}
+	for _, field := range rejected {
+		Logger.Info("Config change rejected, restart to apply it", "field", field)
+		s.webrtc.Metrics.ConfigRejected(field)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsafeConfigChange, strings.Join(rejected, ", "))
+}
+
+// authenticateTurn authenticates the TURN users with the handler of the current config
+func (s *SFU) authenticateTurn(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+	return s.turnAuth.Load().(turn.AuthHandler)(username, realm, srcAddr)
+}
@@ -0,0 +1,85 @@
+package sfu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSFU_Reload(t *testing.T) {
+	s := NewSFU(newSessionTestConfig())
+	session, _ := s.GetSession("session")
+	sl := session.(*SessionLocal)
+	defer func() {
+		// Stop the audio observers before the other tests swap the logger
+		for _, session := range s.GetSessions() {
+			session.(*SessionLocal).Close()
+		}
+	}()
+
+	c := newTestConfig()
+	c.Router.MaxBandwidth = 1500
+	c.Router.AudioLevelThreshold = 50
+	c.Router.AudioLevelInterval = 1000
+	c.Router.AudioLevelFilter = 20
+	c.Router.LastN = LastNConfig{N: 2}
+	c.Turn.Auth.Credentials = "user=pass"
+	c.SFU.AdminToken = "admin"
+	c.SFU.NodeSecret = "secret"
+	c.SFU.MaxSessions = 1
+	c.SFU.MaxPeers = 1
+	c.SFU.PullOrigin = "origin:7000"
+	assert.NoError(t, s.Reload(c))
+
+	assert.True(t, s.AuthorizeAdmin("admin"))
+	assert.Equal(t, "secret", s.NodeSecret())
+	assert.Equal(t, "origin:7000", s.PullOrigin())
+	assert.Equal(t, ErrSessionLimit, s.Admit("new"))
+
+	_, cfg := s.GetSession("other")
+	assert.Equal(t, uint64(1500), cfg.Router.MaxBandwidth)
+	assert.Equal(t, c.Router.LastN, sl.routerConfig().LastN)
+	sl.audioObs.RLock()
+	assert.Equal(t, uint8(50), sl.audioObs.threshold)
+	assert.Equal(t, 10, sl.audioObs.expected)
+	sl.audioObs.RUnlock()
+
+	c.Router.MaxBandwidth = 3000
+	c.Router.MaxPacketTrack = 500
+	c.WebRTC.ICEPortRange = []uint16{50000, 60000}
+	err := s.Reload(c)
+	assert.True(t, errors.Is(err, ErrUnsafeConfigChange))
+	assert.Contains(t, err.Error(), "webrtc.portrange")
+	assert.Contains(t, err.Error(), "router.maxpackettrack")
+
+	// The safe fields are applied, the unsafe ones are kept
+	_, cfg = s.GetSession("other")
+	assert.Equal(t, uint64(3000), cfg.Router.MaxBandwidth)
+	assert.Equal(t, 200, cfg.Router.MaxPacketTrack)
+	assert.Equal(t, 200, sl.routerConfig().MaxPacketTrack)
+}
+
+func TestSessionLocal_updateLastN(t *testing.T) {
+	s := &SessionLocal{}
+
+	s.updateLastN(LastNConfig{})
+	assert.Nil(t, s.lastN)
+
+	s.updateLastN(LastNConfig{N: 2, Hold: 1000})
+	lastN := s.lastN
+	if assert.NotNil(t, lastN) {
+		assert.Equal(t, 2, lastN.n)
+	}
+
+	s.updateLastN(LastNConfig{N: 2, Hold: 1000})
+	assert.Same(t, lastN, s.lastN)
+
+	s.updateLastN(LastNConfig{N: 3, Hold: 1000})
+	if assert.NotNil(t, s.lastN) {
+		assert.Equal(t, 3, s.lastN.n)
+	}
+
+	s.updateLastN(LastNConfig{})
+	assert.Nil(t, s.lastN)
+}
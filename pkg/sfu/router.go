@@ -1,8 +1,12 @@
 package sfu
 
 import (
+	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/pion/ion-sfu/pkg/stats"
@@ -29,49 +33,91 @@ type RouterConfig struct {
 	WithStats           bool            `mapstructure:"withstats"`
 	MaxBandwidth        uint64          `mapstructure:"maxbandwidth"`
 	MaxPacketTrack      int             `mapstructure:"maxpackettrack"`
+	AdaptiveBuckets     bool            `mapstructure:"adaptivebuckets"`
+	BufferBudget        int             `mapstructure:"bufferbudget"`
+	ReorderWindow       int             `mapstructure:"reorderwindow"`
+	KeyFrameCache       int             `mapstructure:"keyframecache"`
+	PLIInterval         int             `mapstructure:"pliinterval"`
+	FIRTimeout          int             `mapstructure:"firtimeout"`
 	AudioLevelInterval  int             `mapstructure:"audiolevelinterval"`
 	AudioLevelThreshold uint8           `mapstructure:"audiolevelthreshold"`
 	AudioLevelFilter    int             `mapstructure:"audiolevelfilter"`
+	AudioLevelSmoothing int             `mapstructure:"audiolevelsmoothing"`
+	EnableRED           bool            `mapstructure:"enablered"`
+	EnableRTX           bool            `mapstructure:"enablertx"`
+	FEC                 FECConfig       `mapstructure:"fec"`
+	Probe               ProbeConfig     `mapstructure:"probe"`
 	Simulcast           SimulcastConfig `mapstructure:"simulcast"`
+	Media               MediaConfig     `mapstructure:"media"`
+	LastN               LastNConfig     `mapstructure:"lastn"`
 }
 
 type router struct {
 	sync.RWMutex
-	id            string
-	twcc          *twcc.Responder
-	stats         map[uint32]*stats.Stream
-	rtcpCh        chan []rtcp.Packet
-	stopCh        chan struct{}
-	config        RouterConfig
-	session       Session
-	receivers     map[string]Receiver
-	bufferFactory *buffer.Factory
-	writeRTCP     func([]rtcp.Packet) error
-	onAddTrack    atomic.Value // func(Receiver)
-	onDelTrack    atomic.Value // func(Receiver)
+	id             string
+	twcc           *twcc.Responder
+	stats          map[uint32]*stats.Stream
+	rtcpCh         chan []rtcp.Packet
+	stopCh         chan struct{}
+	configMu       sync.RWMutex
+	config         RouterConfig
+	session        Session
+	receivers      map[string]Receiver
+	bufferFactory  *buffer.Factory
+	interceptors   PacketInterceptors
+	dtInterceptors PacketInterceptors
+	metrics        *stats.Metrics
+	sessionMetrics *stats.SessionMetrics
+	events         *EventBus
+	sid            string
+	writeRTCP      func([]rtcp.Packet) error
+	onAddTrack     atomic.Value // func(Receiver)
+	onDelTrack     atomic.Value // func(Receiver)
 }
 
 // newRouter for routing rtp/rtcp packets
 func newRouter(id string, session Session, config *WebRTCTransportConfig) Router {
 	ch := make(chan []rtcp.Packet, 10)
 	r := &router{
-		id:            id,
-		rtcpCh:        ch,
-		stopCh:        make(chan struct{}),
-		config:        config.Router,
-		session:       session,
-		receivers:     make(map[string]Receiver),
-		stats:         make(map[uint32]*stats.Stream),
-		bufferFactory: config.BufferFactory,
+		id:             id,
+		rtcpCh:         ch,
+		stopCh:         make(chan struct{}),
+		config:         config.Router,
+		session:        session,
+		receivers:      make(map[string]Receiver),
+		stats:          make(map[uint32]*stats.Stream),
+		bufferFactory:  config.BufferFactory,
+		interceptors:   config.ReceiverInterceptors,
+		dtInterceptors: config.DownTrackInterceptors,
+		metrics:        config.Metrics,
+		events:         config.Events,
 	}
-
-	if config.Router.WithStats {
-		stats.Peers.Inc()
+	if session != nil {
+		r.sid = session.ID()
 	}
 
+	r.sessionMetrics = r.metrics.Session(r.sid)
+	r.sessionMetrics.PeerJoined()
+
 	return r
 }
 
+// setConfig sets the config of the tracks published and subscribed after the call, the
+// codecs negotiated by the publisher and the buffers size are kept.
+func (r *router) setConfig(c RouterConfig) {
+	r.configMu.Lock()
+	c.Media = r.config.Media
+	c.MaxPacketTrack = r.config.MaxPacketTrack
+	r.config = c
+	r.configMu.Unlock()
+}
+
+func (r *router) getConfig() RouterConfig {
+	r.configMu.RLock()
+	defer r.configMu.RUnlock()
+	return r.config
+}
+
 func (r *router) GetReceiver() map[string]Receiver {
 	return r.receivers
 }
@@ -91,15 +137,14 @@ func (r *router) ID() string {
 func (r *router) Stop() {
 	r.stopCh <- struct{}{}
 
-	if r.config.WithStats {
-		stats.Peers.Dec()
-	}
+	r.sessionMetrics.PeerLeft()
 }
 
 func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, trackID, streamID string) (Receiver, bool) {
 	r.Lock()
 	defer r.Unlock()
 
+	config := r.getConfig()
 	publish := false
 
 	buff, rtcpReader := r.bufferFactory.GetBufferPair(uint32(track.SSRC()))
@@ -126,8 +171,8 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 		})
 	}
 
-	if r.config.WithStats {
-		r.stats[uint32(track.SSRC())] = stats.NewStream(buff)
+	if r.metrics != nil {
+		r.stats[uint32(track.SSRC())] = r.metrics.NewStream(buff, r.sid, trackID)
 	}
 
 	rtcpReader.OnPacket(func(bytes []byte) {
@@ -139,7 +184,7 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 		for _, pkt := range pkts {
 			switch pkt := pkt.(type) {
 			case *rtcp.SourceDescription:
-				if r.config.WithStats {
+				if r.metrics != nil {
 					for _, chunk := range pkt.Chunks {
 						if s, ok := r.stats[chunk.Source]; ok {
 							for _, item := range chunk.Items {
@@ -152,7 +197,7 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 				}
 			case *rtcp.SenderReport:
 				buff.SetSenderReportData(pkt.RTPTime, pkt.NTPTime)
-				if r.config.WithStats {
+				if r.metrics != nil {
 					if st := r.stats[pkt.SSRC]; st != nil {
 						r.updateStats(st)
 					}
@@ -163,43 +208,58 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 
 	recv, ok := r.receivers[trackID]
 	if !ok {
-		recv = NewWebRTCReceiver(receiver, track, r.id)
+		var opts []ReceiverOpts
+		if config.KeyFrameCache > 0 {
+			opts = append(opts, ReceiverWithKeyFrameCache(config.KeyFrameCache))
+		}
+		if config.PLIInterval > 0 || config.FIRTimeout > 0 {
+			opts = append(opts, ReceiverWithKeyFrameRequests(time.Duration(config.PLIInterval)*time.Millisecond,
+				time.Duration(config.FIRTimeout)*time.Millisecond))
+		}
+		if len(r.interceptors) > 0 {
+			opts = append(opts, ReceiverWithInterceptors(r.interceptors))
+		}
+		recv = NewWebRTCReceiver(receiver, track, r.id, opts...)
 		r.receivers[trackID] = recv
 		recv.SetRTCPCh(r.rtcpCh)
 		recv.OnCloseHandler(func() {
-			if r.config.WithStats {
-				if track.Kind() == webrtc.RTPCodecTypeVideo {
-					stats.VideoTracks.Dec()
-				} else {
-					stats.AudioTracks.Dec()
-				}
-			}
+			r.sessionMetrics.TrackRemoved(track.Kind() == webrtc.RTPCodecTypeVideo)
+			r.events.Emit(Event{
+				Type:      EventTrackUnpublished,
+				SessionID: r.sid,
+				PeerID:    r.id,
+				TrackID:   trackID,
+				StreamID:  streamID,
+				Kind:      track.Kind().String(),
+			})
 			if recv.Kind() == webrtc.RTPCodecTypeAudio {
 				r.session.AudioObserver().removeStream(track.StreamID())
 			}
 			r.deleteReceiver(trackID, uint32(track.SSRC()))
 		})
 		publish = true
+		r.sessionMetrics.TrackAdded(track.Kind() == webrtc.RTPCodecTypeVideo)
+		r.events.Emit(Event{
+			Type:      EventTrackPublished,
+			SessionID: r.sid,
+			PeerID:    r.id,
+			TrackID:   trackID,
+			StreamID:  streamID,
+			Kind:      track.Kind().String(),
+		})
 
 		if handler, ok := r.onAddTrack.Load().(func(Receiver)); ok && handler != nil {
 			handler(recv)
 		}
 	}
 
-	recv.AddUpTrack(track, buff, r.config.Simulcast.BestQualityFirst)
+	recv.AddUpTrack(track, buff, config.Simulcast.BestQualityFirst)
 
 	buff.Bind(receiver.GetParameters(), buffer.Options{
-		MaxBitRate: r.config.MaxBandwidth,
+		MaxBitRate: config.MaxBandwidth,
+		E2EE:       r.session != nil && r.session.E2EE(),
 	})
 
-	if r.config.WithStats {
-		if track.Kind() == webrtc.RTPCodecTypeVideo {
-			stats.VideoTracks.Inc()
-		} else {
-			stats.AudioTracks.Inc()
-		}
-	}
-
 	return recv, publish
 }
 
@@ -213,6 +273,9 @@ func (r *router) AddDownTracks(s *Subscriber, recv Receiver) error {
 	}
 
 	if recv != nil {
+		if !s.policy.allowsTrack(recv) {
+			return nil
+		}
 		if _, err := r.AddDownTrack(s, recv); err != nil {
 			return err
 		}
@@ -220,12 +283,17 @@ func (r *router) AddDownTracks(s *Subscriber, recv Receiver) error {
 		return nil
 	}
 
-	if len(r.receivers) > 0 {
-		for _, rcv := range r.receivers {
-			if _, err := r.AddDownTrack(s, rcv); err != nil {
-				return err
-			}
+	added := false
+	for _, rcv := range r.receivers {
+		if !s.policy.allowsTrack(rcv) {
+			continue
 		}
+		if _, err := r.AddDownTrack(s, rcv); err != nil {
+			return err
+		}
+		added = true
+	}
+	if added {
 		s.negotiate()
 	}
 	return nil
@@ -237,6 +305,8 @@ func (r *router) SetRTCPWriter(fn func(packet []rtcp.Packet) error) {
 }
 
 func (r *router) AddDownTrack(sub *Subscriber, recv Receiver) (*DownTrack, error) {
+	config := r.getConfig()
+
 	for _, dt := range sub.GetDownTracks(recv.StreamID()) {
 		if dt.ID() == recv.TrackID() {
 			return dt, nil
@@ -244,9 +314,41 @@ func (r *router) AddDownTrack(sub *Subscriber, recv Receiver) (*DownTrack, error
 	}
 
 	codec := recv.Codec()
+	if config.EnableRED && recv.Kind() == webrtc.RTPCodecTypeAudio &&
+		(strings.EqualFold(codec.MimeType, mimeTypeOpus) || strings.EqualFold(codec.MimeType, mimeTypeRED)) {
+		// Offer RED first so subscribers supporting it prefer it, the DownTrack
+		// will generate or strip the redundancy according to the negotiated codec.
+		if strings.EqualFold(codec.MimeType, mimeTypeRED) {
+			codec = webrtc.RTPCodecParameters{RTPCodecCapability: opusCodecCapability(""), PayloadType: opusPayloadType}
+		}
+		if err := sub.me.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: redCodecCapability(codec.PayloadType),
+			PayloadType:        redPayloadType,
+		}, recv.Kind()); err != nil {
+			return nil, err
+		}
+	}
 	if err := sub.me.RegisterCodec(codec, recv.Kind()); err != nil {
 		return nil, err
 	}
+	withRTX := false
+	if config.EnableRTX && recv.Kind() == webrtc.RTPCodecTypeVideo {
+		var rtx webrtc.RTPCodecParameters
+		if rtx, withRTX = config.Media.rtxCodec(codec.PayloadType); withRTX {
+			if err := sub.me.RegisterCodec(rtx, recv.Kind()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	withFEC := config.FEC.Enabled && recv.Kind() == webrtc.RTPCodecTypeVideo
+	if withFEC {
+		if err := sub.me.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeFlexFEC, ClockRate: 90000, SDPFmtpLine: "repair-window=10000000"},
+			PayloadType:        flexFECPayloadType,
+		}, recv.Kind()); err != nil {
+			return nil, err
+		}
+	}
 
 	downTrack, err := NewDownTrack(webrtc.RTPCodecCapability{
 		MimeType:     codec.MimeType,
@@ -254,7 +356,7 @@ func (r *router) AddDownTrack(sub *Subscriber, recv Receiver) (*DownTrack, error
 		Channels:     codec.Channels,
 		SDPFmtpLine:  codec.SDPFmtpLine,
 		RTCPFeedback: []webrtc.RTCPFeedback{{"goog-remb", ""}, {"nack", ""}, {"nack", "pli"}},
-	}, recv, r.bufferFactory, sub.id, r.config.MaxPacketTrack)
+	}, recv, sub.bufferFactory, sub.id, config.MaxPacketTrack)
 	if err != nil {
 		return nil, err
 	}
@@ -264,9 +366,39 @@ func (r *router) AddDownTrack(sub *Subscriber, recv Receiver) (*DownTrack, error
 	}); err != nil {
 		return nil, err
 	}
+	if withRTX {
+		downTrack.rtxSSRC = rand.Uint32()
+	}
+	if withFEC {
+		downTrack.fec = newFlexFEC(rand.Uint32(), config.FEC)
+	}
+	if config.Probe.Enabled && recv.Kind() == webrtc.RTPCodecTypeVideo {
+		downTrack.probe = newProbeHelper(config.Probe)
+	}
+	if len(r.dtInterceptors) > 0 {
+		downTrack.Use(r.dtInterceptors...)
+	}
+	downTrack.metrics = r.sessionMetrics.DownTrack()
+	subscription := Event{
+		SessionID: r.sid,
+		PeerID:    sub.id,
+		TrackID:   recv.TrackID(),
+		StreamID:  recv.StreamID(),
+		Kind:      recv.Kind().String(),
+		Attrs:     map[string]string{"publisher": r.id},
+	}
+	downTrack.onLayerSwitched = func(layer int32) {
+		e := subscription
+		e.Type = EventLayerSwitched
+		e.Attrs = map[string]string{"publisher": r.id, "layer": strconv.Itoa(int(layer))}
+		r.events.Emit(e)
+	}
 
 	// nolint:scopelint
 	downTrack.OnCloseHandler(func() {
+		e := subscription
+		e.Type = EventSubscriptionRemoved
+		r.events.Emit(e)
 		if sub.pc.ConnectionState() != webrtc.PeerConnectionStateClosed {
 			if err := sub.pc.RemoveTrack(downTrack.transceiver.Sender()); err != nil {
 				if err == webrtc.ErrConnectionClosed {
@@ -285,7 +417,9 @@ func (r *router) AddDownTrack(sub *Subscriber, recv Receiver) (*DownTrack, error
 	})
 
 	sub.AddDownTrack(recv.StreamID(), downTrack)
-	recv.AddDownTrack(downTrack, r.config.Simulcast.BestQualityFirst)
+	recv.AddDownTrack(downTrack, config.Simulcast.BestQualityFirst)
+	subscription.Type = EventSubscriptionAdded
+	r.events.Emit(subscription)
 	return downTrack, nil
 }
 
@@ -295,7 +429,10 @@ func (r *router) deleteReceiver(track string, ssrc uint32) {
 		handler(r.receivers[track])
 	}
 	delete(r.receivers, track)
-	delete(r.stats, ssrc)
+	if s, ok := r.stats[ssrc]; ok {
+		r.metrics.RemoveStream(s)
+		delete(r.stats, ssrc)
+	}
 	r.Unlock()
 }
 
@@ -32,6 +32,9 @@ type packetMeta struct {
 	layer uint8
 	// Information that differs depending the codec
 	misc uint32
+	// padding is set for the probe padding packets, they have no source packet
+	// and are not retransmitted
+	padding bool
 }
 
 func (p *packetMeta) setVP8PayloadMeta(tlz0Idx uint8, picID uint16) {
@@ -64,6 +67,20 @@ func newSequencer(maxTrack int) *sequencer {
 func (n *sequencer) push(sn, offSn uint16, timeStamp uint32, layer uint8, head bool) *packetMeta {
 	n.Lock()
 	defer n.Unlock()
+	return n.pushLocked(sn, offSn, timeStamp, layer, head)
+}
+
+// pushPadding records a padding packet sent with the sequence number, so the NACKs
+// requesting it are dropped
+func (n *sequencer) pushPadding(offSn uint16, timeStamp uint32) {
+	n.Lock()
+	defer n.Unlock()
+	if pm := n.pushLocked(0, offSn, timeStamp, 0, true); pm != nil {
+		pm.padding = true
+	}
+}
+
+func (n *sequencer) pushLocked(sn, offSn uint16, timeStamp uint32, layer uint8, head bool) *packetMeta {
 	if !n.init {
 		n.headSN = offSn
 		n.init = true
@@ -117,7 +134,7 @@ func (n *sequencer) getSeqNoPairs(seqNo []uint16) []packetMeta {
 			step = n.max + step
 		}
 		seq := &n.seq[step]
-		if seq.targetSeqNo == sn {
+		if seq.targetSeqNo == sn && !seq.padding {
 			if seq.lastNack == 0 || refTime-seq.lastNack > ignoreRetransmission {
 				seq.lastNack = refTime
 				meta = append(meta, *seq)
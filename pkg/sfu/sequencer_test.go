@@ -97,3 +97,17 @@ func Test_sequencer_getNACKSeqNo(t *testing.T) {
 		})
 	}
 }
+
+func Test_sequencer_pushPadding(t *testing.T) {
+	n := newSequencer(500)
+	n.push(1, 11, 123, 0, true)
+	n.pushPadding(12, 123)
+	n.pushPadding(13, 123)
+	n.push(2, 14, 456, 0, true)
+
+	var got []uint16
+	for _, meta := range n.getSeqNoPairs([]uint16{11, 12, 13, 14}) {
+		got = append(got, meta.sourceSeqNo)
+	}
+	assert.Equal(t, []uint16{1, 2}, got)
+}
@@ -2,6 +2,7 @@ package sfu
 
 import (
 	"encoding/json"
+	"math"
 	"sync"
 	"time"
 
@@ -23,6 +24,8 @@ type Session interface {
 	RemovePeer(peer Peer)
 	AddRelayPeer(peerID string, signalData []byte) ([]byte, error)
 	AudioObserver() *AudioObserver
+	E2EE() bool
+	EnableE2EE()
 	AddDatachannel(owner string, dc *webrtc.DataChannel)
 	GetDCMiddlewares() []*Datachannel
 	GetFanOutDataChannelLabels() []string
@@ -42,13 +45,26 @@ type SessionLocal struct {
 	relayPeers     map[string]*RelayPeer
 	closed         atomicBool
 	audioObs       *AudioObserver
+	audioLevels    []AudioLevel
 	fanOutDCs      []string
 	datachannels   []*Datachannel
+	e2ee           atomicBool
+	lastN          *lastNSelector
+	migration      *migration
+	meshMu         sync.Mutex
+	meshRelays     map[string]map[string]*relay.Peer
 	onCloseHandler func()
 }
 
 const (
-	AudioLevelsMethod = "audioLevels"
+	AudioLevelsMethod      = "audioLevels"
+	AudioLevelValuesMethod = "audioLevelValues"
+	DominantSpeakerMethod  = "dominantSpeaker"
+	// E2EEKeyChannelLabel is the fan out datachannel label used by the peers to exchange
+	// the encryption keys, messages are relayed without being interpreted by the SFU.
+	E2EEKeyChannelLabel = "ion-sfu-e2ee"
+	// levelsDelta is the min change of an audio level value sent again to the peers
+	levelsDelta = 0.01
 )
 
 // NewSession creates a new SessionLocal
@@ -61,10 +77,44 @@ func NewSession(id string, dcs []*Datachannel, cfg WebRTCTransportConfig) Sessio
 		config:       cfg,
 		audioObs:     NewAudioObserver(cfg.Router.AudioLevelThreshold, cfg.Router.AudioLevelInterval, cfg.Router.AudioLevelFilter),
 	}
+	s.audioObs.SetSmoothing(cfg.Router.AudioLevelSmoothing)
+	if cfg.Router.LastN.N > 0 {
+		s.lastN = newLastNSelector(cfg.Router.LastN)
+	}
 	go s.audioLevelObserver(cfg.Router.AudioLevelInterval)
 	return s
 }
 
+// setRouterConfig applies a reloaded router config to the session: the audio observer
+// and last-N settings apply at once, the other settings to the tracks published and
+// subscribed after the call.
+func (s *SessionLocal) setRouterConfig(c RouterConfig) {
+	s.mu.Lock()
+	s.config.Router = c
+	s.mu.Unlock()
+
+	s.audioObs.Configure(c.AudioLevelThreshold, c.AudioLevelInterval, c.AudioLevelFilter)
+	s.audioObs.SetSmoothing(c.AudioLevelSmoothing)
+	for _, p := range s.Peers() {
+		if pub := p.Publisher(); pub != nil {
+			if r, ok := pub.GetRouter().(*router); ok {
+				r.setConfig(c)
+			}
+		}
+	}
+	for _, rp := range s.RelayPeers() {
+		if r, ok := rp.GetRouter().(*router); ok {
+			r.setConfig(c)
+		}
+	}
+}
+
+func (s *SessionLocal) routerConfig() RouterConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.Router
+}
+
 // ID return SessionLocal id
 func (s *SessionLocal) ID() string {
 	return s.id
@@ -74,6 +124,29 @@ func (s *SessionLocal) AudioObserver() *AudioObserver {
 	return s.audioObs
 }
 
+// E2EE returns true if the session tracks are end to end encrypted
+func (s *SessionLocal) E2EE() bool {
+	return s.e2ee.get()
+}
+
+// EnableE2EE switches the session to end to end encryption mode, the SFU stops parsing
+// the payloads of the tracks published after the call and the key exchange datachannel
+// is negotiated to the peers subscribing after the call.
+func (s *SessionLocal) EnableE2EE() {
+	if s.e2ee.get() {
+		return
+	}
+	s.e2ee.set(true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lbl := range s.fanOutDCs {
+		if lbl == E2EEKeyChannelLabel {
+			return
+		}
+	}
+	s.fanOutDCs = append(s.fanOutDCs, E2EEKeyChannelLabel)
+}
+
 func (s *SessionLocal) GetDCMiddlewares() []*Datachannel {
 	return s.datachannels
 }
@@ -90,6 +163,7 @@ func (s *SessionLocal) AddPeer(peer Peer) {
 	s.mu.Lock()
 	s.peers[peer.ID()] = peer
 	s.mu.Unlock()
+	s.config.Events.Emit(Event{Type: EventPeerJoined, SessionID: s.id, PeerID: peer.ID()})
 }
 
 func (s *SessionLocal) GetPeer(peerID string) Peer {
@@ -99,12 +173,15 @@ func (s *SessionLocal) GetPeer(peerID string) Peer {
 }
 
 func (s *SessionLocal) AddRelayPeer(peerID string, signalData []byte) ([]byte, error) {
+	s.mu.RLock()
+	cfg := s.config.forTransport()
+	s.mu.RUnlock()
 	p, err := relay.NewPeer(relay.PeerMeta{
 		PeerID:    peerID,
 		SessionID: s.id,
 	}, &relay.PeerConfig{
-		SettingEngine: s.config.Setting,
-		ICEServers:    s.config.Configuration.ICEServers,
+		SettingEngine: cfg.Setting,
+		ICEServers:    cfg.Configuration.ICEServers,
 		Logger:        Logger,
 	})
 	if err != nil {
@@ -119,7 +196,7 @@ func (s *SessionLocal) AddRelayPeer(peerID string, signalData []byte) ([]byte, e
 	}
 
 	p.OnReady(func() {
-		rp := NewRelayPeer(p, s, &s.config)
+		rp := NewRelayPeer(p, s, &cfg)
 		s.mu.Lock()
 		s.relayPeers[peerID] = rp
 		s.mu.Unlock()
@@ -128,7 +205,12 @@ func (s *SessionLocal) AddRelayPeer(peerID string, signalData []byte) ([]byte, e
 	p.OnClose(func() {
 		s.mu.Lock()
 		delete(s.relayPeers, peerID)
+		peerCount := len(s.peers) + len(s.relayPeers)
 		s.mu.Unlock()
+
+		if peerCount == 0 {
+			s.Close()
+		}
 	})
 
 	return resp, nil
@@ -145,12 +227,19 @@ func (s *SessionLocal) RemovePeer(p Peer) {
 	pid := p.ID()
 	Logger.V(0).Info("RemovePeer from SessionLocal", "peer_id", pid, "session_id", s.id)
 	s.mu.Lock()
-	if s.peers[pid] == p {
+	removed := s.peers[pid] == p
+	if removed {
 		delete(s.peers, pid)
 	}
 	peerCount := len(s.peers) + len(s.relayPeers)
 	s.mu.Unlock()
 
+	if removed {
+		s.config.Events.Emit(Event{Type: EventPeerLeft, SessionID: s.id, PeerID: pid})
+		// A peer leaving a migrating session is done with it
+		_ = s.migrated(pid)
+	}
+
 	// Close SessionLocal if no peers
 	if peerCount == 0 {
 		s.Close()
@@ -158,7 +247,7 @@ func (s *SessionLocal) RemovePeer(p Peer) {
 }
 
 func (s *SessionLocal) RemoveAllPeer() {
-	for _, peer := range s.peers {
+	for _, peer := range s.Peers() {
 		peer.Close()
 	}
 	s.Close()
@@ -229,11 +318,16 @@ func (s *SessionLocal) AddDatachannel(owner string, dc *webrtc.DataChannel) {
 // Publish will add a Sender to all peers in current SessionLocal from given
 // Receiver
 func (s *SessionLocal) Publish(router Router, r Receiver) {
+	pub := s.GetPeer(router.ID())
 	for _, p := range s.Peers() {
 		// Don't sub to self
 		if router.ID() == p.ID() || p.Subscriber() == nil {
 			continue
 		}
+		// Labels of relayed peers are unknown
+		if pub != nil && pub.Publisher() != nil && !p.Subscriber().policy.allowsPeer(pub.Publisher().Labels()) {
+			continue
+		}
 
 		Logger.V(0).Info("Publishing track to peer", "peer_id", p.ID())
 
@@ -251,7 +345,7 @@ func (s *SessionLocal) Subscribe(peer Peer) {
 	copy(fdc, s.fanOutDCs)
 	peers := make([]Peer, 0, len(s.peers))
 	for _, p := range s.peers {
-		if p == peer || p.Publisher() == nil {
+		if p == peer || p.Publisher() == nil || !peer.Subscriber().policy.allowsPeer(p.Publisher().Labels()) {
 			continue
 		}
 		peers = append(peers, p)
@@ -297,6 +391,10 @@ func (s *SessionLocal) Subscribe(peer Peer) {
 
 	// Subscribe to relay streams
 	for _, p := range s.RelayPeers() {
+		// A peer migrated from another node doesn't subscribe to its relayed tracks
+		if p.ID() == peer.ID() {
+			continue
+		}
 		err := p.GetRouter().AddDownTracks(peer.Subscriber(), nil)
 		if err != nil {
 			Logger.Error(err, "Subscribing to Router err")
@@ -383,6 +481,60 @@ func (s *SessionLocal) GetDataChannels(peerID, label string) []*webrtc.DataChann
 	return dcs
 }
 
+// forwardLastN pauses the video DownTracks of the streams not selected nor pinned. The
+// streams without audio, e.g. screen shares, are always forwarded, as are all the
+// streams until N speakers are selected.
+func (s *SessionLocal) forwardLastN(selected, streams []string, full bool) {
+	audio := make(map[string]bool, len(streams))
+	for _, id := range streams {
+		audio[id] = true
+	}
+	for _, p := range s.Peers() {
+		sub := p.Subscriber()
+		if sub == nil {
+			continue
+		}
+		for _, dt := range sub.DownTracks() {
+			if dt.Kind() != webrtc.RTPCodecTypeVideo {
+				continue
+			}
+			forward := !full || !audio[dt.StreamID()] || sub.isPinned(dt.StreamID())
+			for _, id := range selected {
+				if id == dt.StreamID() {
+					forward = true
+					break
+				}
+			}
+			dt.pause(!forward)
+		}
+	}
+}
+
+// updateLastN replaces the last-N selector when its config is reloaded, the video of
+// all the streams is forwarded again when last-N is disabled.
+func (s *SessionLocal) updateLastN(c LastNConfig) {
+	if s.lastN != nil && s.lastN.config == c {
+		return
+	}
+	if s.lastN == nil && c.N <= 0 {
+		return
+	}
+	if c.N <= 0 {
+		s.lastN = nil
+		for _, p := range s.Peers() {
+			if sub := p.Subscriber(); sub != nil {
+				for _, dt := range sub.DownTracks() {
+					if dt.Kind() == webrtc.RTPCodecTypeVideo {
+						dt.pause(false)
+					}
+				}
+			}
+		}
+		return
+	}
+	s.lastN = newLastNSelector(c)
+}
+
 func (s *SessionLocal) audioLevelObserver(audioLevelInterval int) {
 	if audioLevelInterval <= 50 {
 		Logger.V(0).Info("Values near/under 20ms may return unexpected values")
@@ -395,30 +547,88 @@ func (s *SessionLocal) audioLevelObserver(audioLevelInterval int) {
 		if s.closed.get() {
 			return
 		}
+		config := s.routerConfig()
+		if config.AudioLevelInterval > 0 {
+			audioLevelInterval = config.AudioLevelInterval
+		}
 		levels := s.audioObs.Calc()
+		s.updateLastN(config.LastN)
+		if s.lastN != nil {
+			streams := s.audioObs.streamIDs()
+			selected := s.lastN.update(s.audioObs.speakers(), streams, time.Now().UnixNano())
+			s.forwardLastN(selected, streams, s.lastN.full())
+		}
+		s.sendAudioEvents()
 
 		if levels == nil {
 			continue
 		}
 
-		msg := ChannelAPIMessage{
-			Method: AudioLevelsMethod,
-			Params: levels,
+		s.sendAPIMessage(AudioLevelsMethod, levels)
+	}
+}
+
+// sendAudioEvents sends the audio level values and the dominant speaker when they
+// changed to the peers over the API datachannel and the peer signaling callbacks.
+func (s *SessionLocal) sendAudioEvents() {
+	values := s.audioObs.Levels()
+	dominant, changed := s.audioObs.DominantSpeaker()
+	if !levelsChanged(s.audioLevels, values) {
+		values = nil
+	} else {
+		s.audioLevels = values
+		s.sendAPIMessage(AudioLevelValuesMethod, values)
+	}
+	var speaker *DominantSpeaker
+	if changed {
+		speaker = &dominant
+		s.sendAPIMessage(DominantSpeakerMethod, dominant)
+	}
+	if values == nil && speaker == nil {
+		return
+	}
+
+	for _, p := range s.Peers() {
+		if peer, ok := p.(*PeerLocal); ok {
+			peer.audioEvents.notify(peer, values, speaker)
 		}
+	}
+}
 
-		l, err := json.Marshal(&msg)
-		if err != nil {
-			Logger.Error(err, "Marshaling audio levels err")
-			continue
+// levelsChanged returns true if the streams, their voice activity or their levels
+// changed by at least levelsDelta since the levels last sent.
+func levelsChanged(prev, next []AudioLevel) bool {
+	if len(prev) != len(next) {
+		return true
+	}
+	for i := range next {
+		if prev[i].StreamID != next[i].StreamID || prev[i].Active != next[i].Active ||
+			math.Abs(prev[i].Level-next[i].Level) >= levelsDelta {
+			return true
 		}
+	}
+	return false
+}
 
-		sl := string(l)
-		dcs := s.GetDataChannels("", APIChannelLabel)
+// sendAPIMessage sends a message to all the peers API datachannels
+func (s *SessionLocal) sendAPIMessage(method string, params interface{}) {
+	msg := ChannelAPIMessage{
+		Method: method,
+		Params: params,
+	}
 
-		for _, ch := range dcs {
-			if err = ch.SendText(sl); err != nil {
-				Logger.Error(err, "Sending audio levels err")
-			}
+	l, err := json.Marshal(&msg)
+	if err != nil {
+		Logger.Error(err, "Marshaling api message err", "method", method)
+		return
+	}
+
+	sl := string(l)
+	dcs := s.GetDataChannels("", APIChannelLabel)
+
+	for _, ch := range dcs {
+		if err = ch.SendText(sl); err != nil {
+			Logger.Error(err, "Sending api message err", "method", method)
 		}
 	}
 }
@@ -2,11 +2,13 @@ package sfu
 
 import (
 	//"fmt"
+	"crypto/subtle"
 	"math/rand"
 	"net"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -15,8 +17,10 @@ import (
 
 	// cacheredis "github.com/pion/ion-sfu/pkg/cache"
 	"github.com/pion/ion-sfu/pkg/stats"
+	"github.com/pion/ion-sfu/pkg/tracing"
 	"github.com/pion/turn/v2"
 	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Logger is an implementation of logr.Logger. If is not provided - will be turned off.
@@ -40,6 +44,14 @@ type WebRTCTransportConfig struct {
 	Setting       webrtc.SettingEngine
 	Router        RouterConfig
 	BufferFactory *buffer.Factory
+	// ReceiverInterceptors are executed on the packets read from the publishers
+	ReceiverInterceptors PacketInterceptors
+	// DownTrackInterceptors are executed on the packets forwarded to each subscriber
+	DownTrackInterceptors PacketInterceptors
+	// Metrics of the SFU, nil without stats
+	Metrics *stats.Metrics
+	// Events emitted on the session lifecycle
+	Events *EventBus
 }
 
 type WebRTCTimeoutsConfig struct {
@@ -62,14 +74,36 @@ type WebRTCConfig struct {
 // Config for base SFU
 type Config struct {
 	SFU struct {
-		Ballast   int64 `mapstructure:"ballast"`
-		WithStats bool  `mapstructure:"withstats"`
+		Ballast   int64               `mapstructure:"ballast"`
+		WithStats bool                `mapstructure:"withstats"`
+		Metrics   stats.MetricsConfig `mapstructure:"metrics"`
+		// DrainTimeout is the max time in seconds waited for the sessions to end when
+		// draining, 300 when zero.
+		DrainTimeout int `mapstructure:"draintimeout"`
+		// AdminToken is the bearer token of the admin API, the API is disabled when
+		// empty.
+		AdminToken string `mapstructure:"admintoken"`
+		// NodeSecret is shared by the nodes to authenticate the relay signals of the
+		// migrations and the mesh, the relays are refused when empty.
+		NodeSecret string `mapstructure:"nodesecret"`
+		// MaxSessions is the max number of sessions of the SFU, unlimited when zero
+		MaxSessions int `mapstructure:"maxsessions"`
+		// MaxPeers is the max number of peers of a session, unlimited when zero
+		MaxPeers int `mapstructure:"maxpeers"`
+		// PullOrigin is the address of the origin SFU the json-rpc server pulls the
+		// sessions from, the -add flag of the server when empty.
+		PullOrigin string `mapstructure:"pullorigin"`
 	} `mapstructure:"sfu"`
-	WebRTC        WebRTCConfig `mapstructure:"webrtc"`
-	Router        RouterConfig `mapstructure:"Router"`
-	Turn          TurnConfig   `mapstructure:"turn"`
+	WebRTC        WebRTCConfig   `mapstructure:"webrtc"`
+	Router        RouterConfig   `mapstructure:"Router"`
+	Turn          TurnConfig     `mapstructure:"turn"`
+	Events        EventsConfig   `mapstructure:"events"`
+	Tracing       tracing.Config `mapstructure:"tracing"`
+	Mesh          MeshConfig     `mapstructure:"mesh"`
 	BufferFactory *buffer.Factory
 	TurnAuth      func(username string, realm string, srcAddr net.Addr) ([]byte, bool)
+	// Registry the metrics are registered in, the prometheus default registry when nil
+	Registry prometheus.Registerer
 }
 
 var (
@@ -83,7 +117,32 @@ type SFU struct {
 	turn         *turn.Server
 	sessions     map[string]Session
 	datachannels []*Datachannel
-	withStats    bool
+	// sessionCodecs holds the mime types allowed by session id
+	sessionCodecs map[string][]string
+	// config is the applied config, compared to the reloaded ones
+	config Config
+	// ownsFactory is set when the buffer factory is configured from the router config
+	ownsFactory bool
+	// turnAuth holds the turn.AuthHandler of the TURN server built from the turn config
+	turnAuth atomic.Value
+	tracer   *tracing.Tracer
+	draining atomicBool
+	drained  chan struct{}
+	onDrain  []func()
+	// relaySignal reaches the target nodes of the migrations and the mesh nodes
+	relaySignal RelaySignalFunc
+	meshNodes   MeshNodesFunc
+}
+
+// forTransport returns a copy of the configuration with a buffer factory scoped to a
+// single transport, so streams of different transports using the same SSRC don't
+// share buffers.
+func (c WebRTCTransportConfig) forTransport() WebRTCTransportConfig {
+	if c.BufferFactory != nil {
+		c.BufferFactory = c.BufferFactory.ForTransport()
+		c.Setting.BufferFactory = c.BufferFactory.GetOrNew
+	}
+	return c
 }
 
 // NewWebRTCTransportConfig parses our settings and returns a usable WebRTCTransportConfig for creating PeerConnections
@@ -174,7 +233,15 @@ func NewWebRTCTransportConfig(c Config) WebRTCTransportConfig {
 
 	if c.SFU.WithStats {
 		w.Router.WithStats = true
-		stats.InitStats()
+		if c.Registry != nil {
+			m, err := stats.NewMetrics(c.Registry, c.SFU.Metrics)
+			if err != nil {
+				panic(err)
+			}
+			w.Metrics = m
+		} else {
+			w.Metrics = stats.DefaultMetrics(c.SFU.Metrics)
+		}
 	}
 
 	return w
@@ -197,20 +264,75 @@ func NewSFU(c Config) *SFU {
 	// Init ballast
 	ballast := make([]byte, c.SFU.Ballast*1024*1024)
 
-	if c.BufferFactory == nil {
+	ownsFactory := c.BufferFactory == nil
+	if ownsFactory {
 		c.BufferFactory = buffer.NewBufferFactory(c.Router.MaxPacketTrack, Logger)
+		c.BufferFactory.SetReorderWindow(c.Router.ReorderWindow)
+		c.BufferFactory.SetAdaptiveBuckets(c.Router.AdaptiveBuckets)
+		c.BufferFactory.SetMemoryBudget(int64(c.Router.BufferBudget) * 1024 * 1024)
+	}
+
+	var tracer *tracing.Tracer
+	if c.Tracing.Enabled {
+		tracing.Logger = Logger
+		tracer = tracing.New(c.Tracing)
+		tracing.SetTracer(tracer)
+	}
+	if c.SFU.DrainTimeout <= 0 {
+		c.SFU.DrainTimeout = defaultDrainTimeout
 	}
 
 	w := NewWebRTCTransportConfig(c)
+	w.Events = NewEventBus()
+	for _, wh := range c.Events.Webhooks {
+		w.Events.AddSink(NewWebhookSink(wh))
+	}
+	if c.Events.File != "" {
+		if sink, err := NewFileSink(c.Events.File); err != nil {
+			Logger.Error(err, "Opening events file failed", "file", c.Events.File)
+		} else {
+			w.Events.AddSink(sink)
+		}
+	}
+
+	c.BufferFactory.OnSSRCCollision(func(ssrc uint32) {
+		Logger.V(0).Info("SSRC collision between transports", "ssrc", ssrc)
+		w.Metrics.SSRCCollision()
+	})
+	if w.Metrics != nil {
+		w.Metrics.RegisterPoolStats(c.BufferFactory.PoolStats)
+	}
 
 	sfu := &SFU{
-		webrtc:    w,
-		sessions:  make(map[string]Session),
-		withStats: w.Router.WithStats,
+		webrtc:        w,
+		sessions:      make(map[string]Session),
+		sessionCodecs: make(map[string][]string),
+		config:        c,
+		ownsFactory:   ownsFactory,
+		tracer:        tracer,
+		drained:       make(chan struct{}),
+	}
+	for _, sc := range c.Router.Media.Sessions {
+		sfu.sessionCodecs[sc.ID] = sc.Codecs
+	}
+
+	if len(c.Mesh.Nodes) > 0 || c.Mesh.RedisPrefix != "" {
+		refresh := c.Mesh.Refresh
+		if refresh <= 0 {
+			refresh = defaultMeshRefresh
+		}
+		w.Events.AddSink(&meshSink{sfu: sfu})
+		go sfu.meshLoop(time.Duration(refresh) * time.Second)
 	}
 
 	if c.Turn.Enabled {
-		ts, err := InitTurnServer(c.Turn, c.TurnAuth)
+		auth := c.TurnAuth
+		if auth == nil {
+			// The handler built from the config is replaced on reload
+			sfu.turnAuth.Store(turnAuthHandler(c.Turn))
+			auth = sfu.authenticateTurn
+		}
+		ts, err := InitTurnServer(c.Turn, auth)
 		if err != nil {
 			Logger.Error(err, "Could not init turn server err")
 			os.Exit(1)
@@ -224,29 +346,62 @@ func NewSFU(c Config) *SFU {
 
 // NewSession creates a new SessionLocal instance
 func (s *SFU) newSession(id string) Session {
-	session := NewSession(id, s.datachannels, s.webrtc).(*SessionLocal)
+	s.RLock()
+	w := s.webrtc
+	s.RUnlock()
+	session := NewSession(id, s.datachannels, w).(*SessionLocal)
 
 	session.OnClose(func() {
 		s.Lock()
 		delete(s.sessions, id)
 		s.Unlock()
 
-		if s.withStats {
-			stats.Sessions.Dec()
-		}
+		s.webrtc.Metrics.SessionClosed(id)
+		s.webrtc.Events.Emit(Event{Type: EventSessionClosed, SessionID: id})
 	})
 
 	s.Lock()
 	s.sessions[id] = session
 	s.Unlock()
 
-	if s.withStats {
-		stats.Sessions.Inc()
-	}
+	s.webrtc.Metrics.SessionStarted(id)
+	s.webrtc.Events.Emit(Event{Type: EventSessionCreated, SessionID: id})
 
 	return session
 }
 
+// Metrics returns the metrics of the SFU, nil when the stats are disabled
+func (s *SFU) Metrics() *stats.Metrics {
+	return s.webrtc.Metrics
+}
+
+// Events returns the bus of the session lifecycle events
+func (s *SFU) Events() *EventBus {
+	return s.webrtc.Events
+}
+
+// AddEventSink adds a sink receiving the session lifecycle events
+func (s *SFU) AddEventSink(sink EventSink) {
+	s.webrtc.Events.AddSink(sink)
+}
+
+// AuthorizeAdmin returns true if the token is the admin token of the config, nobody is
+// authorized when it is empty.
+func (s *SFU) AuthorizeAdmin(token string) bool {
+	s.RLock()
+	want := s.config.SFU.AdminToken
+	s.RUnlock()
+	return want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// PullOrigin returns the address of the origin SFU the sessions are pulled from, empty
+// when not set in the config
+func (s *SFU) PullOrigin() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.config.SFU.PullOrigin
+}
+
 // GetSession by id
 func (s *SFU) getSession(id string) Session {
 	s.RLock()
@@ -259,7 +414,27 @@ func (s *SFU) GetSession(sid string) (Session, WebRTCTransportConfig) {
 	if session == nil {
 		session = s.newSession(sid)
 	}
-	return session, s.webrtc
+	s.RLock()
+	cfg := s.webrtc
+	codecs, ok := s.sessionCodecs[sid]
+	s.RUnlock()
+	if ok {
+		cfg.Router.Media = cfg.Router.Media.restrict(codecs)
+	}
+	return session, cfg
+}
+
+// SetSessionCodecs restricts the codecs negotiated with the publishers joining the session
+// to the given mime types, e.g. "video/h264" and "audio/opus". Without mime types the
+// restriction is removed.
+func (s *SFU) SetSessionCodecs(sid string, mimes ...string) {
+	s.Lock()
+	defer s.Unlock()
+	if len(mimes) == 0 {
+		delete(s.sessionCodecs, sid)
+		return
+	}
+	s.sessionCodecs[sid] = mimes
 }
 
 func (s *SFU) NewDatachannel(label string) *Datachannel {
@@ -268,6 +443,18 @@ func (s *SFU) NewDatachannel(label string) *Datachannel {
 	return dc
 }
 
+// UseReceiverInterceptors adds interceptors executed on the packets of the tracks
+// published on the sessions created after the call.
+func (s *SFU) UseReceiverInterceptors(interceptors ...func(PacketProcessor) PacketProcessor) {
+	s.webrtc.ReceiverInterceptors = append(s.webrtc.ReceiverInterceptors, interceptors...)
+}
+
+// UseDownTrackInterceptors adds interceptors executed on the packets forwarded to the
+// subscribers of the sessions created after the call.
+func (s *SFU) UseDownTrackInterceptors(interceptors ...func(PacketProcessor) PacketProcessor) {
+	s.webrtc.DownTrackInterceptors = append(s.webrtc.DownTrackInterceptors, interceptors...)
+}
+
 // GetSessions return all sessions
 func (s *SFU) GetSessions() []Session {
 	s.RLock()
@@ -280,6 +467,9 @@ func (s *SFU) GetSessions() []Session {
 }
 
 func (s *SFU) CheckSession(id string) (bool, bool, *SFU) {
+	if s.Draining() {
+		return false, false, s
+	}
 	session := s.getSession(id)
 	//sessions := s.GetSessions()
 	var result bool = false
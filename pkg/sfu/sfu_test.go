@@ -10,6 +10,8 @@ import (
 	"github.com/pion/ion-sfu/pkg/logger"
 	"github.com/pion/webrtc/v3"
 	med "github.com/pion/webrtc/v3/pkg/media"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -137,6 +139,14 @@ func newTestConfig() Config {
 	}
 }
 
+// newSessionTestConfig returns a test config whose audio observers don't log when they
+// start, the tests may swap the logger while they run.
+func newSessionTestConfig() Config {
+	c := newTestConfig()
+	c.Router.AudioLevelInterval = 1000
+	return c
+}
+
 func TestSFU_SessionScenarios(t *testing.T) {
 	logger.SetGlobalOptions(logger.GlobalConfig{V: 2}) // 2 - TRACE
 	Logger = logger.New()
@@ -215,7 +225,7 @@ func TestSFU_SessionScenarios(t *testing.T) {
 					func() {
 						switch action.kind {
 						case "join":
-							me, _ := getPublisherMediaEngine()
+							me, _ := getPublisherMediaEngine(RouterConfig{})
 							se := webrtc.SettingEngine{}
 							se.DisableMediaEngineCopy(true)
 							err := me.RegisterDefaultCodecs()
@@ -357,3 +367,59 @@ func TestSFU_SessionScenarios(t *testing.T) {
 		})
 	}
 }
+
+func TestSFU_SessionMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c := newSessionTestConfig()
+	c.SFU.WithStats = true
+	c.SFU.Metrics.SessionLabels = true
+	c.Registry = registry
+	s := NewSFU(c)
+	sink := &testSink{}
+	s.AddEventSink(sink)
+
+	p, _, _, stop := joinPublisher(t, s, "session")
+	defer stop()
+	n, err := testutil.GatherAndCount(registry, "sfu_peers", "sfu_audio_tracks")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// The last peer closes the session before its router stops and its track is removed,
+	// the series of the session are removed and not reported as another session.
+	assert.NoError(t, p.Close())
+	assert.Eventually(t, func() bool {
+		sink.Lock()
+		defer sink.Unlock()
+		for _, e := range sink.events {
+			if e.Type == EventTrackUnpublished {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	n, err = testutil.GatherAndCount(registry, "sfu_peers", "sfu_audio_tracks", "sfu_video_tracks")
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestSFU_AuthorizeAdmin(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		caller string
+		want   bool
+	}{
+		{name: "Must refuse all callers without token", caller: "", want: false},
+		{name: "Must refuse a wrong token", token: "token", caller: "other", want: false},
+		{name: "Must refuse a missing token", token: "token", caller: "", want: false},
+		{name: "Must authorize the token", token: "token", caller: "token", want: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSessionTestConfig()
+			c.SFU.AdminToken = tt.token
+			assert.Equal(t, tt.want, NewSFU(c).AuthorizeAdmin(tt.caller))
+		})
+	}
+}
@@ -2,17 +2,29 @@ package sfu
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bep/debounce"
+	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 )
 
 const APIChannelLabel = "ion-sfu"
 
+// ssrcGroup is a repair stream associated to a media stream
+type ssrcGroup struct {
+	semantics string
+	media     uint32
+	repair    uint32
+}
+
 type Subscriber struct {
 	sync.RWMutex
 
@@ -28,10 +40,16 @@ type Subscriber struct {
 	closeOnce sync.Once
 
 	noAutoSubscribe bool
+	policy          *SubscriptionPolicy
+	// pinned streams are forwarded regardless of the last-N selection
+	pinned map[string]struct{}
+	// bufferFactory of the subscriber transport
+	bufferFactory *buffer.Factory
 }
 
 // NewSubscriber creates a new Subscriber
 func NewSubscriber(id string, cfg WebRTCTransportConfig) (*Subscriber, error) {
+	cfg = cfg.forTransport()
 	me, err := getSubscriberMediaEngine()
 	if err != nil {
 		Logger.Error(err, "NewPeer error")
@@ -51,6 +69,8 @@ func NewSubscriber(id string, cfg WebRTCTransportConfig) (*Subscriber, error) {
 		pc:              pc,
 		tracks:          make(map[string][]*DownTrack),
 		channels:        make(map[string]*webrtc.DataChannel),
+		pinned:          make(map[string]struct{}),
+		bufferFactory:   cfg.BufferFactory,
 		noAutoSubscribe: false,
 	}
 
@@ -124,7 +144,62 @@ func (s *Subscriber) CreateOffer() (webrtc.SessionDescription, error) {
 		return webrtc.SessionDescription{}, err
 	}
 
-	return offer, nil
+	return s.addSSRCGroups(offer), nil
+}
+
+// LocalDescription returns the local description of the subscriber as it was signaled,
+// with the SSRC groups of the repair streams. The PeerConnection rejects munged local
+// descriptions so its own local description doesn't have them.
+func (s *Subscriber) LocalDescription() *webrtc.SessionDescription {
+	desc := s.pc.LocalDescription()
+	if desc == nil {
+		return nil
+	}
+	munged := s.addSSRCGroups(*desc)
+	return &munged
+}
+
+// addSSRCGroups signals the repair streams of the DownTracks to the remote peer,
+// the local description is kept untouched since the streams are handled by the DownTracks.
+func (s *Subscriber) addSSRCGroups(offer webrtc.SessionDescription) webrtc.SessionDescription {
+	var groups []ssrcGroup
+	for _, dt := range s.DownTracks() {
+		groups = append(groups, dt.ssrcGroups()...)
+	}
+	if len(groups) == 0 {
+		return offer
+	}
+
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		Logger.Error(err, "Unmarshal offer err", "peer_id", s.id)
+		return offer
+	}
+	for _, md := range parsed.MediaDescriptions {
+		for _, g := range groups {
+			prefix := strconv.FormatUint(uint64(g.media), 10) + " "
+			var attrs []sdp.Attribute
+			for _, a := range md.Attributes {
+				if a.Key == "ssrc" && strings.HasPrefix(a.Value, prefix) {
+					attrs = append(attrs, sdp.NewAttribute("ssrc",
+						strconv.FormatUint(uint64(g.repair), 10)+" "+strings.TrimPrefix(a.Value, prefix)))
+				}
+			}
+			if len(attrs) == 0 {
+				continue
+			}
+			md.Attributes = append(md.Attributes, sdp.NewAttribute("ssrc-group",
+				fmt.Sprintf("%s %d %d", g.semantics, g.media, g.repair)))
+			md.Attributes = append(md.Attributes, attrs...)
+		}
+	}
+	raw, err := parsed.Marshal()
+	if err != nil {
+		Logger.Error(err, "Marshal offer err", "peer_id", s.id)
+		return offer
+	}
+	offer.SDP = string(raw)
+	return offer
 }
 
 // OnICECandidate handler
@@ -234,6 +309,32 @@ func (s *Subscriber) GetDownTracks(streamID string) []*DownTrack {
 	return s.tracks[streamID]
 }
 
+// SetPinnedStreams sets the streams forwarded regardless of the last-N selection, the
+// pinned streams are forwarded at once and the unpinned ones follow the selection from
+// the next audio level interval.
+func (s *Subscriber) SetPinnedStreams(streamIDs ...string) {
+	s.Lock()
+	s.pinned = make(map[string]struct{}, len(streamIDs))
+	var downTracks []*DownTrack
+	for _, id := range streamIDs {
+		s.pinned[id] = struct{}{}
+		downTracks = append(downTracks, s.tracks[id]...)
+	}
+	s.Unlock()
+	for _, dt := range downTracks {
+		if dt.Kind() == webrtc.RTPCodecTypeVideo {
+			dt.pause(false)
+		}
+	}
+}
+
+func (s *Subscriber) isPinned(streamID string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	_, ok := s.pinned[streamID]
+	return ok
+}
+
 // Negotiate fires a debounced negotiation request
 func (s *Subscriber) Negotiate() {
 	s.negotiate()
@@ -0,0 +1,59 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type trackReceiver struct {
+	Receiver
+}
+
+func (r *trackReceiver) TrackID() string  { return "video" }
+func (r *trackReceiver) StreamID() string { return "stream" }
+
+// ssrcAttributes returns the ssrc and ssrc-group attributes of the media descriptions
+func ssrcAttributes(t *testing.T, desc string) [][]sdp.Attribute {
+	parsed := &sdp.SessionDescription{}
+	assert.NoError(t, parsed.Unmarshal([]byte(desc)))
+	var attrs [][]sdp.Attribute
+	for _, md := range parsed.MediaDescriptions {
+		var mattrs []sdp.Attribute
+		for _, a := range md.Attributes {
+			if a.Key == "ssrc" || a.Key == "ssrc-group" {
+				mattrs = append(mattrs, a)
+			}
+		}
+		attrs = append(attrs, mattrs)
+	}
+	return attrs
+}
+
+func TestSubscriber_CreateOffer(t *testing.T) {
+	s, err := NewSubscriber("subscriber", NewWebRTCTransportConfig(newTestConfig()))
+	assert.NoError(t, err)
+	defer s.Close()
+
+	codec := webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	}
+	assert.NoError(t, s.me.RegisterCodec(codec, webrtc.RTPCodecTypeVideo))
+	dt, err := NewDownTrack(codec.RTPCodecCapability, &trackReceiver{}, nil, s.id, 200)
+	assert.NoError(t, err)
+	dt.transceiver, err = s.pc.AddTransceiverFromTrack(dt, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	})
+	assert.NoError(t, err)
+	dt.rtxSSRC = 1234
+	s.AddDownTrack(dt.StreamID(), dt)
+
+	offer, err := s.CreateOffer()
+	assert.NoError(t, err)
+	assert.Contains(t, offer.SDP, "a=ssrc-group:FID ")
+	assert.Equal(t, ssrcAttributes(t, offer.SDP), ssrcAttributes(t, s.LocalDescription().SDP))
+	assert.NotContains(t, s.pc.LocalDescription().SDP, "a=ssrc-group:FID ")
+}
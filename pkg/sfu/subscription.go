@@ -0,0 +1,52 @@
+package sfu
+
+import "github.com/pion/webrtc/v3"
+
+// SubscriptionPolicy filters the tracks a peer is automatically subscribed to, tracks
+// not matching the policy are not negotiated. Empty fields don't filter.
+type SubscriptionPolicy struct {
+	// AudioOnly subscribes only the audio tracks
+	AudioOnly bool
+	// VideoOnly subscribes only the video tracks
+	VideoOnly bool
+	// StreamIDs lists the streams subscribed
+	StreamIDs []string
+	// Labels the publishing peers must have, relayed tracks are not filtered by labels
+	// since the labels of the remote peers are unknown.
+	Labels map[string]string
+}
+
+// allowsPeer returns true if the tracks of a peer with the given labels can be subscribed
+func (p *SubscriptionPolicy) allowsPeer(labels map[string]string) bool {
+	if p == nil {
+		return true
+	}
+	for k, v := range p.Labels {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsTrack returns true if the track of the receiver can be subscribed
+func (p *SubscriptionPolicy) allowsTrack(recv Receiver) bool {
+	if p == nil {
+		return true
+	}
+	if p.AudioOnly && recv.Kind() != webrtc.RTPCodecTypeAudio {
+		return false
+	}
+	if p.VideoOnly && recv.Kind() != webrtc.RTPCodecTypeVideo {
+		return false
+	}
+	if len(p.StreamIDs) == 0 {
+		return true
+	}
+	for _, id := range p.StreamIDs {
+		if id == recv.StreamID() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionPolicy_allowsPeer(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *SubscriptionPolicy
+		labels map[string]string
+		want   bool
+	}{
+		{
+			name: "Must allow without policy",
+			want: true,
+		},
+		{
+			name:   "Must allow matching labels",
+			policy: &SubscriptionPolicy{Labels: map[string]string{"role": "presenter"}},
+			labels: map[string]string{"role": "presenter", "lang": "en"},
+			want:   true,
+		},
+		{
+			name:   "Must reject different label",
+			policy: &SubscriptionPolicy{Labels: map[string]string{"role": "presenter"}},
+			labels: map[string]string{"role": "viewer"},
+		},
+		{
+			name:   "Must reject missing label",
+			policy: &SubscriptionPolicy{Labels: map[string]string{"role": "presenter"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.allowsPeer(tt.labels))
+		})
+	}
+}
+
+func TestSubscriptionPolicy_allowsTrack(t *testing.T) {
+	audio := &WebRTCReceiver{kind: webrtc.RTPCodecTypeAudio, streamID: "a"}
+	video := &WebRTCReceiver{kind: webrtc.RTPCodecTypeVideo, streamID: "b"}
+	tests := []struct {
+		name   string
+		policy *SubscriptionPolicy
+		want   []bool
+	}{
+		{
+			name: "Must allow without policy",
+			want: []bool{true, true},
+		},
+		{
+			name:   "Must allow audio only",
+			policy: &SubscriptionPolicy{AudioOnly: true},
+			want:   []bool{true, false},
+		},
+		{
+			name:   "Must allow video only",
+			policy: &SubscriptionPolicy{VideoOnly: true},
+			want:   []bool{false, true},
+		},
+		{
+			name:   "Must allow listed streams",
+			policy: &SubscriptionPolicy{StreamIDs: []string{"b"}},
+			want:   []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, []bool{tt.policy.allowsTrack(audio), tt.policy.allowsTrack(video)})
+		})
+	}
+}
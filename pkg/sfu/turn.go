@@ -117,24 +117,7 @@ func InitTurnServer(conf TurnConfig, auth func(username, realm string, srcAddr n
 	}
 
 	if auth == nil {
-		if conf.Auth.Secret != "" {
-			logger := logging.NewDefaultLeveledLoggerForScope("lt-creds", logging.LogLevelTrace, os.Stdout)
-			auth = turn.NewLongTermAuthHandler(conf.Auth.Secret, logger)
-		} else {
-			usersMap := map[string][]byte{}
-			for _, kv := range regexp.MustCompile(`(\w+)=(\w+)`).FindAllStringSubmatch(conf.Auth.Credentials, -1) {
-				usersMap[kv[1]] = turn.GenerateAuthKey(kv[1], conf.Realm, kv[2])
-			}
-			if len(usersMap) == 0 {
-				Logger.Error(fmt.Errorf("No turn auth provided"), "Got err")
-			}
-			auth = func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
-				if key, ok := usersMap[username]; ok {
-					return key, true
-				}
-				return nil, false
-			}
-		}
+		auth = turnAuthHandler(conf)
 	}
 
 	return turn.NewServer(turn.ServerConfig{
@@ -168,3 +151,24 @@ func InitTurnServer(conf TurnConfig, auth func(username, realm string, srcAddr n
 		},
 	})
 }
+
+// turnAuthHandler returns the handler authenticating the TURN users with the auth config
+func turnAuthHandler(conf TurnConfig) turn.AuthHandler {
+	if conf.Auth.Secret != "" {
+		logger := logging.NewDefaultLeveledLoggerForScope("lt-creds", logging.LogLevelTrace, os.Stdout)
+		return turn.NewLongTermAuthHandler(conf.Auth.Secret, logger)
+	}
+	usersMap := map[string][]byte{}
+	for _, kv := range regexp.MustCompile(`(\w+)=(\w+)`).FindAllStringSubmatch(conf.Auth.Credentials, -1) {
+		usersMap[kv[1]] = turn.GenerateAuthKey(kv[1], conf.Realm, kv[2])
+	}
+	if len(usersMap) == 0 {
+		Logger.Error(fmt.Errorf("No turn auth provided"), "Got err")
+	}
+	return func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+		if key, ok := usersMap[username]; ok {
+			return key, true
+		}
+		return nil, false
+	}
+}
@@ -0,0 +1,571 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxSessions = 100
+	// otherLabel is the session label value of the sessions over the cardinality cap
+	otherLabel = "other"
+)
+
+// MetricsConfig defines the labels of the SFU metrics
+type MetricsConfig struct {
+	// SessionLabels adds a session label to the peer, track and egress metrics
+	SessionLabels bool `mapstructure:"sessionlabels"`
+	// MaxSessions is the max number of session label values, the metrics of the sessions
+	// over the cap are reported with the "other" session. Defaults to 100.
+	MaxSessions int `mapstructure:"maxsessions"`
+	// TopTracks is the number of tracks with the highest bitrate reported by track,
+	// zero disables the track metrics.
+	TopTracks int `mapstructure:"toptracks"`
+}
+
+// Metrics holds the prometheus collectors of a SFU, registered in its own registry
+// so several SFUs can coexist in the same process.
+type Metrics struct {
+	config   MetricsConfig
+	registry prometheus.Registerer
+	sessions *labelSet
+
+	drift                 prometheus.Histogram
+	expectedCount         prometheus.Counter
+	receivedCount         prometheus.Counter
+	packetCount           prometheus.Counter
+	totalBytes            prometheus.Counter
+	expectedMinusReceived prometheus.Summary
+	lostRate              prometheus.Summary
+	jitter                prometheus.Summary
+
+	sessionCount   prometheus.Gauge
+	peers          *prometheus.GaugeVec
+	audioTracks    *prometheus.GaugeVec
+	videoTracks    *prometheus.GaugeVec
+	ssrcCollisions prometheus.Counter
+	configReloads  prometheus.Counter
+	configRejected *prometheus.CounterVec
+
+	egressPackets *prometheus.CounterVec
+	egressBytes   *prometheus.CounterVec
+	nacksServed   *prometheus.CounterVec
+	plisSent      *prometheus.CounterVec
+	layerSwitches *prometheus.CounterVec
+
+	pullRTT        *prometheus.GaugeVec
+	pullLostRate   *prometheus.GaugeVec
+	pullReconnects *prometheus.CounterVec
+
+	tracks *trackCollector
+}
+
+var (
+	defaultMetrics     *Metrics
+	defaultMetricsOnce sync.Once
+)
+
+// DefaultMetrics returns the metrics registered in the prometheus default registry, the
+// config of the first call is used.
+func DefaultMetrics(c MetricsConfig) *Metrics {
+	defaultMetricsOnce.Do(func() {
+		m, err := NewMetrics(prometheus.DefaultRegisterer, c)
+		if err != nil {
+			panic(err)
+		}
+		defaultMetrics = m
+	})
+	return defaultMetrics
+}
+
+// InitStats registers the metrics in the prometheus default registry.
+//
+// Deprecated: use NewMetrics or DefaultMetrics.
+func InitStats() {
+	DefaultMetrics(MetricsConfig{})
+}
+
+// NewMetrics creates the SFU metrics and registers them in the given registry
+func NewMetrics(registry prometheus.Registerer, c MetricsConfig) (*Metrics, error) {
+	if c.MaxSessions <= 0 {
+		c.MaxSessions = defaultMaxSessions
+	}
+	var sessionLabels []string
+	if c.SessionLabels {
+		sessionLabels = []string{"session"}
+	}
+
+	m := &Metrics{
+		config:   c,
+		registry: registry,
+		sessions: newLabelSet(c.MaxSessions),
+
+		drift: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Subsystem: "rtp",
+			Name:      "drift_millis",
+			Buckets:   []float64{5, 10, 20, 40, 80, 160, math.Inf(+1)},
+		}),
+		expectedCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "rtp",
+			Name:      "expected",
+		}),
+		receivedCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "rtp",
+			Name:      "received",
+		}),
+		packetCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "rtp",
+			Name:      "packets",
+		}),
+		totalBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "rtp",
+			Name:      "bytes",
+		}),
+		expectedMinusReceived: prometheus.NewSummary(prometheus.SummaryOpts{
+			Subsystem: "rtp",
+			Name:      "expected_minus_received",
+		}),
+		lostRate: prometheus.NewSummary(prometheus.SummaryOpts{
+			Subsystem: "rtp",
+			Name:      "lost_rate",
+		}),
+		jitter: prometheus.NewSummary(prometheus.SummaryOpts{
+			Subsystem: "rtp",
+			Name:      "jitter",
+		}),
+
+		sessionCount: prometheus.NewGauge(prometheus.GaugeOpts{
+			Subsystem: "sfu",
+			Name:      "sessions",
+			Help:      "Current number of sessions",
+		}),
+		peers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "sfu",
+			Name:      "peers",
+			Help:      "Current number of peers connected",
+		}, sessionLabels),
+		audioTracks: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "sfu",
+			Name:      "audio_tracks",
+			Help:      "Current number of audio tracks",
+		}, sessionLabels),
+		videoTracks: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "sfu",
+			Name:      "video_tracks",
+			Help:      "Current number of video tracks",
+		}, sessionLabels),
+		ssrcCollisions: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "sfu",
+			Name:      "ssrc_collisions",
+			Help:      "Number of streams using a SSRC already used by another transport",
+		}),
+		configReloads: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "sfu",
+			Name:      "config_reloads",
+			Help:      "Number of configuration reloads applied",
+		}),
+		configRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "sfu",
+			Name:      "config_rejected",
+			Help:      "Number of reloaded configuration changes rejected as not applicable live",
+		}, []string{"field"}),
+
+		egressPackets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "egress",
+			Name:      "packets",
+			Help:      "Number of RTP packets sent to the subscribers",
+		}, sessionLabels),
+		egressBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "egress",
+			Name:      "bytes",
+			Help:      "Number of RTP payload bytes sent to the subscribers",
+		}, sessionLabels),
+		nacksServed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "egress",
+			Name:      "nacks_served",
+			Help:      "Number of packets retransmitted to the subscribers on NACK",
+		}, sessionLabels),
+		plisSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "egress",
+			Name:      "plis_sent",
+			Help:      "Number of PLIs of the subscribers sent to the publishers",
+		}, sessionLabels),
+		layerSwitches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "egress",
+			Name:      "layer_switches",
+			Help:      "Number of simulcast spatial layer switches of the subscribers",
+		}, sessionLabels),
+
+		pullRTT: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "pull",
+			Name:      "rtt_millis",
+			Help:      "Round trip time to the origin SFU",
+		}, []string{"origin"}),
+		pullLostRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "pull",
+			Name:      "lost_rate",
+			Help:      "Rate of the packets from the origin SFU lost",
+		}, []string{"origin"}),
+		pullReconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "pull",
+			Name:      "reconnects",
+			Help:      "Number of reconnections to the origin SFU",
+		}, []string{"origin"}),
+	}
+
+	collectors := []prometheus.Collector{
+		m.drift, m.expectedCount, m.receivedCount, m.packetCount, m.totalBytes,
+		m.expectedMinusReceived, m.lostRate, m.jitter,
+		m.sessionCount, m.peers, m.audioTracks, m.videoTracks, m.ssrcCollisions,
+		m.configReloads, m.configRejected,
+		m.egressPackets, m.egressBytes, m.nacksServed, m.plisSent, m.layerSwitches,
+		m.pullRTT, m.pullLostRate, m.pullReconnects,
+	}
+	if c.TopTracks > 0 {
+		m.tracks = newTrackCollector(c.TopTracks)
+		collectors = append(collectors, m.tracks)
+	}
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// sessionLabel returns the label values of the session metrics
+func (m *Metrics) sessionLabel(sid string) []string {
+	if !m.config.SessionLabels {
+		return nil
+	}
+	return []string{m.sessions.get(sid)}
+}
+
+// SessionStarted is called when a session is created
+func (m *Metrics) SessionStarted(sid string) {
+	if m == nil {
+		return
+	}
+	m.sessionCount.Inc()
+	if m.config.SessionLabels {
+		m.sessions.add(sid)
+	}
+}
+
+// SessionClosed is called when a session is closed, the series of the session are removed
+func (m *Metrics) SessionClosed(sid string) {
+	if m == nil {
+		return
+	}
+	m.sessionCount.Dec()
+	if m.config.SessionLabels && m.sessions.remove(sid) {
+		for _, vec := range []interface{ DeleteLabelValues(...string) bool }{
+			m.peers, m.audioTracks, m.videoTracks,
+			m.egressPackets, m.egressBytes, m.nacksServed, m.plisSent, m.layerSwitches,
+		} {
+			vec.DeleteLabelValues(sid)
+		}
+	}
+}
+
+// SessionMetrics are the metrics of the peers of a session. The session label is
+// resolved when they are created, the peers closed after their session update the
+// removed series instead of the series of another session.
+type SessionMetrics struct {
+	peers       prometheus.Gauge
+	audioTracks prometheus.Gauge
+	videoTracks prometheus.Gauge
+	downTrack   *DownTrackMetrics
+}
+
+// Session returns the metrics of a peer of the session
+func (m *Metrics) Session(sid string) *SessionMetrics {
+	if m == nil {
+		return nil
+	}
+	labels := m.sessionLabel(sid)
+	return &SessionMetrics{
+		peers:       m.peers.WithLabelValues(labels...),
+		audioTracks: m.audioTracks.WithLabelValues(labels...),
+		videoTracks: m.videoTracks.WithLabelValues(labels...),
+		downTrack: &DownTrackMetrics{
+			packets:       m.egressPackets.WithLabelValues(labels...),
+			bytes:         m.egressBytes.WithLabelValues(labels...),
+			nacksServed:   m.nacksServed.WithLabelValues(labels...),
+			plisSent:      m.plisSent.WithLabelValues(labels...),
+			layerSwitches: m.layerSwitches.WithLabelValues(labels...),
+		},
+	}
+}
+
+// PeerJoined is called when a peer joins the session
+func (s *SessionMetrics) PeerJoined() {
+	if s == nil {
+		return
+	}
+	s.peers.Inc()
+}
+
+// PeerLeft is called when a peer leaves the session
+func (s *SessionMetrics) PeerLeft() {
+	if s == nil {
+		return
+	}
+	s.peers.Dec()
+}
+
+// TrackAdded is called when a track is published to the session
+func (s *SessionMetrics) TrackAdded(video bool) {
+	if s == nil {
+		return
+	}
+	if video {
+		s.videoTracks.Inc()
+	} else {
+		s.audioTracks.Inc()
+	}
+}
+
+// TrackRemoved is called when a published track is closed
+func (s *SessionMetrics) TrackRemoved(video bool) {
+	if s == nil {
+		return
+	}
+	if video {
+		s.videoTracks.Dec()
+	} else {
+		s.audioTracks.Dec()
+	}
+}
+
+// DownTrack returns the egress metrics of a subscriber track of the session
+func (s *SessionMetrics) DownTrack() *DownTrackMetrics {
+	if s == nil {
+		return nil
+	}
+	return s.downTrack
+}
+
+// SSRCCollision is called when a stream uses a SSRC already used by another transport
+func (m *Metrics) SSRCCollision() {
+	if m == nil {
+		return
+	}
+	m.ssrcCollisions.Inc()
+}
+
+// ConfigReloaded is called when a reloaded configuration is applied
+func (m *Metrics) ConfigReloaded() {
+	if m == nil {
+		return
+	}
+	m.configReloads.Inc()
+}
+
+// ConfigRejected is called when a reloaded configuration changes a field that can't be
+// applied without a restart
+func (m *Metrics) ConfigRejected(field string) {
+	if m == nil {
+		return
+	}
+	m.configRejected.WithLabelValues(field).Inc()
+}
+
+// DownTrackMetrics are the egress metrics of a subscriber track
+type DownTrackMetrics struct {
+	packets       prometheus.Counter
+	bytes         prometheus.Counter
+	nacksServed   prometheus.Counter
+	plisSent      prometheus.Counter
+	layerSwitches prometheus.Counter
+}
+
+// Packet is called when a packet of the given payload size is sent
+func (d *DownTrackMetrics) Packet(size int) {
+	if d == nil {
+		return
+	}
+	d.packets.Inc()
+	d.bytes.Add(float64(size))
+}
+
+// NACKServed is called when a packet is retransmitted
+func (d *DownTrackMetrics) NACKServed() {
+	if d == nil {
+		return
+	}
+	d.nacksServed.Inc()
+}
+
+// PLISent is called when a PLI of the subscriber is sent to the publisher
+func (d *DownTrackMetrics) PLISent() {
+	if d == nil {
+		return
+	}
+	d.plisSent.Inc()
+}
+
+// LayerSwitch is called when the spatial layer forwarded is switched
+func (d *DownTrackMetrics) LayerSwitch() {
+	if d == nil {
+		return
+	}
+	d.layerSwitches.Inc()
+}
+
+// PullMetrics are the metrics of the link to an origin SFU
+type PullMetrics struct {
+	rtt        prometheus.Gauge
+	lostRate   prometheus.Gauge
+	reconnects prometheus.Counter
+}
+
+// PullLink returns the metrics of the link to the origin SFU
+func (m *Metrics) PullLink(origin string) *PullMetrics {
+	if m == nil {
+		return nil
+	}
+	return &PullMetrics{
+		rtt:        m.pullRTT.WithLabelValues(origin),
+		lostRate:   m.pullLostRate.WithLabelValues(origin),
+		reconnects: m.pullReconnects.WithLabelValues(origin),
+	}
+}
+
+// ObserveRTT sets the round trip time to the origin
+func (p *PullMetrics) ObserveRTT(rtt time.Duration) {
+	if p == nil {
+		return
+	}
+	p.rtt.Set(float64(rtt) / float64(time.Millisecond))
+}
+
+// ObserveLostRate sets the rate of the packets from the origin lost
+func (p *PullMetrics) ObserveLostRate(rate float64) {
+	if p == nil {
+		return
+	}
+	p.lostRate.Set(rate)
+}
+
+// Reconnect is called when the link to the origin is connected again
+func (p *PullMetrics) Reconnect() {
+	if p == nil {
+		return
+	}
+	p.reconnects.Inc()
+}
+
+// labelSet bounds the number of values of a label, the values over the cap are
+// reported as "other".
+type labelSet struct {
+	sync.RWMutex
+	max    int
+	values map[string]struct{}
+}
+
+func newLabelSet(max int) *labelSet {
+	return &labelSet{
+		max:    max,
+		values: make(map[string]struct{}),
+	}
+}
+
+// add adds the value if under the cap
+func (l *labelSet) add(value string) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.values) < l.max {
+		l.values[value] = struct{}{}
+	}
+}
+
+// remove removes the value, returns false when the value was reported as "other"
+func (l *labelSet) remove(value string) bool {
+	l.Lock()
+	defer l.Unlock()
+	_, ok := l.values[value]
+	delete(l.values, value)
+	return ok
+}
+
+func (l *labelSet) get(value string) string {
+	l.RLock()
+	defer l.RUnlock()
+	if _, ok := l.values[value]; ok {
+		return value
+	}
+	return otherLabel
+}
+
+// trackCollector reports the metrics of the tracks with the highest bitrate
+type trackCollector struct {
+	sync.Mutex
+	top     int
+	streams map[*Stream]struct{}
+
+	bitrate  *prometheus.Desc
+	lostRate *prometheus.Desc
+	jitter   *prometheus.Desc
+}
+
+func newTrackCollector(top int) *trackCollector {
+	labels := []string{"session", "track"}
+	return &trackCollector{
+		top:      top,
+		streams:  make(map[*Stream]struct{}),
+		bitrate:  prometheus.NewDesc("rtp_track_bitrate", "Bitrate of the published track", labels, nil),
+		lostRate: prometheus.NewDesc("rtp_track_lost_rate", "Lost rate of the published track", labels, nil),
+		jitter:   prometheus.NewDesc("rtp_track_jitter", "Jitter of the published track", labels, nil),
+	}
+}
+
+func (t *trackCollector) add(s *Stream) {
+	t.Lock()
+	t.streams[s] = struct{}{}
+	t.Unlock()
+}
+
+func (t *trackCollector) remove(s *Stream) {
+	t.Lock()
+	delete(t.streams, s)
+	t.Unlock()
+}
+
+// Describe implements prometheus.Collector
+func (t *trackCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.bitrate
+	ch <- t.lostRate
+	ch <- t.jitter
+}
+
+// Collect implements prometheus.Collector
+func (t *trackCollector) Collect(ch chan<- prometheus.Metric) {
+	type track struct {
+		stream  *Stream
+		bitrate uint64
+	}
+	t.Lock()
+	tracks := make([]track, 0, len(t.streams))
+	for s := range t.streams {
+		tracks = append(tracks, track{stream: s, bitrate: s.Buffer.Bitrate()})
+	}
+	t.Unlock()
+
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].bitrate > tracks[j].bitrate
+	})
+	if len(tracks) > t.top {
+		tracks = tracks[:t.top]
+	}
+	for _, tr := range tracks {
+		st := tr.stream.Buffer.GetStats()
+		ch <- prometheus.MustNewConstMetric(t.bitrate, prometheus.GaugeValue, float64(tr.bitrate), tr.stream.session, tr.stream.track)
+		ch <- prometheus.MustNewConstMetric(t.lostRate, prometheus.GaugeValue, float64(st.LostRate), tr.stream.session, tr.stream.track)
+		ch <- prometheus.MustNewConstMetric(t.jitter, prometheus.GaugeValue, st.Jitter, tr.stream.session, tr.stream.track)
+	}
+}
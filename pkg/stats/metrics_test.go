@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := NewMetrics(registry, MetricsConfig{})
+	assert.NoError(t, err)
+	_, err = NewMetrics(registry, MetricsConfig{})
+	assert.Error(t, err)
+
+	other, err := NewMetrics(prometheus.NewRegistry(), MetricsConfig{})
+	assert.NoError(t, err)
+
+	m.SessionStarted("s1")
+	m.Session("s1").PeerJoined()
+	other.SessionStarted("s1")
+	other.SessionStarted("s2")
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.sessionCount))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.peers))
+	assert.Equal(t, float64(2), testutil.ToFloat64(other.sessionCount))
+
+	var nilMetrics *Metrics
+	assert.NotPanics(t, func() {
+		nilMetrics.SessionStarted("s1")
+		nilMetrics.Session("s1").DownTrack().Packet(100)
+		nilMetrics.PullLink("origin").Reconnect()
+	})
+}
+
+func TestMetrics_SessionLabels(t *testing.T) {
+	m, err := NewMetrics(prometheus.NewRegistry(), MetricsConfig{SessionLabels: true, MaxSessions: 2})
+	assert.NoError(t, err)
+
+	for _, sid := range []string{"s1", "s2", "s3", "s4"} {
+		m.SessionStarted(sid)
+		sm := m.Session(sid)
+		sm.PeerJoined()
+		sm.DownTrack().Packet(100)
+	}
+	assert.Equal(t, 3, testutil.CollectAndCount(m.peers))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.peers.WithLabelValues(otherLabel)))
+	assert.Equal(t, float64(200), testutil.ToFloat64(m.egressBytes.WithLabelValues(otherLabel)))
+
+	m.SessionClosed("s1")
+	m.SessionClosed("s3")
+	assert.Equal(t, 2, testutil.CollectAndCount(m.peers))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.egressPackets))
+
+	// Freed label values are given to the new sessions
+	m.SessionStarted("s5")
+	m.Session("s5").PeerJoined()
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.peers.WithLabelValues("s5")))
+}
+
+func TestSessionMetrics_afterSessionClosed(t *testing.T) {
+	m, err := NewMetrics(prometheus.NewRegistry(), MetricsConfig{SessionLabels: true, MaxSessions: 1})
+	assert.NoError(t, err)
+
+	m.SessionStarted("s1")
+	m.SessionStarted("s2")
+	s1, s2 := m.Session("s1"), m.Session("s2")
+	s1.PeerJoined()
+	s1.TrackAdded(true)
+	s2.PeerJoined()
+
+	// The peers leave once their session is closed
+	m.SessionClosed("s1")
+	s1.TrackRemoved(true)
+	s1.PeerLeft()
+	assert.Equal(t, 1, testutil.CollectAndCount(m.peers))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.videoTracks))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.peers.WithLabelValues(otherLabel)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.videoTracks.WithLabelValues(otherLabel)))
+
+	m.SessionClosed("s2")
+	s2.PeerLeft()
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.peers.WithLabelValues(otherLabel)))
+}
@@ -1,7 +1,6 @@
 package stats
 
 import (
-	"math"
 	"sync"
 	"sync/atomic"
 
@@ -9,90 +8,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	driftBuckets = []float64{5, 10, 20, 40, 80, 160, math.Inf(+1)}
-
-	drift = prometheus.NewHistogram(prometheus.HistogramOpts{
-		Subsystem: "rtp",
-		Name:      "drift_millis",
-		Buckets:   driftBuckets,
-	})
-
-	expectedCount = prometheus.NewCounter(prometheus.CounterOpts{
-		Subsystem: "rtp",
-		Name:      "expected",
-	})
-
-	receivedCount = prometheus.NewCounter(prometheus.CounterOpts{
-		Subsystem: "rtp",
-		Name:      "received",
-	})
-
-	packetCount = prometheus.NewCounter(prometheus.CounterOpts{
-		Subsystem: "rtp",
-		Name:      "packets",
-	})
-
-	totalBytes = prometheus.NewCounter(prometheus.CounterOpts{
-		Subsystem: "rtp",
-		Name:      "bytes",
-	})
-
-	expectedMinusReceived = prometheus.NewSummary(prometheus.SummaryOpts{
-		Subsystem: "rtp",
-		Name:      "expected_minus_received",
-	})
-
-	lostRate = prometheus.NewSummary(prometheus.SummaryOpts{
-		Subsystem: "rtp",
-		Name:      "lost_rate",
-	})
-
-	jitter = prometheus.NewSummary(prometheus.SummaryOpts{
-		Subsystem: "rtp",
-		Name:      "jitter",
-	})
-
-	Sessions = prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: "sfu",
-		Name:      "sessions",
-		Help:      "Current number of sessions",
-	})
-
-	Peers = prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: "sfu",
-		Name:      "peers",
-		Help:      "Current number of peers connected",
-	})
-
-	AudioTracks = prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: "sfu",
-		Name:      "audio_tracks",
-		Help:      "Current number of audio tracks",
-	})
-
-	VideoTracks = prometheus.NewGauge(prometheus.GaugeOpts{
-		Subsystem: "sfu",
-		Name:      "video_tracks",
-		Help:      "Current number of video tracks",
-	})
-)
-
-func InitStats() {
-	prometheus.MustRegister(drift)
-	prometheus.MustRegister(expectedCount)
-	prometheus.MustRegister(receivedCount)
-	prometheus.MustRegister(packetCount)
-	prometheus.MustRegister(totalBytes)
-	prometheus.MustRegister(expectedMinusReceived)
-	prometheus.MustRegister(lostRate)
-	prometheus.MustRegister(jitter)
-	prometheus.MustRegister(Sessions)
-	prometheus.MustRegister(Peers)
-	prometheus.MustRegister(AudioTracks)
-	prometheus.MustRegister(VideoTracks)
-}
-
 // Stream contains buffer statistics
 type Stream struct {
 	sync.RWMutex
@@ -102,6 +17,10 @@ type Stream struct {
 	hasStats      bool
 	lastStats     buffer.Stats
 	diffStats     buffer.Stats
+	// metrics observing the stream stats and its labels
+	metrics *Metrics
+	session string
+	track   string
 }
 
 // NewStream constructs a new Stream
@@ -112,6 +31,27 @@ func NewStream(buffer *buffer.Buffer) *Stream {
 	return s
 }
 
+// NewStream constructs a new Stream observed by the metrics
+func (m *Metrics) NewStream(buffer *buffer.Buffer, sid, trackID string) *Stream {
+	s := &Stream{
+		Buffer:  buffer,
+		metrics: m,
+		session: sid,
+		track:   trackID,
+	}
+	if m != nil && m.tracks != nil {
+		m.tracks.add(s)
+	}
+	return s
+}
+
+// RemoveStream stops reporting the stream by track
+func (m *Metrics) RemoveStream(s *Stream) {
+	if m != nil && m.tracks != nil {
+		m.tracks.remove(s)
+	}
+}
+
 // GetCName returns the cname for a given stream
 func (s *Stream) GetCName() string {
 	s.RLock()
@@ -161,15 +101,54 @@ func (s *Stream) CalcStats() {
 
 	hadStats, diffStats := s.UpdateStats(bufferStats)
 
-	drift.Observe(float64(driftInMillis))
+	m := s.metrics
+	if m == nil {
+		return
+	}
+	m.drift.Observe(float64(driftInMillis))
 	if hadStats {
-		expectedCount.Add(float64(diffStats.LastExpected))
-		receivedCount.Add(float64(diffStats.LastReceived))
-		packetCount.Add(float64(diffStats.PacketCount))
-		totalBytes.Add(float64(diffStats.TotalByte))
+		m.expectedCount.Add(float64(diffStats.LastExpected))
+		m.receivedCount.Add(float64(diffStats.LastReceived))
+		m.packetCount.Add(float64(diffStats.PacketCount))
+		m.totalBytes.Add(float64(diffStats.TotalByte))
 	}
 
-	expectedMinusReceived.Observe(float64(bufferStats.LastExpected - bufferStats.LastReceived))
-	lostRate.Observe(float64(bufferStats.LostRate))
-	jitter.Observe(bufferStats.Jitter)
+	m.expectedMinusReceived.Observe(float64(bufferStats.LastExpected - bufferStats.LastReceived))
+	m.lostRate.Observe(float64(bufferStats.LostRate))
+	m.jitter.Observe(bufferStats.Jitter)
+}
+
+// RegisterPoolStats registers the metrics of the video bucket pools returned by fn
+func (m *Metrics) RegisterPoolStats(fn func() buffer.PoolStats) {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Subsystem: "buffer",
+			Name:      "pool_inuse_bytes",
+			Help:      "Memory held by the video buffers",
+		}, func() float64 { return float64(fn().InUseBytes) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Subsystem: "buffer",
+			Name:      "pool_budget_bytes",
+			Help:      "Memory budget of the video buffers, zero means unlimited",
+		}, func() float64 { return float64(fn().BudgetBytes) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Subsystem: "buffer",
+			Name:      "pool_buckets",
+			Help:      "Number of video buffers allocated from the pools",
+		}, func() float64 { return float64(fn().Buckets) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Subsystem: "buffer",
+			Name:      "pool_resizes",
+			Help:      "Number of video buffers resized to follow the stream bitrate",
+		}, func() float64 { return float64(fn().Resizes) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Subsystem: "buffer",
+			Name:      "pool_over_budget",
+			Help:      "Number of video buffers allocated smaller than needed by the memory budget",
+		}, func() float64 { return float64(fn().OverBudget) }),
+	}
+	for _, c := range collectors {
+		// SFU instances sharing the metrics keep the first pools
+		_ = m.registry.Register(c)
+	}
 }
@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEndpoint    = "http://localhost:4318"
+	defaultServiceName = "ion-sfu"
+	otlpTracesPath     = "/v1/traces"
+	otlpTimeout        = 10 * time.Second
+
+	otlpStatusError = 2
+)
+
+// OTLPExporter posts the spans to an OpenTelemetry collector with OTLP/HTTP and
+// the JSON encoding.
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// NewOTLPExporter creates an exporter posting to the collector at endpoint, a local
+// collector when empty.
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	if service == "" {
+		service = defaultServiceName
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(endpoint, otlpTracesPath) {
+		endpoint += otlpTracesPath
+	}
+	return &OTLPExporter{
+		url:     endpoint,
+		service: service,
+		client:  &http.Client{Timeout: otlpTimeout},
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	res := make([]otlpAttribute, 0, len(attrs))
+	for k, v := range attrs {
+		res = append(res, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+// encode returns the OTLP JSON request of the spans
+func (e *OTLPExporter) encode(spans []SpanData) ([]byte, error) {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(spans))}
+	scope.Scope.Name = defaultServiceName
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = otlpAttributes(map[string]string{"service.name": e.service})
+	return json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+}
+
+// ExportSpans implements Exporter
+func (e *OTLPExporter) ExportSpans(spans []SpanData) error {
+	body, err := e.encode(spans)
+	if err != nil {
+		return err
+	}
+	res, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("otlp collector %s replied %s", e.url, res.Status)
+	}
+	return nil
+}
+
+// Shutdown implements Exporter
+func (e *OTLPExporter) Shutdown() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,379 @@
+// Package tracing records the spans of the signaling of the SFU and propagates their
+// context between nodes with W3C traceparent values.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Logger is an implementation of logr.Logger. If is not provided - will be turned off.
+var Logger logr.Logger = logr.Discard()
+
+const (
+	// maxQueuedSpans is the number of ended spans queued before dropping them
+	maxQueuedSpans = 2048
+	// maxBatchSpans is the max number of spans exported at once
+	maxBatchSpans = 512
+	// batchInterval is the max delay before exporting the ended spans
+	batchInterval = 5 * time.Second
+)
+
+var (
+	// ErrInvalidTraceparent is returned when parsing a malformed traceparent
+	ErrInvalidTraceparent = errors.New("invalid traceparent")
+)
+
+// Config defines the export of the spans
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Endpoint of the OTLP/HTTP collector, the spans are posted to its /v1/traces path
+	Endpoint string `mapstructure:"endpoint"`
+	// ServiceName the spans are exported with, "ion-sfu" when empty
+	ServiceName string `mapstructure:"servicename"`
+	// SampleRatio of the traces started by the SFU, traces started by a remote parent
+	// follow its sampling decision. All traces are sampled when zero.
+	SampleRatio float64 `mapstructure:"sampleratio"`
+}
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace
+type SpanID [8]byte
+
+// IsValid reports whether the trace id is not all zeros
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether the span id is not all zeros
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span propagated to the remote nodes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether the span context has a trace and a span id
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the W3C traceparent of the span context
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent, the fields appended by versions other
+// than 00 are ignored.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || (len(s) > 55 && (s[:2] == "00" || s[55] != '-')) {
+		return sc, ErrInvalidTraceparent
+	}
+	parts := strings.Split(s[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 ||
+		len(parts[3]) != 2 || parts[0] == "ff" {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	return sc, nil
+}
+
+// SpanData is an ended span, as given to the exporters
+type SpanData struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	// Error is the message of the error recorded on the span
+	Error string
+}
+
+// Exporter sends the ended spans to a tracing backend
+type Exporter interface {
+	ExportSpans(spans []SpanData) error
+	Shutdown() error
+}
+
+// Span is an operation of a trace, the methods of a nil span are no-ops so the spans
+// can be used when tracing is disabled.
+type Span struct {
+	sync.Mutex
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed with the error, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Lock()
+	s.data.Error = err.Error()
+	s.Unlock()
+}
+
+// End ends the span and queues it for export, only the first call has an effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.Unlock()
+	if data.Context.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// SpanContext returns the context of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// Tracer creates the spans and exports them in batches
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+	queue       chan SpanData
+	done        chan struct{}
+	mu          sync.RWMutex
+	closed      bool
+}
+
+// NewTracer creates a tracer exporting the sampled spans to the exporter
+func NewTracer(exporter Exporter, sampleRatio float64) *Tracer {
+	if sampleRatio <= 0 || sampleRatio > 1 {
+		sampleRatio = 1
+	}
+	t := &Tracer{
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+		queue:       make(chan SpanData, maxQueuedSpans),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// New creates a tracer exporting the spans to the OTLP collector of the config
+func New(c Config) *Tracer {
+	return NewTracer(NewOTLPExporter(c.Endpoint, c.ServiceName), c.SampleRatio)
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		// The exporter can't keep up, tracing never blocks the signaling
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, maxBatchSpans)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.ExportSpans(batch); err != nil {
+			Logger.Error(err, "Exporting spans failed", "spans", len(batch))
+		}
+		batch = make([]SpanData, 0, maxBatchSpans)
+	}
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= maxBatchSpans {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Shutdown exports the ended spans and shuts the exporter down
+func (t *Tracer) Shutdown() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+	<-t.done
+	return t.exporter.Shutdown()
+}
+
+// Start starts a span of the tracer, child of the span or the remote span context of ctx
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := spanContextFromContext(ctx)
+	data := SpanData{Name: name, Start: time.Now()}
+	if parent.IsValid() {
+		data.Context.TraceID = parent.TraceID
+		data.Context.Sampled = parent.Sampled
+		data.Parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(data.Context.TraceID[:])
+		data.Context.Sampled = t.sample(data.Context.TraceID)
+	}
+	_, _ = rand.Read(data.Context.SpanID[:])
+	s := &Span{tracer: t, data: data}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// sample decides from the trace id whether a new trace is sampled
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	var v uint64
+	for _, b := range id[8:] {
+		v = v<<8 | uint64(b)
+	}
+	return float64(v>>11)/(1<<53) < t.sampleRatio
+}
+
+var (
+	globalMu sync.RWMutex
+	global   *Tracer
+)
+
+// SetTracer sets the tracer of Start, nil disables tracing
+func SetTracer(t *Tracer) {
+	globalMu.Lock()
+	global = t
+	globalMu.Unlock()
+}
+
+// GetTracer returns the tracer of Start, nil when tracing is disabled
+func GetTracer() *Tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global
+}
+
+// Start starts a span with the tracer set by SetTracer. The span is nil when tracing
+// is disabled, the context is then returned as is and still propagates its remote
+// span context.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	t := GetTracer()
+	if t == nil {
+		return ctx, nil
+	}
+	return t.Start(ctx, name)
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// SpanFromContext returns the span of ctx, nil if none
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func spanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Extract returns a context with the remote span context of the traceparent, the
+// spans started from it are its children. Invalid traceparents are ignored.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject returns the traceparent propagating the span of ctx, or its remote span
+// context when tracing is disabled. Empty when ctx has no span context.
+func Inject(ctx context.Context) string {
+	return spanContextFromContext(ctx).Traceparent()
+}
@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testExporter struct {
+	sync.Mutex
+	spans    []SpanData
+	shutdown bool
+}
+
+func (e *testExporter) ExportSpans(spans []SpanData) error {
+	e.Lock()
+	defer e.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *testExporter) Shutdown() error {
+	e.Lock()
+	defer e.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		sampled bool
+		wantErr bool
+	}{
+		{
+			name:    "Must parse a sampled traceparent",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled: true,
+		},
+		{
+			name:  "Must parse a not sampled traceparent",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{
+			name:    "Must ignore the fields of a future version",
+			value:   "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			sampled: true,
+		},
+		{
+			name:    "Must reject fields after version 00",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			wantErr: true,
+		},
+		{
+			name:    "Must reject a zero trace id",
+			value:   "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "Must reject version ff",
+			value:   "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "Must reject malformed ids",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e473-600f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "Must reject non hex ids",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "Must reject a short value",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if tt.wantErr {
+				assert.Equal(t, ErrInvalidTraceparent, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			assert.Equal(t, tt.sampled, sc.Sampled)
+			if tt.value[:2] == "00" {
+				assert.Equal(t, tt.value, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exp := &testExporter{}
+	tracer := NewTracer(exp, 0)
+
+	remote := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx, parent := tracer.Start(Extract(context.Background(), remote), "parent")
+	parent.SetAttribute("method", "join")
+	_, child := tracer.Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	assert.Equal(t, parent.SpanContext().Traceparent(), Inject(ctx))
+	assert.NoError(t, tracer.Shutdown())
+	assert.True(t, exp.shutdown)
+
+	if assert.Len(t, exp.spans, 2) {
+		c, p := exp.spans[0], exp.spans[1]
+		assert.Equal(t, "child", c.Name)
+		assert.Equal(t, "failed", c.Error)
+		assert.Equal(t, p.Context.SpanID, c.Parent)
+		assert.Equal(t, p.Context.TraceID, c.Context.TraceID)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", p.Context.TraceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", p.Parent.String())
+		assert.Equal(t, map[string]string{"method": "join"}, p.Attributes)
+		assert.False(t, p.End.Before(p.Start))
+	}
+
+	// Spans ended after the shutdown are dropped
+	_, late := tracer.Start(context.Background(), "late")
+	assert.NotPanics(t, late.End)
+}
+
+func TestTracer_NotSampled(t *testing.T) {
+	exp := &testExporter{}
+	tracer := NewTracer(exp, 0.5)
+
+	remote := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	ctx, span := tracer.Start(Extract(context.Background(), remote), "span")
+	span.End()
+	assert.NoError(t, tracer.Shutdown())
+
+	assert.Empty(t, exp.spans)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID.String()+"-00", Inject(ctx))
+}
+
+func TestStart_Disabled(t *testing.T) {
+	SetTracer(nil)
+	remote := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx, span := Start(Extract(context.Background(), remote), "span")
+
+	assert.Nil(t, span)
+	assert.NotPanics(t, func() {
+		span.SetAttribute("k", "v")
+		span.RecordError(errors.New("failed"))
+		span.End()
+	})
+	// The remote trace is still propagated
+	assert.Equal(t, remote, Inject(ctx))
+	assert.Empty(t, Inject(context.Background()))
+	assert.Equal(t, context.Background(), Extract(context.Background(), "invalid"))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(srv.URL+"/", "edge")
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	start := time.Unix(1, 0)
+	err := exp.ExportSpans([]SpanData{{
+		Name:       "JSONSignal.Handle",
+		Context:    sc,
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]string{"method": "join"},
+		Error:      "failed",
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, otlpTracesPath, path)
+
+	expected := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"edge"}}]},
+		"scopeSpans":[{"scope":{"name":"ion-sfu"},"spans":[{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736",
+		"spanId":"00f067aa0ba902b7","name":"JSONSignal.Handle","startTimeUnixNano":"1000000000",
+		"endTimeUnixNano":"2000000000","attributes":[{"key":"method","value":{"stringValue":"join"}}],
+		"status":{"code":2,"message":"failed"}}]}]}]}`
+	var want map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(expected), &want))
+	assert.Equal(t, want, body)
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	assert.Error(t, exp.ExportSpans([]SpanData{{Name: "span", Context: sc}}))
+	assert.NoError(t, exp.Shutdown())
+}